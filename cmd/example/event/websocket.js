@@ -0,0 +1,13 @@
+async function eventHandler(evt) {
+    const [client, server] = Object.values(new WebSocketPair())
+    server.accept()
+    server.addEventListener("message", (msg) => {
+        server.send(msg.data)
+    })
+    evt.respondWith(new Response(null, {
+        status: 101,
+        webSocket: client
+    }))
+}
+
+registerEventHandler(eventHandler)
\ No newline at end of file
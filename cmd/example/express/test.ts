@@ -11,18 +11,22 @@ registerExpressHandler(randomNumber)
 
 // heresy runtime types. similar to Express.js
 type MiddlewareRequest = {
+	headers: Record<string, string | string[] | undefined>
 	readonly ip: string
 	readonly method: string
 	readonly path: string
 	readonly protocol: 'http' | 'https'
 	readonly secure: boolean
+	readonly signal: AbortSignal
 	readonly res: MiddlewareResponse
 
 	get(headerKey: string): string | undefined
+	formData(): Promise<FormData>
 }
 
 type MiddlewareResponse = {
 	readonly headersSent: boolean
+	locals: Record<string, any>
 
 	send(body?: string | object | boolean | Array<unknown>): void
 	json(body?: string | object | number | boolean | null | Array<unknown>): void
@@ -35,6 +39,7 @@ type MiddlewareResponse = {
 }
 
 type MiddlewareContext = {
+	locals: Record<string, any>
 	req: MiddlewareRequest
 	res: MiddlewareResponse
 	next(): void
@@ -1,16 +1,19 @@
 package event
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"reflect"
 
+	"go.miragespace.co/heresy/extensions/blob"
 	"go.miragespace.co/heresy/extensions/common"
 	"go.miragespace.co/heresy/extensions/common/shared"
+	"go.miragespace.co/heresy/extensions/errorpage"
 	"go.miragespace.co/heresy/extensions/fetch"
-	"go.miragespace.co/heresy/extensions/kv"
-	"go.miragespace.co/heresy/extensions/stream"
+	"go.miragespace.co/heresy/extensions/websocket"
 
 	"github.com/dop251/goja"
 	pool "github.com/libp2p/go-buffer-pool"
@@ -23,8 +26,8 @@ type FetchEvent struct {
 	httpNext              http.Handler
 	ioContext             *common.IOContext
 	requestProxy          *fetchEventRequest
-	kvMapper              *kv.KVMapper
-	nativeFetch           goja.Value
+	extensions            *common.ExtensionHost
+	locals                *common.RequestLocals
 	nativeRequestResolve  goja.Value
 	nativeRequestReject   goja.Value
 	nativeResponseResolve goja.Value
@@ -32,13 +35,18 @@ type FetchEvent struct {
 	nativeConclude        goja.Value
 	nativeRespondWith     goja.Value
 	nativeWailUntil       goja.Value
+	nativePassThrough     goja.Value
+	nativeNext            goja.Value
+	passThroughReq        *http.Request
+	nextRecorder          *responseRecorder
+	signalStop            func()
 	requestDone           chan struct{}
 	responseDone          chan struct{}
 	deps                  FetchEventDeps
 	vm                    *goja.Runtime
 	nativeEvt             *goja.Object
 	nativeEvtInstance     *goja.Object
-	hasFetch              bool
+	keys                  []string
 	skipNext              bool
 	useRespondWith        bool
 	responseSent          bool
@@ -46,13 +54,16 @@ type FetchEvent struct {
 
 var _ goja.DynamicObject = (*FetchEvent)(nil)
 
-var eventProperties = []string{"kv", "request"}
+var eventProperties = []string{"locals", "request"}
 
 func newFetchEvent(vm *goja.Runtime, deps FetchEventDeps) *FetchEvent {
 	evt := &FetchEvent{
 		nativeEvtInstance: deps.Symbols.FetchEvent(),
 		requestDone:       make(chan struct{}, 1),
 		responseDone:      make(chan struct{}, 1),
+		extensions:        common.NewExtensionHost(vm, deps.Eventloop),
+		locals:            common.NewRequestLocals(vm),
+		keys:              append([]string{}, eventProperties...),
 		deps:              deps,
 		vm:                vm,
 	}
@@ -69,17 +80,18 @@ func (evt *FetchEvent) reset() {
 	evt.httpReq = nil
 	evt.httpResp = nil
 	evt.httpNext = nil
-	evt.nativeFetch = nil
-	evt.hasFetch = false
+	evt.signalStop = nil
+	evt.passThroughReq = nil
+	evt.nextRecorder = nil
 	evt.skipNext = false
 	evt.useRespondWith = false
 	evt.responseSent = false
 	if evt.requestProxy != nil {
 		evt.requestProxy.reset()
 	}
-	if evt.kvMapper != nil {
-		evt.kvMapper.Reset()
-	}
+	evt.extensions.Reset()
+	evt.locals.Reset()
+	evt.keys = evt.keys[:len(eventProperties)]
 	evt.ioContext = nil
 }
 
@@ -95,22 +107,18 @@ func (evt *FetchEvent) Get(key string) goja.Value {
 			evt.nativeWailUntil = evt.vm.ToValue(evt.waitUntil)
 		}
 		return evt.nativeWailUntil
-	case "fetch":
-		if evt.hasFetch {
-			if evt.nativeFetch == nil {
-				fetcher := evt.deps.Fetch.NewNativeFetchVM(evt.ioContext, evt.vm)
-				evt.nativeFetch = fetcher.NativeFunc()
-			}
-			return evt.nativeFetch
+	case "passThrough":
+		if evt.nativePassThrough == nil {
+			evt.nativePassThrough = evt.vm.ToValue(evt.passThrough)
 		}
-		return goja.Undefined()
-
-	case "kv":
-		if evt.kvMapper == nil {
-			evt.kvMapper = evt.deps.KV.GetKVMapper(evt.vm, evt.deps.Eventloop)
+		return evt.nativePassThrough
+	case "next":
+		if evt.nativeNext == nil {
+			evt.nativeNext = evt.vm.ToValue(evt.next)
 		}
-		evt.kvMapper.WithIOContext(evt.ioContext)
-		return evt.kvMapper.NativeObject()
+		return evt.nativeNext
+	case "locals":
+		return evt.locals.NativeObject(evt.httpReq)
 	case "request":
 		if evt.requestProxy == nil {
 			evt.requestProxy = newFetchEventRequest(evt)
@@ -118,16 +126,25 @@ func (evt *FetchEvent) Get(key string) goja.Value {
 		return evt.requestProxy.nativeReq
 
 	default:
+		if v, ok := evt.extensions.Get(key); ok {
+			return v
+		}
 		return evt.nativeEvtInstance.Get(key)
 	}
 }
 
 func (evt *FetchEvent) Set(key string, val goja.Value) bool {
-	return false
+	switch key {
+	case "locals":
+		evt.locals.Replace(evt.httpReq, val)
+		return true
+	default:
+		return false
+	}
 }
 
 func (evt *FetchEvent) Has(key string) bool {
-	for _, k := range eventProperties {
+	for _, k := range evt.keys {
 		if k == key {
 			return true
 		}
@@ -140,7 +157,7 @@ func (evt *FetchEvent) Delete(key string) bool {
 }
 
 func (evt *FetchEvent) Keys() []string {
-	return eventProperties
+	return evt.keys
 }
 
 func (evt *FetchEvent) WithHttp(w http.ResponseWriter, r *http.Request, next http.Handler) *FetchEvent {
@@ -151,8 +168,12 @@ func (evt *FetchEvent) WithHttp(w http.ResponseWriter, r *http.Request, next htt
 	return evt
 }
 
-func (evt *FetchEvent) EnableFetch() {
-	evt.hasFetch = true
+// WithExtensions exposes the enabled extensions as properties of the event
+func (evt *FetchEvent) WithExtensions(enabled []common.Extension) *FetchEvent {
+	evt.extensions.Use(evt.ioContext, enabled)
+	evt.keys = append(evt.keys, evt.extensions.Names()...)
+
+	return evt
 }
 
 func (evt *FetchEvent) respondWith(fc goja.FunctionCall, vm *goja.Runtime) goja.Value {
@@ -225,6 +246,10 @@ func (evt *FetchEvent) Wait() {
 }
 
 func (evt *FetchEvent) wake() {
+	if evt.signalStop != nil {
+		// handler concluded, client disconnect is no longer relevant
+		evt.signalStop()
+	}
 	evt.requestDone <- struct{}{}
 }
 
@@ -244,14 +269,13 @@ func (evt *FetchEvent) Exception(err error) {
 	if evt.responseSent {
 		return
 	}
+	evt.responseSent = true
 	select {
 	case <-evt.httpReq.Context().Done():
+		evt.wake()
 	default:
-		evt.httpResp.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(evt.httpResp, "Unexpected runtime exception: %+v", err)
+		evt.deps.Errors.Report(evt.httpResp, evt.httpReq, "Unexpected runtime exception", err, evt.wake)
 	}
-	evt.responseSent = true
-	evt.wake()
 }
 
 func (evt *FetchEvent) getNativeResponseResolver() goja.Value {
@@ -275,43 +299,48 @@ func (evt *FetchEvent) getNativeResponseResolver() goja.Value {
 			respStatus                 = nativeResp.Get("status")
 			respHeaders                = nativeResp.Get("headers")
 			respBody                   = nativeResp.Get("body")
-			bodyType                   = respBody.ExportType()
 			status      int64          = respStatus.ToInteger()
 			headers     map[string]any = respHeaders.Export().(map[string]any)
-			useBody     io.Reader      = nil
 		)
 
-		if goja.IsUndefined(respBody) || goja.IsNull(respBody) {
-			// no body
-			useBody = http.NoBody
-		} else if bodyType.Kind() == reflect.String {
-			strBuf := pool.NewBufferString(respBody.String())
-			evt.ioContext.RegisterCleanup(strBuf.Reset)
-			useBody = strBuf
-		} else {
-			// possibly wrapped ReadableStream
-			reader, ok := stream.AssertReader(respBody, evt.vm)
-			if !ok {
-				panic(evt.vm.NewGoError(fetch.ErrUnsupportedReadableStream))
+		if status == http.StatusSwitchingProtocols {
+			if socket, ok := websocket.AssertSocket(nativeResp.Get("webSocket"), evt.vm); ok {
+				go func() {
+					respHeader := make(http.Header)
+					shared.CopyHeaders(respHeader, headers)
+
+					evt.responseSent = true
+					err := socket.Serve(w, r, respHeader)
+					if err != nil && !errors.Is(err, websocket.ErrNotUpgrade) {
+						evt.deps.Logger.Error("Error upgrading to WebSocket", zap.Error(err))
+					}
+					evt.responseDone <- struct{}{}
+				}()
+				return
 			}
-			useBody = reader
 		}
 
+		useBody, _, err := evt.bodyReader(respBody)
+		if err != nil {
+			panic(evt.vm.NewGoError(err))
+		}
+
+		flush := nativeResp.Get("flush").ToBoolean()
+
 		go func() {
-			for k, v := range headers {
-				if s, ok := v.(string); ok {
-					w.Header().Set(k, s)
-				} else {
-					w.Header().Set(k, fmt.Sprintf("%s", v))
-				}
-			}
+			shared.CopyHeaders(w.Header(), headers)
 
 			buf := shared.GetBuffer()
 			defer shared.PutBuffer(buf)
 
 			evt.responseSent = true
 			w.WriteHeader(int(status))
-			_, err := io.CopyBuffer(w, useBody, buf)
+
+			var dst io.Writer = w
+			if flush || shared.IsEventStream(w.Header()) {
+				dst = shared.NewFlushWriter(w)
+			}
+			_, err := io.CopyBuffer(dst, useBody, buf)
 			if err != nil {
 				evt.deps.Logger.Error("Error writing response", zap.Error(err))
 			}
@@ -324,25 +353,71 @@ func (evt *FetchEvent) getNativeResponseRejector() goja.Value {
 		// NOTE: in the nested response resolver/rejector from .respondWith, we do not .wake()
 		// to unblock the http request in progress. Resolution should be done by the outer request resolver
 
-		v := fc.Argument(0)
-		w.WriteHeader(http.StatusInternalServerError)
-		if goja.IsUndefined(v) {
-			return
-		}
-		fmt.Fprintf(w, "Execution exception: %+v", v)
 		evt.responseSent = true
-		evt.responseDone <- struct{}{}
+		evt.deps.Errors.Report(w, r, "Execution exception", errorpage.NewScriptError(evt.vm, fc.Argument(0)), func() {
+			evt.responseDone <- struct{}{}
+		})
 	})
 }
 
+// bodyReader converts a body flattened by the fetch helpers to an io.Reader.
+// length is -1 if the body is a stream.
+func (evt *FetchEvent) bodyReader(body goja.Value) (io.Reader, int64, error) {
+	if goja.IsUndefined(body) || goja.IsNull(body) {
+		// no body
+		return http.NoBody, 0, nil
+	}
+
+	if body.ExportType().Kind() == reflect.String {
+		strBuf := pool.NewBufferString(body.String())
+		evt.ioContext.RegisterCleanup(strBuf.Reset)
+		return strBuf, int64(strBuf.Len()), nil
+	}
+
+	if b, ok := blob.AssertBytes(body, evt.vm); ok {
+		// ArrayBuffer is a copy owned by the Request/Response
+		return bytes.NewReader(b), int64(len(b)), nil
+	}
+
+	// wrapped or JavaScript ReadableStream
+	reader, ok, err := evt.deps.Stream.NewReaderVM(evt.ioContext, body, evt.vm)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !ok {
+		return nil, 0, fetch.ErrUnsupportedReadableStream
+	}
+	return reader, -1, nil
+}
+
 func (evt *FetchEvent) getNativeRequestResolver() goja.Value {
 	return evt.nativeFunctionWrapper(func(w http.ResponseWriter, r *http.Request, _ goja.FunctionCall) {
+		if !evt.skipNext && evt.nextRecorder == nil {
+			if evt.passThroughReq != nil {
+				// .passThrough was called with a modified request
+				r = evt.passThroughReq
+			} else if evt.requestProxy != nil {
+				r = evt.requestProxy.incomingRequest(r)
+			}
+			// locals have to be exported on the loop
+			r = evt.locals.Conclude(r)
+		}
+
 		go func() {
 			defer evt.wake()
 
+			if evt.nextRecorder != nil {
+				// the response of .next() holds the IOContext
+				<-evt.nextRecorder.settled
+			}
+
 			if evt.skipNext {
 				// .respondWith was used
 				<-evt.responseDone
+			} else if evt.nextRecorder != nil {
+				// .next() was used without .respondWith
+				evt.responseSent = true
+				evt.sendNext(w)
 			} else {
 				// fallthrough, .respondWith did not call
 				evt.responseSent = true
@@ -354,24 +429,28 @@ func (evt *FetchEvent) getNativeRequestResolver() goja.Value {
 
 func (evt *FetchEvent) getNativeRequestRejector() goja.Value {
 	return evt.nativeFunctionWrapper(func(w http.ResponseWriter, r *http.Request, fc goja.FunctionCall) {
-		v := fc.Argument(0)
+		scriptErr := errorpage.NewScriptError(evt.vm, fc.Argument(0))
 
 		go func() {
 			defer evt.wake()
 
+			if evt.nextRecorder != nil {
+				// the response of .next() holds the IOContext
+				<-evt.nextRecorder.settled
+			}
+
 			if evt.skipNext {
 				// .respondWith was used, but exception thrown
 				<-evt.responseDone
 			}
 
 			if evt.responseSent {
-				evt.deps.Logger.Warn("Handler thrown exception after response was sent", zap.String("exception", v.String()))
+				evt.deps.Errors.Log(r, "Handler thrown exception after response was sent", scriptErr)
 				return
 			}
 
 			evt.responseSent = true
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Execution exception: %+v", v)
+			evt.deps.Errors.Respond(w, r, "Execution exception", scriptErr)
 		}()
 	})
 }
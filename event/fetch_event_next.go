@@ -0,0 +1,94 @@
+package event
+
+import (
+	"io"
+	"net/http"
+
+	"go.miragespace.co/heresy/extensions/common/shared"
+
+	"github.com/dop251/goja"
+	"go.uber.org/zap"
+)
+
+// implement FetchEvent.next([input [, init]]), which runs the next handler and
+// resolves to its Response. Arguments are the same as passThrough. If the handler
+// does not call respondWith, the response is sent to the client unmodified.
+func (evt *FetchEvent) next(fc goja.FunctionCall, vm *goja.Runtime) goja.Value {
+	if evt.useRespondWith {
+		panic(vm.NewTypeError("next: respondWith already called"))
+	}
+	if evt.nextRecorder != nil {
+		panic(vm.NewTypeError("next: already called"))
+	}
+
+	r := evt.httpReq
+	if !goja.IsUndefined(fc.Argument(0)) {
+		result, err := evt.deps.Fetch.GetRequestHelper()(goja.Undefined(), fc.Arguments...)
+		if err != nil {
+			panic(err)
+		}
+		r, err = evt.newPassThroughRequest(result.ToObject(vm))
+		if err != nil {
+			panic(vm.NewTypeError("next: %s", err.Error()))
+		}
+	} else if evt.passThroughReq != nil {
+		r = evt.passThroughReq
+	} else if evt.requestProxy != nil {
+		r = evt.requestProxy.incomingRequest(r)
+	}
+	// locals have to be exported on the loop
+	r = evt.locals.Conclude(r)
+
+	promise, resolve, reject := vm.NewPromise()
+
+	rec := newResponseRecorder()
+	evt.nextRecorder = rec
+
+	go rec.serve(evt.httpNext, r)
+	go func() {
+		<-rec.ready
+		evt.deps.Eventloop.RunOnLoop(func(vm *goja.Runtime) {
+			defer close(rec.settled)
+
+			if rec.err != nil {
+				reject(vm.NewGoError(rec.err))
+				return
+			}
+
+			result := evt.deps.Stream.GetResponseProxy(evt.ioContext)
+			result.WithResponse(evt.ioContext, vm, rec.response())
+			// cleanup is invoked in reverse, unblock the handler before the body is drained
+			evt.ioContext.RegisterCleanup(rec.discard)
+
+			resp, err := evt.deps.Fetch.GetResultHelper()(goja.Undefined(), result.NativeObject())
+			if err != nil {
+				reject(vm.NewGoError(err))
+				return
+			}
+			resolve(resp)
+		})
+	}()
+
+	return vm.ToValue(promise)
+}
+
+// sendNext writes the response captured by .next() as-is
+func (evt *FetchEvent) sendNext(w http.ResponseWriter) {
+	rec := evt.nextRecorder
+	if rec.err != nil {
+		evt.deps.Errors.Respond(w, evt.httpReq, "Execution exception", rec.err)
+		return
+	}
+
+	buf := shared.GetBuffer()
+	defer shared.PutBuffer(buf)
+
+	header := w.Header()
+	for k, v := range rec.snapshot {
+		header[k] = v
+	}
+	w.WriteHeader(rec.statusCode)
+	if _, err := io.CopyBuffer(w, rec.pr, buf); err != nil {
+		evt.deps.Logger.Error("Error writing response", zap.Error(err))
+	}
+}
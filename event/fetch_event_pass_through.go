@@ -0,0 +1,93 @@
+package event
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"go.miragespace.co/heresy/extensions/common/shared"
+
+	"github.com/dop251/goja"
+)
+
+// implement FetchEvent.passThrough([input [, init]]), where input and init are the
+// same as the Request constructor. The next handler will be called with the
+// resulting request instead of the original one once the handler returns.
+func (evt *FetchEvent) passThrough(fc goja.FunctionCall, vm *goja.Runtime) goja.Value {
+	if evt.useRespondWith {
+		panic(vm.NewTypeError("passThrough: respondWith already called"))
+	}
+	if evt.nextRecorder != nil {
+		panic(vm.NewTypeError("passThrough: next already called"))
+	}
+
+	if goja.IsUndefined(fc.Argument(0)) {
+		evt.passThroughReq = nil
+		return goja.Undefined()
+	}
+
+	result, err := evt.deps.Fetch.GetRequestHelper()(goja.Undefined(), fc.Arguments...)
+	if err != nil {
+		panic(err)
+	}
+
+	req, err := evt.newPassThroughRequest(result.ToObject(vm))
+	if err != nil {
+		panic(vm.NewTypeError("passThrough: %s", err.Error()))
+	}
+	evt.passThroughReq = req
+
+	return goja.Undefined()
+}
+
+func (evt *FetchEvent) newPassThroughRequest(nativeReq *goja.Object) (*http.Request, error) {
+	var (
+		reqURL                    = nativeReq.Get("url")
+		reqMethod                 = nativeReq.Get("method")
+		reqHeaders                = nativeReq.Get("headers")
+		reqBody                   = nativeReq.Get("body")
+		headers    map[string]any = reqHeaders.Export().(map[string]any)
+	)
+
+	u, err := url.Parse(reqURL.String())
+	if err != nil {
+		return nil, err
+	}
+
+	r := evt.httpReq.Clone(evt.httpReq.Context())
+	r.Method = reqMethod.String()
+	r.URL = evt.httpReq.URL.ResolveReference(u)
+	if r.URL.Host != "" {
+		r.Host = r.URL.Host
+	}
+	// server requests only carry the path and query
+	r.URL.Scheme = ""
+	r.URL.Host = ""
+	r.RequestURI = r.URL.RequestURI()
+
+	r.Header = make(http.Header, len(headers))
+	shared.CopyHeaders(r.Header, headers)
+	if host := r.Header.Get("host"); host != "" {
+		r.Host = host
+		r.Header.Del("host")
+	}
+
+	body, length, err := evt.bodyReader(reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if rc, ok := body.(io.ReadCloser); ok {
+		r.Body = rc
+	} else {
+		r.Body = io.NopCloser(body)
+	}
+	r.ContentLength = length
+	if length > 0 {
+		r.Header.Set("content-length", strconv.FormatInt(length, 10))
+	} else {
+		r.Header.Del("content-length")
+	}
+
+	return r, nil
+}
@@ -3,10 +3,12 @@ package event
 import (
 	"expvar"
 
+	"go.miragespace.co/heresy/extensions/abort"
 	"go.miragespace.co/heresy/extensions/common"
 	"go.miragespace.co/heresy/extensions/common/x"
+	"go.miragespace.co/heresy/extensions/errorpage"
 	"go.miragespace.co/heresy/extensions/fetch"
-	"go.miragespace.co/heresy/extensions/kv"
+	"go.miragespace.co/heresy/extensions/form"
 	"go.miragespace.co/heresy/extensions/promise"
 	"go.miragespace.co/heresy/extensions/stream"
 	"go.miragespace.co/heresy/polyfill"
@@ -26,9 +28,11 @@ type FetchEventDeps struct {
 	Symbols   *polyfill.RuntimeSymbols
 	Eventloop *eventloop.EventLoop
 	Stream    *stream.StreamController
+	Abort     *abort.AbortController
 	Resolver  *promise.PromiseResolver
 	Fetch     *fetch.Fetch
-	KV        *kv.KVManager
+	Form      *form.FormParser
+	Errors    *errorpage.Reporter
 }
 
 type FetchEventPool struct {
@@ -2,9 +2,11 @@ package event
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 
 	"go.miragespace.co/heresy/extensions/common/shared"
+	"go.miragespace.co/heresy/extensions/stream"
 
 	"github.com/dop251/goja"
 )
@@ -15,13 +17,14 @@ type fetchEventRequest struct {
 	nativeBody            goja.Value
 	nativeReq             *goja.Object
 	nativeRequestInstance *goja.Object
+	nativeFormData        goja.Value
 	nativeProperties      map[string]goja.Value
 	bodyConsumed          bool
 }
 
 var _ goja.DynamicObject = (*fetchEventRequest)(nil)
 
-var requestProperties = []string{"body", "bodyUsed", "headers", "method", "url"}
+var requestProperties = []string{"body", "bodyUsed", "headers", "method", "signal", "url"}
 
 func newFetchEventRequest(evt *FetchEvent) *fetchEventRequest {
 	req := &fetchEventRequest{
@@ -56,6 +59,26 @@ func (req *fetchEventRequest) reset() {
 	}
 }
 
+// incomingRequest returns r with the body read from the request body stream, if the
+// stream was exposed to the script. After request.clone(), the stream reads from
+// a branch of a tee instead of r.Body.
+func (req *fetchEventRequest) incomingRequest(r *http.Request) *http.Request {
+	if goja.IsNull(req.nativeBody) {
+		return r
+	}
+	body, ok := stream.AssertReader(req.nativeBody, req.vm)
+	if !ok || body == r.Body {
+		return r
+	}
+	r = r.WithContext(r.Context())
+	if rc, ok := body.(io.ReadCloser); ok {
+		r.Body = rc
+	} else {
+		r.Body = io.NopCloser(body)
+	}
+	return r
+}
+
 func makeUrl(r *http.Request) string {
 	scheme := "http"
 	if r.TLS == nil {
@@ -86,6 +109,17 @@ func (req *fetchEventRequest) Get(key string) goja.Value {
 			req.initializeBody()
 		}
 		return req.nativeBody
+	case "formData":
+		if req.nativeFormData == nil {
+			req.nativeFormData = req.vm.ToValue(req.formData)
+		}
+		return req.nativeFormData
+
+	case "signal":
+		if req.nativeProperties[key] == nil {
+			req.nativeProperties[key], req.signalStop = req.deps.Abort.NewSignalVM(req.httpReq.Context(), req.vm)
+		}
+		return req.nativeProperties[key]
 
 	case "headers":
 		if req.headersProxy == nil {
@@ -99,6 +133,27 @@ func (req *fetchEventRequest) Get(key string) goja.Value {
 	}
 }
 
+// formData parses the body in Go as it is read, unless the body was already
+// exposed to the script as a stream
+func (req *fetchEventRequest) formData(fc goja.FunctionCall) goja.Value {
+	if req.bodyConsumed || !goja.IsNull(req.nativeBody) {
+		fn, _ := goja.AssertFunction(req.nativeRequestInstance.Get("formData"))
+		ret, err := fn(req.nativeReq)
+		if err != nil {
+			panic(err)
+		}
+		return ret
+	}
+	req.bodyConsumed = true
+
+	var body io.Reader = req.httpReq.Body
+	switch req.httpReq.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		body = http.NoBody
+	}
+	return req.deps.Form.NewFormDataVM(req.ioContext, req.vm, req.httpReq.Header.Get("content-type"), body)
+}
+
 func (req *fetchEventRequest) Set(key string, val goja.Value) bool {
 	switch key {
 	case "_consumed":
@@ -0,0 +1,99 @@
+package event
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+var errResponseDiscarded = fmt.Errorf("response of the next handler was discarded")
+
+// responseRecorder captures the response of the next handler for FetchEvent.next().
+// Header and status are available once ready is closed, while the body is
+// streamed through a pipe as it is written.
+type responseRecorder struct {
+	header      http.Header
+	snapshot    http.Header
+	statusCode  int
+	wroteHeader bool
+	err         error
+	once        sync.Once
+	ready       chan struct{}
+	settled     chan struct{}
+	pr          *io.PipeReader
+	pw          *io.PipeWriter
+}
+
+var _ http.ResponseWriter = (*responseRecorder)(nil)
+var _ http.Flusher = (*responseRecorder)(nil)
+
+func newResponseRecorder() *responseRecorder {
+	pr, pw := io.Pipe()
+	return &responseRecorder{
+		header:  make(http.Header),
+		ready:   make(chan struct{}),
+		settled: make(chan struct{}),
+		pr:      pr,
+		pw:      pw,
+	}
+}
+
+func (rec *responseRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *responseRecorder) WriteHeader(code int) {
+	rec.once.Do(func() {
+		rec.statusCode = code
+		rec.wroteHeader = true
+		// handler may still modify the header map after WriteHeader
+		rec.snapshot = rec.header.Clone()
+		close(rec.ready)
+	})
+}
+
+func (rec *responseRecorder) Write(p []byte) (int, error) {
+	if !rec.wroteHeader && rec.header.Get("content-type") == "" {
+		// same as net/http when WriteHeader was not called
+		rec.header.Set("content-type", http.DetectContentType(p))
+	}
+	rec.WriteHeader(http.StatusOK)
+	return rec.pw.Write(p)
+}
+
+// Flush is a no-op, the pipe is not buffered
+func (rec *responseRecorder) Flush() {}
+
+// serve runs the handler, and closes the body when the handler returns
+func (rec *responseRecorder) serve(h http.Handler, r *http.Request) {
+	defer func() {
+		if p := recover(); p != nil {
+			err := fmt.Errorf("next handler panicked: %v", p)
+			rec.once.Do(func() {
+				rec.err = err
+				close(rec.ready)
+			})
+			rec.pw.CloseWithError(err)
+			return
+		}
+		rec.WriteHeader(http.StatusOK)
+		rec.pw.Close()
+	}()
+
+	h.ServeHTTP(rec, r)
+}
+
+// discard unblocks the handler if the body was not consumed
+func (rec *responseRecorder) discard() {
+	rec.pr.CloseWithError(errResponseDiscarded)
+}
+
+func (rec *responseRecorder) response() *http.Response {
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", rec.statusCode, http.StatusText(rec.statusCode)),
+		StatusCode: rec.statusCode,
+		Header:     rec.snapshot,
+		Body:       rec.pr,
+	}
+}
@@ -0,0 +1,467 @@
+package express
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"go.miragespace.co/heresy/extensions/common"
+	"go.miragespace.co/heresy/extensions/errorpage"
+
+	"github.com/dop251/goja"
+)
+
+const defaultBodyLimit = 100 << 10 // 100kb, same as body-parser
+
+type bodyParserKind int
+
+const (
+	bodyParserJSON bodyParserKind = iota
+	bodyParserURLEncoded
+	bodyParserText
+	bodyParserRaw
+)
+
+var bodyParserNames = map[string]bodyParserKind{
+	"json":       bodyParserJSON,
+	"urlencoded": bodyParserURLEncoded,
+	"text":       bodyParserText,
+	"raw":        bodyParserRaw,
+}
+
+var bodyParserDefaultTypes = map[bodyParserKind]string{
+	bodyParserJSON:       "application/json",
+	bodyParserURLEncoded: "application/x-www-form-urlencoded",
+	bodyParserText:       "text/plain",
+	bodyParserRaw:        "application/octet-stream",
+}
+
+type bodyParser struct {
+	kind     bodyParserKind
+	limit    int64
+	types    []string
+	strict   bool
+	extended bool
+}
+
+// BodyParsers populate req.body of Express.js, configured by the bodyParser
+// option of registerExpressHandler:
+//
+//	registerExpressHandler(handler, {
+//	    bodyParser: {
+//	        json: { limit: "1mb", type: ["json", "+json"], strict: true },
+//	        urlencoded: { extended: true },
+//	        text: true,
+//	        raw: { type: "application/*" },
+//	    },
+//	})
+//
+// The first parser matching the Content-Type reads the body. Bodies are read
+// and parsed off the event loop.
+type BodyParsers []bodyParser
+
+// NewBodyParsers compiles the bodyParser option, or returns nil if it is
+// missing
+func NewBodyParsers(options common.HandlerOptions) (BodyParsers, error) {
+	opt, ok := options["bodyParser"]
+	if !ok || opt == nil {
+		return nil, nil
+	}
+	config, ok := opt.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("bodyParser: expecting an object")
+	}
+
+	var parsers BodyParsers
+	// keep a stable order, as map iteration is random
+	for _, name := range []string{"json", "urlencoded", "text", "raw"} {
+		v, ok := config[name]
+		if !ok || v == nil || v == false {
+			continue
+		}
+		p := bodyParser{
+			kind:     bodyParserNames[name],
+			limit:    defaultBodyLimit,
+			types:    []string{bodyParserDefaultTypes[bodyParserNames[name]]},
+			strict:   true,
+			extended: true,
+		}
+		if v != true {
+			o, ok := v.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("bodyParser.%s: expecting a boolean or an object", name)
+			}
+			if err := p.configure(o); err != nil {
+				return nil, fmt.Errorf("bodyParser.%s: %w", name, err)
+			}
+		}
+		parsers = append(parsers, p)
+	}
+	for name := range config {
+		if _, ok := bodyParserNames[name]; !ok {
+			return nil, fmt.Errorf("bodyParser: unknown parser %q", name)
+		}
+	}
+
+	return parsers, nil
+}
+
+func (p *bodyParser) configure(o map[string]any) (err error) {
+	if v, ok := o["limit"]; ok {
+		if p.limit, err = parseByteSize(v); err != nil {
+			return err
+		}
+	}
+	switch v := o["type"].(type) {
+	case nil:
+	case string:
+		p.types = []string{v}
+	case []any:
+		p.types = p.types[:0]
+		for _, t := range v {
+			s, ok := t.(string)
+			if !ok {
+				return fmt.Errorf("type: expecting a string or an array of strings")
+			}
+			p.types = append(p.types, s)
+		}
+	default:
+		return fmt.Errorf("type: expecting a string or an array of strings")
+	}
+	if v, ok := o["strict"].(bool); ok {
+		p.strict = v
+	}
+	if v, ok := o["extended"].(bool); ok {
+		p.extended = v
+	}
+	return nil
+}
+
+var byteUnits = map[string]int64{
+	"b":  1,
+	"kb": 1 << 10,
+	"mb": 1 << 20,
+	"gb": 1 << 30,
+}
+
+// parseByteSize parses a limit of body-parser, such as 1024 or "100kb"
+func parseByteSize(v any) (int64, error) {
+	switch n := v.(type) {
+	case int64:
+		return n, nil
+	case float64:
+		return int64(n), nil
+	case string:
+		s := strings.ToLower(strings.TrimSpace(n))
+		unit := strings.TrimLeft(s, "0123456789.")
+		num, err := strconv.ParseFloat(strings.TrimSpace(s[:len(s)-len(unit)]), 64)
+		if err != nil {
+			return 0, fmt.Errorf("limit: invalid size %q", n)
+		}
+		unit = strings.TrimSpace(unit)
+		if unit == "" {
+			unit = "b"
+		}
+		mul, ok := byteUnits[unit]
+		if !ok {
+			return 0, fmt.Errorf("limit: invalid unit in %q", n)
+		}
+		return int64(num * float64(mul)), nil
+	}
+	return 0, fmt.Errorf("limit: expecting a number or a string")
+}
+
+// ParsedBody is req.body, converted to a JavaScript value on the loop
+type ParsedBody struct {
+	kind  bodyParserKind
+	value any
+}
+
+// Parse reads the body of r with the first matching parser. It returns nil
+// if no parser matches, then the body is left unread. Errors are
+// *errorpage.HTTPError with the status to respond with.
+func (parsers BodyParsers) Parse(r *http.Request) (*ParsedBody, error) {
+	if len(r.TransferEncoding) == 0 && r.ContentLength <= 0 && r.Header.Get("Content-Length") == "" {
+		return nil, nil
+	}
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil
+	}
+
+	for _, p := range parsers {
+		if !p.match(mediaType) {
+			continue
+		}
+		body, err := p.read(r, params["charset"])
+		if err != nil {
+			return nil, err
+		}
+		value, err := p.parse(body)
+		if err != nil {
+			return nil, err
+		}
+		return &ParsedBody{kind: p.kind, value: value}, nil
+	}
+	return nil, nil
+}
+
+func (p *bodyParser) match(mediaType string) bool {
+	for _, t := range p.types {
+		if expected := normalizeType(t); expected != "" && mimeMatch(expected, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+func bodyError(status int, typ string, format string, args ...any) error {
+	return &errorpage.HTTPError{
+		Status: status,
+		Type:   typ,
+		Err:    fmt.Errorf(format, args...),
+	}
+}
+
+// bodyErrorVM returns the error of reading the body with status, statusCode,
+// type and expose set, as the errors of body-parser
+func (ctx *RequestContext) bodyErrorVM(bodyErr error) *goja.Object {
+	err := ctx.vm.NewGoError(bodyErr)
+	var httpErr *errorpage.HTTPError
+	if errors.As(bodyErr, &httpErr) {
+		err.Set("status", httpErr.Status)
+		err.Set("statusCode", httpErr.Status)
+		err.Set("type", httpErr.Type)
+		err.Set("expose", httpErr.Status < http.StatusInternalServerError)
+	}
+	return err
+}
+
+func (p *bodyParser) read(r *http.Request, charset string) ([]byte, error) {
+	charset = strings.ToLower(charset)
+	switch {
+	case p.kind == bodyParserRaw:
+	case charset == "", charset == "utf-8", charset == "utf8", charset == "us-ascii":
+	default:
+		return nil, bodyError(http.StatusUnsupportedMediaType, "charset.unsupported",
+			"unsupported charset %q", strings.ToUpper(charset))
+	}
+
+	if r.ContentLength > p.limit && r.Header.Get("Content-Encoding") == "" {
+		return nil, bodyError(http.StatusRequestEntityTooLarge, "entity.too.large", "request entity too large")
+	}
+
+	var (
+		body    io.Reader = r.Body
+		decoder io.ReadCloser
+		err     error
+	)
+	switch encoding := strings.ToLower(r.Header.Get("Content-Encoding")); encoding {
+	case "", "identity":
+	case "gzip":
+		decoder, err = gzip.NewReader(r.Body)
+	case "deflate":
+		decoder, err = newDeflateReader(r.Body)
+	default:
+		return nil, bodyError(http.StatusUnsupportedMediaType, "encoding.unsupported",
+			"unsupported content encoding %q", encoding)
+	}
+	if err != nil {
+		return nil, bodyError(http.StatusBadRequest, "request.aborted", "invalid content encoding: %w", err)
+	}
+	if decoder != nil {
+		defer decoder.Close()
+		body = decoder
+	}
+
+	b, err := io.ReadAll(io.LimitReader(body, p.limit+1))
+	if err != nil {
+		if errors.Is(err, gzip.ErrHeader) || errors.Is(err, gzip.ErrChecksum) || errors.Is(err, zlib.ErrChecksum) {
+			return nil, bodyError(http.StatusBadRequest, "request.aborted", "invalid content encoding: %w", err)
+		}
+		return nil, bodyError(http.StatusBadRequest, "request.aborted", "request aborted: %w", err)
+	}
+	if int64(len(b)) > p.limit {
+		return nil, bodyError(http.StatusRequestEntityTooLarge, "entity.too.large", "request entity too large")
+	}
+	return b, nil
+}
+
+// deflate is zlib-wrapped, but raw deflate is also seen in the wild
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	buf := make([]byte, 2)
+	n, _ := io.ReadFull(r, buf)
+	buf = buf[:n]
+	rest := io.MultiReader(bytes.NewReader(buf), r)
+	if n == 2 && (uint16(buf[0])<<8|uint16(buf[1]))%31 == 0 && buf[0]&0x0f == 8 {
+		return zlib.NewReader(rest)
+	}
+	return flate.NewReader(rest), nil
+}
+
+func (p *bodyParser) parse(body []byte) (any, error) {
+	switch p.kind {
+	case bodyParserJSON:
+		trimmed := bytes.TrimLeft(body, " \t\n\r")
+		if len(trimmed) == 0 {
+			return map[string]any{}, nil
+		}
+		if p.strict && trimmed[0] != '{' && trimmed[0] != '[' {
+			return nil, bodyError(http.StatusBadRequest, "entity.parse.failed",
+				"Unexpected token %c in JSON at position %d", trimmed[0], len(body)-len(trimmed))
+		}
+		v, err := decodeJSON(body)
+		if err != nil {
+			return nil, bodyError(http.StatusBadRequest, "entity.parse.failed", "invalid JSON: %w", err)
+		}
+		return v, nil
+	case bodyParserURLEncoded:
+		if p.extended {
+			return parseQuery(string(body)), nil
+		}
+		return parseSimpleQuery(string(body)), nil
+	case bodyParserText:
+		if !utf8.Valid(body) {
+			return nil, bodyError(http.StatusBadRequest, "entity.parse.failed", "invalid UTF-8 in body")
+		}
+		return string(body), nil
+	default:
+		return body, nil
+	}
+}
+
+// parseSimpleQuery implements the non-extended parser (querystring), where
+// repeated keys become arrays and brackets have no meaning
+func parseSimpleQuery(rawQuery string) *queryObject {
+	root := newQueryObject()
+	pairs := strings.Split(rawQuery, "&")
+	if len(pairs) > queryParamLimit {
+		pairs = pairs[:queryParamLimit]
+	}
+	for _, pair := range pairs {
+		if pair == "" {
+			continue
+		}
+		key, val, _ := strings.Cut(pair, "=")
+		key = decodeQueryComponent(key)
+		val = decodeQueryComponent(val)
+		switch existing := root.values[key].(type) {
+		case nil:
+			root.set(key, val)
+		case string:
+			root.set(key, queryArray{existing, val})
+		case queryArray:
+			root.set(key, append(existing, val))
+		}
+	}
+	return root
+}
+
+// toValue must be called on the loop
+func (b *ParsedBody) toValue(vm *goja.Runtime) goja.Value {
+	switch b.kind {
+	case bodyParserJSON:
+		return jsonToValue(vm, b.value)
+	case bodyParserURLEncoded:
+		return queryToValue(vm, b.value)
+	case bodyParserText:
+		return vm.ToValue(b.value)
+	default:
+		return newUint8Array(vm, b.value.([]byte))
+	}
+}
+
+func newUint8Array(vm *goja.Runtime, b []byte) goja.Value {
+	ctor, ok := goja.AssertConstructor(vm.Get("Uint8Array"))
+	if !ok {
+		panic(vm.NewTypeError("Uint8Array is not a constructor"))
+	}
+	arr, err := ctor(nil, vm.ToValue(vm.NewArrayBuffer(b)))
+	if err != nil {
+		panic(err)
+	}
+	return arr
+}
+
+// decodeJSON keeps the order of keys, as JSON.parse does
+func decodeJSON(body []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	v, err := decodeJSONValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after top-level value")
+	}
+	return v, nil
+}
+
+func decodeJSONValue(dec *json.Decoder) (any, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t {
+	case json.Delim('{'):
+		obj := newQueryObject()
+		for dec.More() {
+			k, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj.set(k.(string), v)
+		}
+		_, err = dec.Token()
+		return obj, err
+	case json.Delim('['):
+		arr := []any{}
+		for dec.More() {
+			v, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		_, err = dec.Token()
+		return arr, err
+	}
+	return t, nil
+}
+
+// jsonToValue converts a value of decodeJSON. Keys are defined as own
+// properties like JSON.parse does, so "__proto__" does not replace the
+// prototype.
+func jsonToValue(vm *goja.Runtime, val any) goja.Value {
+	switch v := val.(type) {
+	case nil:
+		return goja.Null()
+	case *queryObject:
+		obj := vm.NewObject()
+		for _, k := range v.keys {
+			obj.DefineDataProperty(k, jsonToValue(vm, v.values[k]), goja.FLAG_TRUE, goja.FLAG_TRUE, goja.FLAG_TRUE)
+		}
+		return obj
+	case []any:
+		items := make([]any, 0, len(v))
+		for _, e := range v {
+			items = append(items, jsonToValue(vm, e))
+		}
+		return vm.NewArray(items...)
+	default:
+		return vm.ToValue(v)
+	}
+}
@@ -0,0 +1,213 @@
+package express
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.miragespace.co/heresy/extensions/common"
+	"go.miragespace.co/heresy/extensions/errorpage"
+
+	"github.com/dop251/goja"
+)
+
+func newTestBodyParsers(t *testing.T, config map[string]any) BodyParsers {
+	t.Helper()
+	parsers, err := NewBodyParsers(common.HandlerOptions{"bodyParser": config})
+	if err != nil {
+		t.Fatalf("NewBodyParsers: %v", err)
+	}
+	return parsers
+}
+
+func newBodyRequest(contentType string, body []byte) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	return r
+}
+
+// parseBody parses the body of r, and returns req.body as JSON
+func parseBody(t *testing.T, parsers BodyParsers, r *http.Request) (string, error) {
+	t.Helper()
+	parsed, err := parsers.Parse(r)
+	if err != nil || parsed == nil {
+		return "", err
+	}
+	vm := goja.New()
+	return stringify(t, vm, parsed.toValue(vm)), nil
+}
+
+func expectBodyError(t *testing.T, err error, status int, typ string) {
+	t.Helper()
+	var httpErr *errorpage.HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("expected an HTTPError, got %v", err)
+	}
+	if httpErr.Status != status || httpErr.Type != typ {
+		t.Fatalf("expected %d %s, got %d %s", status, typ, httpErr.Status, httpErr.Type)
+	}
+}
+
+func TestNewBodyParsers(t *testing.T) {
+	if parsers, err := NewBodyParsers(common.HandlerOptions{}); parsers != nil || err != nil {
+		t.Fatalf("expected no parsers without the option, got %v, %v", parsers, err)
+	}
+	if _, err := NewBodyParsers(common.HandlerOptions{"bodyParser": map[string]any{"xml": true}}); err == nil {
+		t.Fatalf("expected an error for an unknown parser")
+	}
+	if _, err := NewBodyParsers(common.HandlerOptions{"bodyParser": map[string]any{"json": map[string]any{"limit": "1tb"}}}); err == nil {
+		t.Fatalf("expected an error for an invalid limit")
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	for _, tc := range []struct {
+		v    any
+		want int64
+	}{
+		{int64(1024), 1024},
+		{float64(10), 10},
+		{"100kb", 100 << 10},
+		{"1.5 MB", 3 << 19},
+		{"512", 512},
+	} {
+		got, err := parseByteSize(tc.v)
+		if err != nil || got != tc.want {
+			t.Errorf("parseByteSize(%v) = %d, %v, want %d", tc.v, got, err, tc.want)
+		}
+	}
+	for _, v := range []any{"kb", "10xb", true} {
+		if _, err := parseByteSize(v); err == nil {
+			t.Errorf("parseByteSize(%v): expected an error", v)
+		}
+	}
+}
+
+func TestBodyParserJSON(t *testing.T) {
+	parsers := newTestBodyParsers(t, map[string]any{"json": true})
+
+	got, err := parseBody(t, parsers, newBodyRequest("application/json; charset=utf-8", []byte(`{"b":1,"a":[true,null,"x"]}`)))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if want := `{"b":1,"a":[true,null,"x"]}`; got != want {
+		t.Fatalf("body = %s, want %s", got, want)
+	}
+
+	_, err = parseBody(t, parsers, newBodyRequest("application/json", []byte(`"string"`)))
+	expectBodyError(t, err, http.StatusBadRequest, "entity.parse.failed")
+
+	_, err = parseBody(t, parsers, newBodyRequest("application/json", []byte(`{"a":`)))
+	expectBodyError(t, err, http.StatusBadRequest, "entity.parse.failed")
+
+	_, err = parseBody(t, parsers, newBodyRequest("application/json; charset=latin1", []byte(`{}`)))
+	expectBodyError(t, err, http.StatusUnsupportedMediaType, "charset.unsupported")
+}
+
+func TestBodyParserJSONProto(t *testing.T) {
+	parsers := newTestBodyParsers(t, map[string]any{"json": true})
+	parsed, err := parsers.Parse(newBodyRequest("application/json", []byte(`{"__proto__":{"polluted":true}}`)))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	vm := goja.New()
+	vm.Set("body", parsed.toValue(vm))
+	ok, err := vm.RunString(`Object.getPrototypeOf(body) === Object.prototype &&
+		Object.keys(body).length === 1 && body.polluted === undefined`)
+	if err != nil {
+		t.Fatalf("RunString: %v", err)
+	}
+	if !ok.ToBoolean() {
+		t.Fatalf("__proto__ of the body replaced the prototype")
+	}
+}
+
+func TestBodyParserURLEncoded(t *testing.T) {
+	for _, tc := range []struct {
+		extended bool
+		want     string
+	}{
+		{true, `{"a":{"b":"1"},"c":["2","3"]}`},
+		{false, `{"a[b]":"1","c":["2","3"]}`},
+	} {
+		parsers := newTestBodyParsers(t, map[string]any{"urlencoded": map[string]any{"extended": tc.extended}})
+		got, err := parseBody(t, parsers, newBodyRequest("application/x-www-form-urlencoded", []byte("a[b]=1&c=2&c=3")))
+		if err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+		if got != tc.want {
+			t.Errorf("extended %v: body = %s, want %s", tc.extended, got, tc.want)
+		}
+	}
+}
+
+func TestBodyParserMatch(t *testing.T) {
+	parsers := newTestBodyParsers(t, map[string]any{
+		"json": map[string]any{"type": []any{"json", "+json"}},
+		"text": true,
+	})
+
+	got, err := parseBody(t, parsers, newBodyRequest("application/vnd.api+json", []byte(`{"a":1}`)))
+	if err != nil || got != `{"a":1}` {
+		t.Fatalf("+json: body = %s, %v", got, err)
+	}
+	got, err = parseBody(t, parsers, newBodyRequest("text/plain", []byte("hello")))
+	if err != nil || got != `"hello"` {
+		t.Fatalf("text: body = %s, %v", got, err)
+	}
+
+	parsed, err := parsers.Parse(newBodyRequest("application/octet-stream", []byte("x")))
+	if parsed != nil || err != nil {
+		t.Fatalf("expected no parser to match, got %v, %v", parsed, err)
+	}
+}
+
+func TestBodyParserLimit(t *testing.T) {
+	parsers := newTestBodyParsers(t, map[string]any{"text": map[string]any{"limit": "1kb"}})
+
+	_, err := parseBody(t, parsers, newBodyRequest("text/plain", bytes.Repeat([]byte("a"), 2<<10)))
+	expectBodyError(t, err, http.StatusRequestEntityTooLarge, "entity.too.large")
+
+	// the limit applies to the decoded body
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(bytes.Repeat([]byte("a"), 2<<10))
+	gz.Close()
+	r := newBodyRequest("text/plain", compressed.Bytes())
+	r.Header.Set("Content-Encoding", "gzip")
+	_, err = parseBody(t, parsers, r)
+	expectBodyError(t, err, http.StatusRequestEntityTooLarge, "entity.too.large")
+}
+
+func TestBodyParserEncoding(t *testing.T) {
+	parsers := newTestBodyParsers(t, map[string]any{"text": true})
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte("hello"))
+	gz.Close()
+	r := newBodyRequest("text/plain", compressed.Bytes())
+	r.Header.Set("Content-Encoding", "gzip")
+	got, err := parseBody(t, parsers, r)
+	if err != nil || got != `"hello"` {
+		t.Fatalf("gzip: body = %s, %v", got, err)
+	}
+
+	r = newBodyRequest("text/plain", []byte("hello"))
+	r.Header.Set("Content-Encoding", "br")
+	_, err = parseBody(t, parsers, r)
+	expectBodyError(t, err, http.StatusUnsupportedMediaType, "encoding.unsupported")
+
+	r = newBodyRequest("text/plain", []byte("not gzip"))
+	r.Header.Set("Content-Encoding", "gzip")
+	_, err = parseBody(t, parsers, r)
+	expectBodyError(t, err, http.StatusBadRequest, "request.aborted")
+
+	_, err = parseBody(t, parsers, newBodyRequest("text/plain", []byte(strings.Repeat("\xff", 4))))
+	expectBodyError(t, err, http.StatusBadRequest, "entity.parse.failed")
+}
@@ -0,0 +1,111 @@
+package express
+
+import (
+	"io"
+	"sync"
+)
+
+// highWaterMark is the size of queued chunks above which res.write() returns
+// false, the same as the default of Node.js streams
+const highWaterMark = 16 << 10
+
+// chunkWriter writes the chunks of res.write() to w on its own goroutine, so
+// a slow client does not block the loop. Chunks are queued without a limit,
+// and scripts are expected to wait for res.drain() when write returns false.
+type chunkWriter struct {
+	mu      sync.Mutex
+	cond    sync.Cond
+	w       io.Writer
+	chunks  [][]byte
+	queued  int
+	closed  bool
+	err     error
+	onDrain func()
+	done    chan struct{}
+}
+
+// newChunkWriter starts writing to w. onDrain is invoked off the loop every
+// time the queued chunks are written.
+func newChunkWriter(w io.Writer, onDrain func()) *chunkWriter {
+	c := &chunkWriter{
+		w:       w,
+		onDrain: onDrain,
+		done:    make(chan struct{}),
+	}
+	c.cond.L = &c.mu
+	go c.run()
+	return c
+}
+
+// write queues chunk, and returns false if the queued chunks exceed
+// highWaterMark, or writing to the client has failed
+func (c *chunkWriter) write(chunk []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return false
+	}
+	if len(chunk) == 0 {
+		return c.queued < highWaterMark
+	}
+	c.chunks = append(c.chunks, chunk)
+	c.queued += len(chunk)
+	c.cond.Signal()
+	return c.queued < highWaterMark
+}
+
+// drained reports whether the queued chunks are written
+func (c *chunkWriter) drained() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.queued == 0 || c.err != nil
+}
+
+// close ends the body once the queued chunks are written
+func (c *chunkWriter) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	c.cond.Signal()
+}
+
+func (c *chunkWriter) run() {
+	defer close(c.done)
+
+	for {
+		c.mu.Lock()
+		for len(c.chunks) == 0 && !c.closed {
+			c.cond.Wait()
+		}
+		if len(c.chunks) == 0 {
+			c.mu.Unlock()
+			return
+		}
+		chunk := c.chunks[0]
+		c.chunks[0] = nil
+		c.chunks = c.chunks[1:]
+		failed := c.err != nil
+		c.mu.Unlock()
+
+		var err error
+		if !failed {
+			// the rest of the queue is discarded after an error
+			_, err = c.w.Write(chunk)
+		}
+
+		c.mu.Lock()
+		if err != nil && c.err == nil {
+			c.err = err
+		}
+		c.queued -= len(chunk)
+		drained := c.queued == 0
+		c.mu.Unlock()
+
+		if drained {
+			c.onDrain()
+		}
+	}
+}
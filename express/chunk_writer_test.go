@@ -0,0 +1,120 @@
+package express
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingWriter holds every Write until release is closed
+type blockingWriter struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	release chan struct{}
+	err     error
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return 0, w.err
+	}
+	return w.buf.Write(p)
+}
+
+func (w *blockingWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+func waitDone(t *testing.T, c *chunkWriter) {
+	t.Helper()
+	select {
+	case <-c.done:
+	case <-time.After(time.Second):
+		t.Fatalf("chunkWriter did not finish")
+	}
+}
+
+func TestChunkWriterWritesInOrder(t *testing.T) {
+	w := &blockingWriter{release: make(chan struct{})}
+	close(w.release)
+	c := newChunkWriter(w, func() {})
+
+	for _, chunk := range []string{"a", "b", "", "c"} {
+		if !c.write([]byte(chunk)) {
+			t.Fatalf("write(%q) = false below highWaterMark", chunk)
+		}
+	}
+	c.close()
+	waitDone(t, c)
+
+	if got := w.String(); got != "abc" {
+		t.Fatalf("written %q, want %q", got, "abc")
+	}
+	if !c.drained() {
+		t.Fatalf("expected drained after close")
+	}
+}
+
+func TestChunkWriterHighWaterMark(t *testing.T) {
+	w := &blockingWriter{release: make(chan struct{})}
+	drained := make(chan struct{}, 1)
+	c := newChunkWriter(w, func() {
+		select {
+		case drained <- struct{}{}:
+		default:
+		}
+	})
+
+	if !c.write(make([]byte, highWaterMark-1)) {
+		t.Fatalf("write below highWaterMark returned false")
+	}
+	if c.write([]byte("x")) {
+		t.Fatalf("write reaching highWaterMark returned true")
+	}
+	if c.drained() {
+		t.Fatalf("drained while the client is blocked")
+	}
+	// an empty write reports the state without queueing
+	if c.write(nil) {
+		t.Fatalf("empty write returned true above highWaterMark")
+	}
+
+	close(w.release)
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatalf("onDrain was not invoked")
+	}
+	if !c.drained() || !c.write(nil) {
+		t.Fatalf("expected drained once the queue is written")
+	}
+	c.close()
+	waitDone(t, c)
+	if got := len(w.String()); got != highWaterMark {
+		t.Fatalf("written %d bytes, want %d", got, highWaterMark)
+	}
+}
+
+func TestChunkWriterError(t *testing.T) {
+	w := &blockingWriter{release: make(chan struct{}), err: errors.New("client gone")}
+	close(w.release)
+	c := newChunkWriter(w, func() {})
+
+	c.write([]byte("a"))
+	c.close()
+	waitDone(t, c)
+
+	if c.write([]byte("b")) {
+		t.Fatalf("write after an error returned true")
+	}
+	if !c.drained() {
+		t.Fatalf("a failed writer must report drained, so res.drain() settles")
+	}
+}
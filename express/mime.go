@@ -0,0 +1,56 @@
+package express
+
+import (
+	"mime"
+	"strings"
+)
+
+// common types are looked up first, as the system table may be incomplete
+var mimeTypes = map[string]string{
+	"bin":  "application/octet-stream",
+	"css":  "text/css",
+	"csv":  "text/csv",
+	"gif":  "image/gif",
+	"htm":  "text/html",
+	"html": "text/html",
+	"ico":  "image/x-icon",
+	"jpeg": "image/jpeg",
+	"jpg":  "image/jpeg",
+	"js":   "application/javascript",
+	"json": "application/json",
+	"map":  "application/json",
+	"md":   "text/markdown",
+	"mjs":  "application/javascript",
+	"mp4":  "video/mp4",
+	"pdf":  "application/pdf",
+	"png":  "image/png",
+	"svg":  "image/svg+xml",
+	"text": "text/plain",
+	"txt":  "text/plain",
+	"wasm": "application/wasm",
+	"webp": "image/webp",
+	"woff": "font/woff",
+	"xml":  "application/xml",
+	"zip":  "application/zip",
+}
+
+// lookupMime resolves an extension or a file name ("json", ".html",
+// "index.html") into a MIME type without parameters. A type containing "/"
+// is returned as-is. It returns "" if the type is unknown.
+func lookupMime(typ string) string {
+	if strings.Contains(typ, "/") {
+		return typ
+	}
+	ext := strings.ToLower(typ)
+	if i := strings.LastIndexByte(ext, '.'); i >= 0 {
+		ext = ext[i+1:]
+	}
+	if t, ok := mimeTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension("." + ext); t != "" {
+		t, _, _ = strings.Cut(t, ";")
+		return strings.TrimSpace(t)
+	}
+	return ""
+}
@@ -1,51 +1,64 @@
 package express
 
 import (
-	"fmt"
 	"net/http"
 
 	"go.miragespace.co/heresy/extensions/common"
-	"go.miragespace.co/heresy/extensions/kv"
+	"go.miragespace.co/heresy/extensions/errorpage"
 
 	"github.com/dop251/goja"
 )
 
 type RequestContext struct {
-	httpReq       *http.Request
-	httpResp      http.ResponseWriter
-	httpNext      http.Handler
-	ioContext     *common.IOContext
-	responseProxy *contextResponse
-	requestProxy  *contextRequest
-	kvMapper      *kv.KVMapper
-	nativeFetch   goja.Value
-	nativeResolve goja.Value
-	nativeReject  goja.Value
-	nativeNext    goja.Value
-	requestDone   chan struct{}
-	deps          RequestContextDeps
-	vm            *goja.Runtime
-	nativeCtx     *goja.Object
-	hasFetch      bool
-	nextInvoked   bool
-	responseSent  bool
+	httpReq        *http.Request
+	httpResp       http.ResponseWriter
+	httpNext       http.Handler
+	ioContext      *common.IOContext
+	responseProxy  *contextResponse
+	requestProxy   *contextRequest
+	extensions     *common.ExtensionHost
+	locals         *common.RequestLocals
+	parsedBody     *ParsedBody
+	bodyError      error
+	router         *Router
+	nativeResolve  goja.Value
+	nativeReject   goja.Value
+	nativeNext     goja.Value
+	layerNext      goja.Value // next of the handler of the router running
+	nextResult     goja.Value
+	writerDone     chan struct{}
+	nativeDispatch goja.Value
+	signalStop     func()
+	requestDone    chan struct{}
+	deps           RequestContextDeps
+	vm             *goja.Runtime
+	nativeCtx      *goja.Object
+	keys           []string
+	nextInvoked    bool
+	responseSent   bool
+	bodyConsumed   bool
+	bodyParsed     bool
 
 	statusSet bool
 }
 
 var _ goja.DynamicObject = (*RequestContext)(nil)
 
-var contextProperties = []string{"kv", "req", "res"}
+var contextProperties = []string{"locals", "req", "res"}
 
 func newRequestContext(vm *goja.Runtime, deps RequestContextDeps) *RequestContext {
 	ctx := &RequestContext{
 		requestDone: make(chan struct{}, 1),
+		extensions:  common.NewExtensionHost(vm, deps.Eventloop),
+		locals:      common.NewRequestLocals(vm),
+		keys:        append([]string{}, contextProperties...),
 		deps:        deps,
 		vm:          vm,
 	}
 
 	ctx.nativeResolve = ctx.getNativeContextResolver()
 	ctx.nativeReject = ctx.getNativeContextRejector()
+	ctx.nativeDispatch = ctx.getNativeDispatcher()
 	ctx.nativeCtx = vm.NewDynamicObject(ctx)
 
 	return ctx
@@ -55,10 +68,17 @@ func (ctx *RequestContext) reset() {
 	ctx.httpReq = nil
 	ctx.httpResp = nil
 	ctx.httpNext = nil
-	ctx.nativeFetch = nil
-	ctx.hasFetch = false
+	ctx.signalStop = nil
 	ctx.nextInvoked = false
+	ctx.nextResult = nil
+	ctx.writerDone = nil
 	ctx.responseSent = false
+	ctx.bodyConsumed = false
+	ctx.bodyParsed = false
+	ctx.parsedBody = nil
+	ctx.bodyError = nil
+	ctx.router = nil
+	ctx.layerNext = nil
 	ctx.statusSet = false
 	if ctx.responseProxy != nil {
 		ctx.responseProxy.reset()
@@ -66,9 +86,9 @@ func (ctx *RequestContext) reset() {
 	if ctx.requestProxy != nil {
 		ctx.requestProxy.reset()
 	}
-	if ctx.kvMapper != nil {
-		ctx.kvMapper.Reset()
-	}
+	ctx.extensions.Reset()
+	ctx.locals.Reset()
+	ctx.keys = ctx.keys[:len(contextProperties)]
 	ctx.ioContext = nil
 }
 
@@ -84,37 +104,33 @@ func (ctx *RequestContext) Get(key string) goja.Value {
 			ctx.requestProxy = newContextRequest(ctx)
 		}
 		return ctx.requestProxy.nativeReq
+	case "locals":
+		return ctx.locals.NativeObject(ctx.httpReq)
 	case "next":
 		if ctx.nativeNext == nil {
 			ctx.nativeNext = ctx.vm.ToValue(ctx.next)
 		}
 		return ctx.nativeNext
-	case "kv":
-		if ctx.kvMapper == nil {
-			ctx.kvMapper = ctx.deps.KV.GetKVMapper(ctx.vm, ctx.deps.Eventloop)
-		}
-		ctx.kvMapper.WithIOContext(ctx.ioContext)
-		return ctx.kvMapper.NativeObject()
-	case "fetch":
-		if ctx.hasFetch {
-			if ctx.nativeFetch == nil {
-				fetcher := ctx.deps.Fetch.NewNativeFetchVM(ctx.ioContext, ctx.vm)
-				ctx.nativeFetch = fetcher.NativeFunc()
-			}
-			return ctx.nativeFetch
-		}
-		return goja.Undefined()
 	default:
+		if v, ok := ctx.extensions.Get(key); ok {
+			return v
+		}
 		return goja.Undefined()
 	}
 }
 
-func (ctx *RequestContext) Set(_ string, _ goja.Value) bool {
-	return false
+func (ctx *RequestContext) Set(key string, val goja.Value) bool {
+	switch key {
+	case "locals":
+		ctx.locals.Replace(ctx.httpReq, val)
+		return true
+	default:
+		return false
+	}
 }
 
 func (ctx *RequestContext) Has(key string) bool {
-	for _, k := range contextProperties {
+	for _, k := range ctx.keys {
 		if k == key {
 			return true
 		}
@@ -127,7 +143,7 @@ func (ctx *RequestContext) Delete(key string) bool {
 }
 
 func (ctx *RequestContext) Keys() []string {
-	return contextProperties
+	return ctx.keys
 }
 
 func (ctx *RequestContext) WithHttp(w http.ResponseWriter, r *http.Request, next http.Handler) *RequestContext {
@@ -138,19 +154,64 @@ func (ctx *RequestContext) WithHttp(w http.ResponseWriter, r *http.Request, next
 	return ctx
 }
 
-func (ctx *RequestContext) EnableFetch() {
-	ctx.hasFetch = true
+// WithExtensions exposes the enabled extensions as properties of the context
+func (ctx *RequestContext) WithExtensions(enabled []common.Extension) *RequestContext {
+	ctx.extensions.Use(ctx.ioContext, enabled)
+	ctx.keys = append(ctx.keys, ctx.extensions.Names()...)
+
+	return ctx
 }
 
+// ParseBody populates req.body with the first matching parser, if any. It
+// reads the body, so it must be called off the loop before the handler is
+// invoked. Errors carry the status to respond with. With a router, the
+// error is passed to its error handlers in place of the ordinary handlers.
+func (ctx *RequestContext) ParseBody(parsers BodyParsers) error {
+	if parsers == nil {
+		return nil
+	}
+	ctx.bodyParsed = true
+
+	body, err := parsers.Parse(ctx.httpReq)
+	if err != nil {
+		ctx.bodyError = err
+		ctx.bodyConsumed = true
+		return err
+	}
+	if body != nil {
+		ctx.parsedBody = body
+		ctx.bodyConsumed = true
+	}
+	return nil
+}
+
+// next runs the next handler on its own goroutine, so a slow handler does
+// not block the loop. The returned Promise resolves when it completes, and
+// the request is concluded only after that.
 func (ctx *RequestContext) next(fc goja.FunctionCall) goja.Value {
 	if ctx.nextInvoked {
-		return goja.Undefined()
+		return ctx.nextResult
 	}
 	ctx.nextInvoked = true
 	ctx.responseSent = true
 
-	ctx.httpNext.ServeHTTP(ctx.httpResp, ctx.httpReq)
-	return goja.Undefined()
+	promise, resolve, _ := ctx.vm.NewPromise()
+	ctx.nextResult = ctx.vm.ToValue(promise)
+
+	// locals have to be exported on the loop
+	w, r := ctx.httpResp, ctx.locals.Conclude(ctx.httpReq)
+	done := make(chan struct{})
+	ctx.writerDone = done
+
+	go func() {
+		ctx.httpNext.ServeHTTP(w, r)
+		close(done)
+		ctx.deps.Eventloop.RunOnLoop(func(vm *goja.Runtime) {
+			resolve(goja.Undefined())
+		})
+	}()
+
+	return ctx.nextResult
 }
 
 func (ctx *RequestContext) Wait() {
@@ -173,8 +234,7 @@ func (ctx *RequestContext) Exception(err error) {
 	select {
 	case <-ctx.httpReq.Context().Done():
 	default:
-		ctx.httpResp.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(ctx.httpResp, "Unexpected runtime exception: %+v", err)
+		ctx.deps.Errors.Respond(ctx.httpResp, ctx.httpReq, "Unexpected runtime exception", err)
 	}
 	ctx.responseSent = true
 	ctx.wake()
@@ -190,12 +250,22 @@ func (ctx *RequestContext) getNativeContextResolver() goja.Value {
 }
 
 func (ctx *RequestContext) getNativeContextRejector() goja.Value {
-	return ctx.nativeContextWrapper(func(w http.ResponseWriter, r *http.Request, v goja.Value) {
-		w.WriteHeader(http.StatusInternalServerError)
-		if goja.IsUndefined(v) {
-			return
+	return ctx.vm.ToValue(func(fc goja.FunctionCall) goja.Value {
+		scriptErr := errorpage.NewScriptError(ctx.vm, fc.Argument(0))
+		if ctx.nextInvoked || ctx.responseSent {
+			ctx.deps.Errors.Log(ctx.httpReq, "Handler thrown exception after response was sent", scriptErr)
+			ctx.wake()
+			return goja.Undefined()
+		}
+		ctx.responseSent = true
+		select {
+		case <-ctx.httpReq.Context().Done():
+			ctx.wake()
+		default:
+			// the error page may be rendered by the script, wake after it is written
+			ctx.deps.Errors.Report(ctx.httpResp, ctx.httpReq, "Execution exception", scriptErr, ctx.wake)
 		}
-		fmt.Fprintf(w, "Execution exception: %+v", v)
+		return goja.Undefined()
 	})
 }
 
@@ -220,5 +290,21 @@ func (ctx *RequestContext) nativeContextWrapper(
 }
 
 func (ctx *RequestContext) wake() {
+	if ctx.signalStop != nil {
+		// handler concluded, client disconnect is no longer relevant
+		ctx.signalStop()
+	}
+	if res := ctx.responseProxy; res != nil && res.bodyWriter != nil {
+		// the body of res.write() ends when the handler concludes
+		res.bodyWriter.close()
+	}
+	if done := ctx.writerDone; done != nil {
+		// the next handler or a stream may still be writing the response
+		go func() {
+			<-done
+			ctx.requestDone <- struct{}{}
+		}()
+		return
+	}
 	ctx.requestDone <- struct{}{}
 }
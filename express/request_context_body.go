@@ -0,0 +1,96 @@
+package express
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/dop251/goja"
+)
+
+// implement Request.stream(), which returns the body as a ReadableStream
+// backed by the request body in Go. It can be passed as the body of fetch()
+// without copying it through JavaScript. It is null for GET, HEAD and
+// OPTIONS requests, as Request.body of the Fetch API.
+func (req *contextRequest) stream(fc goja.FunctionCall) goja.Value {
+	if req.nativeBody != nil {
+		return req.nativeBody
+	}
+	if req.bodyConsumed {
+		panic(req.vm.NewTypeError("stream: body was already read"))
+	}
+
+	switch req.httpReq.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return goja.Null()
+	}
+
+	req.bodyConsumed = true
+	readable := req.deps.Stream.NewReadableStreamVM(req.ioContext, req.httpReq.Body, req.vm)
+	req.nativeBody = readable.NativeStream()
+	return req.nativeBody
+}
+
+// implement Request.text() of the Fetch API
+func (req *contextRequest) text(fc goja.FunctionCall) goja.Value {
+	return req.readBody("text", func(b []byte) (goja.Value, error) {
+		return req.vm.ToValue(string(b)), nil
+	})
+}
+
+// implement Request.json() of the Fetch API. Keys keep their order, the
+// same as req.body parsed by the JSON parser.
+func (req *contextRequest) json(fc goja.FunctionCall) goja.Value {
+	return req.readBody("json", func(b []byte) (goja.Value, error) {
+		v, err := decodeJSON(b)
+		if err != nil {
+			return nil, err
+		}
+		return jsonToValue(req.vm, v), nil
+	})
+}
+
+// implement Request.arrayBuffer() of the Fetch API
+func (req *contextRequest) arrayBuffer(fc goja.FunctionCall) goja.Value {
+	return req.readBody("arrayBuffer", func(b []byte) (goja.Value, error) {
+		return req.vm.ToValue(req.vm.NewArrayBuffer(b)), nil
+	})
+}
+
+// readBody reads the body off the loop, and resolves with the value
+// returned by convert on the loop. Bodies larger than the default limit of
+// body-parser are rejected with 413, req.stream() reads larger ones.
+func (req *contextRequest) readBody(method string, convert func(b []byte) (goja.Value, error)) goja.Value {
+	promise, resolve, reject := req.vm.NewPromise()
+	if req.bodyConsumed {
+		reject(req.vm.NewTypeError(method + ": body was already read"))
+		return req.vm.ToValue(promise)
+	}
+	req.bodyConsumed = true
+
+	r := req.httpReq
+	go func() {
+		var (
+			b   []byte
+			err error
+		)
+		if r.ContentLength > defaultBodyLimit {
+			err = bodyError(http.StatusRequestEntityTooLarge, "entity.too.large", "request entity too large")
+		} else if b, err = io.ReadAll(io.LimitReader(r.Body, defaultBodyLimit+1)); err == nil && len(b) > defaultBodyLimit {
+			err = bodyError(http.StatusRequestEntityTooLarge, "entity.too.large", "request entity too large")
+		}
+		req.deps.Eventloop.RunOnLoop(func(vm *goja.Runtime) {
+			if err != nil {
+				reject(req.bodyErrorVM(err))
+				return
+			}
+			v, err := convert(b)
+			if err != nil {
+				reject(vm.NewGoError(err))
+				return
+			}
+			resolve(v)
+		})
+	}()
+
+	return req.vm.ToValue(promise)
+}
@@ -0,0 +1,270 @@
+package express
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// CookieSigner signs cookies the same way as cookie-signature of Express.js,
+// so cookies signed by an existing Express.js app remain valid
+type CookieSigner struct {
+	secrets [][]byte
+}
+
+// NewCookieSigner signs with the first secret, and verifies with any of
+// them, so secrets can be rotated
+func NewCookieSigner(secrets ...string) (*CookieSigner, error) {
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("cookie secret cannot be empty")
+	}
+	s := &CookieSigner{}
+	for _, secret := range secrets {
+		if secret == "" {
+			return nil, fmt.Errorf("cookie secret cannot be empty")
+		}
+		s.secrets = append(s.secrets, []byte(secret))
+	}
+	return s, nil
+}
+
+func cookieMAC(secret []byte, value string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// Sign returns "s:<value>.<signature>"
+func (s *CookieSigner) Sign(value string) string {
+	return "s:" + value + "." + base64.RawStdEncoding.EncodeToString(cookieMAC(s.secrets[0], value))
+}
+
+// Unsign verifies a value returned by Sign
+func (s *CookieSigner) Unsign(signed string) (string, bool) {
+	signed, ok := strings.CutPrefix(signed, "s:")
+	if !ok {
+		return "", false
+	}
+	dot := strings.LastIndexByte(signed, '.')
+	if dot < 0 {
+		return "", false
+	}
+	value := signed[:dot]
+	signature, err := base64.RawStdEncoding.DecodeString(signed[dot+1:])
+	if err != nil {
+		return "", false
+	}
+	for _, secret := range s.secrets {
+		if hmac.Equal(signature, cookieMAC(secret, value)) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// encodeURIComponent is the default encoder of res.cookie()
+func encodeURIComponent(s string) string {
+	const upperhex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			strings.IndexByte("-_.!~*'()", c) >= 0:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(upperhex[c>>4])
+			b.WriteByte(upperhex[c&15])
+		}
+	}
+	return b.String()
+}
+
+// parseCookies implements Request.cookies and Request.signedCookies of
+// Express.js with cookie-parser. The first cookie of the same name wins.
+// Signed cookies are verified and left out of cookies, and their value is
+// false if the signature is invalid.
+func (req *contextRequest) parseCookies() {
+	cookies := req.vm.NewObject()
+	signedCookies := req.vm.NewObject()
+	req.nativeReqProperties["cookies"] = cookies
+	req.nativeReqProperties["signedCookies"] = signedCookies
+
+	seen := map[string]bool{}
+	for _, c := range req.httpReq.Cookies() {
+		if seen[c.Name] {
+			continue
+		}
+		seen[c.Name] = true
+		value := c.Value
+		if v, err := url.PathUnescape(value); err == nil {
+			value = v
+		}
+
+		if req.deps.Cookies != nil && strings.HasPrefix(value, "s:") {
+			if unsigned, ok := req.deps.Cookies.Unsign(value); ok {
+				signedCookies.Set(c.Name, req.cookieValue(unsigned))
+			} else {
+				signedCookies.Set(c.Name, false)
+			}
+			continue
+		}
+		cookies.Set(c.Name, req.cookieValue(value))
+	}
+}
+
+// cookieValue parses JSON cookies ("j:" prefix) set by res.cookie() with an object
+func (req *contextRequest) cookieValue(value string) goja.Value {
+	if raw, ok := strings.CutPrefix(value, "j:"); ok {
+		if v, err := decodeJSON([]byte(raw)); err == nil {
+			return jsonToValue(req.vm, v)
+		}
+	}
+	return req.vm.ToValue(value)
+}
+
+// implement Response.cookie(name, value [, options]) of Express.js (chainable)
+func (res *contextResponse) cookie(fc goja.FunctionCall) goja.Value {
+	if res.responseSent {
+		panic(res.vm.NewTypeError("response already sent"))
+	}
+
+	name := fc.Argument(0)
+	if goja.IsUndefined(name) {
+		panic(res.vm.NewTypeError("invalid undefined argument"))
+	}
+
+	val := fc.Argument(1)
+	var value string
+	if obj, ok := val.(*goja.Object); ok {
+		b, err := obj.MarshalJSON()
+		if err != nil {
+			panic(res.vm.NewGoError(err))
+		}
+		value = "j:" + string(b)
+	} else {
+		value = val.String()
+	}
+
+	c := &http.Cookie{
+		Name: name.String(),
+		Path: "/",
+	}
+	signed := res.cookieOptions(c, fc.Argument(2))
+	if signed {
+		if res.deps.Cookies == nil {
+			panic(res.vm.NewTypeError("res.cookie: a cookie secret is required for signed cookies"))
+		}
+		value = res.deps.Cookies.Sign(value)
+	}
+	c.Value = encodeURIComponent(value)
+
+	res.appendCookie(c)
+	return res.nativeRes
+}
+
+// implement Response.clearCookie(name [, options]) of Express.js (chainable)
+func (res *contextResponse) clearCookie(fc goja.FunctionCall) goja.Value {
+	if res.responseSent {
+		panic(res.vm.NewTypeError("response already sent"))
+	}
+
+	name := fc.Argument(0)
+	if goja.IsUndefined(name) {
+		panic(res.vm.NewTypeError("invalid undefined argument"))
+	}
+
+	c := &http.Cookie{
+		Name: name.String(),
+		Path: "/",
+	}
+	res.cookieOptions(c, fc.Argument(1))
+	c.Value = ""
+	c.MaxAge = 0
+	c.Expires = time.Unix(0, 0)
+
+	res.appendCookie(c)
+	return res.nativeRes
+}
+
+// cookieOptions applies the options of res.cookie(), and reports whether the
+// cookie should be signed
+func (res *contextResponse) cookieOptions(c *http.Cookie, options goja.Value) (signed bool) {
+	if goja.IsUndefined(options) || goja.IsNull(options) {
+		return false
+	}
+	opts := options.ToObject(res.vm)
+
+	get := func(key string) (goja.Value, bool) {
+		v := opts.Get(key)
+		return v, v != nil && !goja.IsUndefined(v) && !goja.IsNull(v)
+	}
+
+	if v, ok := get("path"); ok {
+		c.Path = v.String()
+	}
+	if v, ok := get("domain"); ok {
+		c.Domain = v.String()
+	}
+	if v, ok := get("httpOnly"); ok {
+		c.HttpOnly = v.ToBoolean()
+	}
+	if v, ok := get("secure"); ok {
+		c.Secure = v.ToBoolean()
+	}
+	if v, ok := get("expires"); ok {
+		t, ok := v.Export().(time.Time)
+		if !ok {
+			panic(res.vm.NewTypeError("res.cookie: expires must be a Date"))
+		}
+		c.Expires = t
+	}
+	if v, ok := get("maxAge"); ok {
+		maxAge := v.ToInteger()
+		c.Expires = time.Now().Add(time.Duration(maxAge) * time.Millisecond)
+		if seconds := maxAge / 1000; seconds > 0 {
+			c.MaxAge = int(seconds)
+		} else {
+			// Max-Age=0
+			c.MaxAge = -1
+		}
+	}
+	if v, ok := get("sameSite"); ok {
+		switch s := v.Export().(type) {
+		case bool:
+			if s {
+				c.SameSite = http.SameSiteStrictMode
+			}
+		case string:
+			switch strings.ToLower(s) {
+			case "strict":
+				c.SameSite = http.SameSiteStrictMode
+			case "lax":
+				c.SameSite = http.SameSiteLaxMode
+			case "none":
+				c.SameSite = http.SameSiteNoneMode
+			default:
+				panic(res.vm.NewTypeError("res.cookie: invalid sameSite " + s))
+			}
+		}
+	}
+	if v, ok := get("signed"); ok {
+		signed = v.ToBoolean()
+	}
+	return
+}
+
+func (res *contextResponse) appendCookie(c *http.Cookie) {
+	if err := c.Valid(); err != nil {
+		panic(res.vm.NewTypeError("res.cookie: " + err.Error()))
+	}
+	res.httpResp.Header().Add("Set-Cookie", c.String())
+}
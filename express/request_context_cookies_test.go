@@ -0,0 +1,80 @@
+package express
+
+import "testing"
+
+func TestCookieSignerSign(t *testing.T) {
+	s, err := NewCookieSigner("tobiiscool")
+	if err != nil {
+		t.Fatalf("NewCookieSigner: %v", err)
+	}
+	// signed by cookie-signature of Express.js
+	const signed = "s:hello.DGDUkGlIkCzPz+C0B064FNgHdEjox7ch8tOBGslZ5QI"
+	if got := s.Sign("hello"); got != signed {
+		t.Fatalf("Sign = %q, want %q", got, signed)
+	}
+	if value, ok := s.Unsign(signed); !ok || value != "hello" {
+		t.Fatalf("Unsign = %q, %v", value, ok)
+	}
+}
+
+func TestCookieSignerUnsign(t *testing.T) {
+	s, _ := NewCookieSigner("secret")
+	signed := s.Sign("a.b.c")
+	if value, ok := s.Unsign(signed); !ok || value != "a.b.c" {
+		t.Fatalf("Unsign(%q) = %q, %v", signed, value, ok)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"a.b.c",
+		signed[2:],
+		signed + "x",
+		"s:a.b.d" + signed[len("s:a.b.c"):],
+		"s:nodot",
+		"s:value.!!!",
+	} {
+		if value, ok := s.Unsign(invalid); ok {
+			t.Errorf("Unsign(%q) = %q, expected an invalid signature", invalid, value)
+		}
+	}
+
+	other, _ := NewCookieSigner("other")
+	if _, ok := other.Unsign(signed); ok {
+		t.Errorf("Unsign with another secret must fail")
+	}
+}
+
+func TestCookieSignerRotation(t *testing.T) {
+	old, _ := NewCookieSigner("old")
+	rotated, _ := NewCookieSigner("new", "old")
+
+	if value, ok := rotated.Unsign(old.Sign("v")); !ok || value != "v" {
+		t.Fatalf("cookies signed with an older secret must verify, got %q, %v", value, ok)
+	}
+	if _, ok := old.Unsign(rotated.Sign("v")); ok {
+		t.Fatalf("cookies must be signed with the first secret")
+	}
+
+	if _, err := NewCookieSigner(); err == nil {
+		t.Errorf("expected an error without secrets")
+	}
+	if _, err := NewCookieSigner("a", ""); err == nil {
+		t.Errorf("expected an error for an empty secret")
+	}
+}
+
+func TestEncodeURIComponent(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want string
+	}{
+		{"abc-_.!~*'()", "abc-_.!~*'()"},
+		{"a b;c=d", "a%20b%3Bc%3Dd"},
+		{"✓", "%E2%9C%93"},
+		{"s:v.sig+/=", "s%3Av.sig%2B%2F%3D"},
+	} {
+		if got := encodeURIComponent(tc.in); got != tc.want {
+			t.Errorf("encodeURIComponent(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package express
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// requestHeaders implements Request.headers of Express.js: header names in
+// lowercase, values joined with ", ". Writes go to the http.Header of the
+// request, so they are visible to the next handler.
+type requestHeaders struct {
+	header    http.Header
+	vm        *goja.Runtime
+	nativeObj *goja.Object
+	keys      []string
+}
+
+var _ goja.DynamicObject = (*requestHeaders)(nil)
+
+func newRequestHeaders(vm *goja.Runtime) *requestHeaders {
+	h := &requestHeaders{
+		vm:   vm,
+		keys: make([]string, 0, 8),
+	}
+	h.nativeObj = vm.NewDynamicObject(h)
+	return h
+}
+
+func (h *requestHeaders) useHeader(header http.Header) {
+	h.header = header
+	h.keys = h.keys[:0]
+	for k := range header {
+		h.keys = append(h.keys, strings.ToLower(k))
+	}
+	sort.Strings(h.keys)
+}
+
+func (h *requestHeaders) reset() {
+	h.header = nil
+	h.keys = h.keys[:0]
+}
+
+func (h *requestHeaders) Get(key string) goja.Value {
+	values := h.header.Values(key)
+	if len(values) == 0 {
+		return goja.Undefined()
+	}
+	if strings.EqualFold(key, "set-cookie") {
+		return h.vm.ToValue(values)
+	}
+	return h.vm.ToValue(strings.Join(values, ", "))
+}
+
+func (h *requestHeaders) Set(key string, val goja.Value) bool {
+	var values []string
+	if val.ExportType() != nil && val.ExportType().Kind() == reflect.Slice {
+		if err := h.vm.ExportTo(val, &values); err != nil {
+			return false
+		}
+	} else {
+		values = []string{val.String()}
+	}
+
+	h.header.Del(key)
+	for _, v := range values {
+		h.header.Add(key, v)
+	}
+
+	key = strings.ToLower(key)
+	if !h.Has(key) {
+		h.keys = append(h.keys, key)
+		sort.Strings(h.keys)
+	}
+	return true
+}
+
+func (h *requestHeaders) Has(key string) bool {
+	for _, k := range h.keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *requestHeaders) Delete(key string) bool {
+	h.header.Del(key)
+	key = strings.ToLower(key)
+	for i, k := range h.keys {
+		if k == key {
+			h.keys = append(h.keys[:i], h.keys[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+func (h *requestHeaders) Keys() []string {
+	return h.keys
+}
@@ -0,0 +1,404 @@
+package express
+
+import (
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// acceptSpec is an entry of Accept, Accept-Charset, Accept-Encoding or
+// Accept-Language
+type acceptSpec struct {
+	value  string
+	params map[string]string
+	q      float64
+	index  int
+}
+
+func parseAcceptHeader(header string) []acceptSpec {
+	var specs []acceptSpec
+	for i, entry := range strings.Split(header, ",") {
+		parts := strings.Split(entry, ";")
+		value := strings.TrimSpace(parts[0])
+		if value == "" {
+			continue
+		}
+		spec := acceptSpec{
+			value: value,
+			q:     1,
+			index: i,
+		}
+		for _, p := range parts[1:] {
+			k, v, _ := strings.Cut(p, "=")
+			k = strings.ToLower(strings.TrimSpace(k))
+			v = strings.Trim(strings.TrimSpace(v), `"`)
+			if k == "q" {
+				if q, err := strconv.ParseFloat(v, 64); err == nil {
+					spec.q = q
+				}
+				continue
+			}
+			if spec.params == nil {
+				spec.params = map[string]string{}
+			}
+			spec.params[k] = v
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// specMatcher reports the specificity of spec matching provided, or false
+type specMatcher func(spec acceptSpec, provided string) (int, bool)
+
+// negotiate returns the indexes of provided acceptable by specs, best first,
+// following the priorities of the negotiator package used by Express.js
+func negotiate(specs []acceptSpec, provided []string, match specMatcher) []int {
+	type priority struct {
+		index int
+		q     float64
+		s     int
+		o     int
+	}
+
+	var accepted []priority
+	for i, p := range provided {
+		best := priority{index: i, q: 0, s: -1, o: -1}
+		for _, spec := range specs {
+			s, ok := match(spec, p)
+			if !ok {
+				continue
+			}
+			if best.s < s || (best.s == s && best.q < spec.q) ||
+				(best.s == s && best.q == spec.q && best.o > spec.index) {
+				best.q, best.s, best.o = spec.q, s, spec.index
+			}
+		}
+		if best.s >= 0 && best.q > 0 {
+			accepted = append(accepted, best)
+		}
+	}
+
+	sort.SliceStable(accepted, func(i, j int) bool {
+		a, b := accepted[i], accepted[j]
+		if a.q != b.q {
+			return a.q > b.q
+		}
+		if a.s != b.s {
+			return a.s > b.s
+		}
+		if a.o != b.o {
+			return a.o < b.o
+		}
+		return a.index < b.index
+	})
+
+	indexes := make([]int, len(accepted))
+	for i, p := range accepted {
+		indexes[i] = p.index
+	}
+	return indexes
+}
+
+// acceptedValues lists the values of specs with q > 0, best first
+func acceptedValues(specs []acceptSpec) []any {
+	sorted := append([]acceptSpec{}, specs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].q > sorted[j].q
+	})
+	values := make([]any, 0, len(sorted))
+	for _, spec := range sorted {
+		if spec.q > 0 {
+			values = append(values, spec.value)
+		}
+	}
+	return values
+}
+
+func matchMediaType(spec acceptSpec, provided string) (int, bool) {
+	mediaType, params, err := mime.ParseMediaType(provided)
+	if err != nil {
+		return 0, false
+	}
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+	specType, specSubtype, _ := strings.Cut(strings.ToLower(spec.value), "/")
+
+	s := 0
+	if specType == typ {
+		s |= 4
+	} else if specType != "*" {
+		return 0, false
+	}
+	if specSubtype == subtype {
+		s |= 2
+	} else if specSubtype != "*" {
+		return 0, false
+	}
+	if len(spec.params) > 0 {
+		for k, v := range spec.params {
+			if !strings.EqualFold(params[k], v) {
+				return 0, false
+			}
+		}
+		s |= 1
+	}
+	return s, true
+}
+
+func matchToken(spec acceptSpec, provided string) (int, bool) {
+	if strings.EqualFold(spec.value, provided) {
+		return 1, true
+	}
+	return 0, spec.value == "*"
+}
+
+func matchLanguage(spec acceptSpec, provided string) (int, bool) {
+	specPrefix, _, _ := strings.Cut(spec.value, "-")
+	prefix, _, _ := strings.Cut(provided, "-")
+	switch {
+	case strings.EqualFold(spec.value, provided):
+		return 4, true
+	case strings.EqualFold(specPrefix, provided):
+		return 2, true
+	case strings.EqualFold(spec.value, prefix):
+		return 1, true
+	}
+	return 0, spec.value == "*"
+}
+
+// exportStrings flattens the arguments of accepts(...) and is(...), which
+// may be given as multiple strings or as an array
+func exportStrings(vm *goja.Runtime, args []goja.Value) []string {
+	var values []string
+	for _, arg := range args {
+		if goja.IsUndefined(arg) || goja.IsNull(arg) {
+			continue
+		}
+		var list []string
+		if obj, ok := arg.(*goja.Object); ok && obj.ClassName() == "Array" {
+			if err := vm.ExportTo(arg, &list); err != nil {
+				panic(vm.NewTypeError(err.Error()))
+			}
+			values = append(values, list...)
+			continue
+		}
+		values = append(values, arg.String())
+	}
+	return values
+}
+
+func acceptSpecs(r *http.Request) []acceptSpec {
+	header := r.Header.Get("Accept")
+	if header == "" {
+		header = "*/*"
+	}
+	return parseAcceptHeader(header)
+}
+
+// acceptsType returns the index of the best type for the Accept header of r,
+// or -1. Types can be extensions, such as "json".
+func acceptsType(r *http.Request, types []string) int {
+	mimes := make([]string, len(types))
+	for i, t := range types {
+		mimes[i] = lookupMime(t)
+	}
+	if best := negotiate(acceptSpecs(r), mimes, matchMediaType); len(best) > 0 {
+		return best[0]
+	}
+	return -1
+}
+
+// implement Request.accepts(types) of Express.js
+func (req *contextRequest) accepts(fc goja.FunctionCall) goja.Value {
+	types := exportStrings(req.vm, fc.Arguments)
+	if len(types) == 0 {
+		return req.vm.NewArray(acceptedValues(acceptSpecs(req.httpReq))...)
+	}
+
+	if best := acceptsType(req.httpReq, types); best >= 0 {
+		return req.vm.ToValue(types[best])
+	}
+	return req.vm.ToValue(false)
+}
+
+// implement Request.acceptsCharsets(charset [, ...]) of Express.js
+func (req *contextRequest) acceptsCharsets(fc goja.FunctionCall) goja.Value {
+	header := req.httpReq.Header.Get("Accept-Charset")
+	if header == "" {
+		header = "*"
+	}
+	return req.acceptsTokens(fc, parseAcceptHeader(header), matchToken)
+}
+
+// implement Request.acceptsEncodings(encoding [, ...]) of Express.js
+func (req *contextRequest) acceptsEncodings(fc goja.FunctionCall) goja.Value {
+	specs := parseAcceptHeader(req.httpReq.Header.Get("Accept-Encoding"))
+
+	// identity is acceptable unless refused explicitly
+	minQ := 1.0
+	identity := false
+	for _, spec := range specs {
+		if spec.q < minQ {
+			minQ = spec.q
+		}
+		if strings.EqualFold(spec.value, "identity") || spec.value == "*" {
+			identity = true
+		}
+	}
+	if !identity {
+		specs = append(specs, acceptSpec{value: "identity", q: minQ, index: len(specs)})
+	}
+
+	return req.acceptsTokens(fc, specs, matchToken)
+}
+
+// implement Request.acceptsLanguages(lang [, ...]) of Express.js
+func (req *contextRequest) acceptsLanguages(fc goja.FunctionCall) goja.Value {
+	header := req.httpReq.Header.Get("Accept-Language")
+	if header == "" {
+		header = "*"
+	}
+	return req.acceptsTokens(fc, parseAcceptHeader(header), matchLanguage)
+}
+
+func (req *contextRequest) acceptsTokens(fc goja.FunctionCall, specs []acceptSpec, match specMatcher) goja.Value {
+	provided := exportStrings(req.vm, fc.Arguments)
+	if len(provided) == 0 {
+		return req.vm.NewArray(acceptedValues(specs)...)
+	}
+	if best := negotiate(specs, provided, match); len(best) > 0 {
+		return req.vm.ToValue(provided[best[0]])
+	}
+	return req.vm.ToValue(false)
+}
+
+// implement Request.is(type) of Express.js: null without a body, the
+// matching type, or false
+func (req *contextRequest) is(fc goja.FunctionCall) goja.Value {
+	r := req.httpReq
+	if len(r.TransferEncoding) == 0 && r.ContentLength <= 0 && r.Header.Get("Content-Length") == "" {
+		return goja.Null()
+	}
+
+	actual, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return req.vm.ToValue(false)
+	}
+
+	types := exportStrings(req.vm, fc.Arguments)
+	if len(types) == 0 {
+		return req.vm.ToValue(actual)
+	}
+
+	for _, t := range types {
+		expected := normalizeType(t)
+		if expected == "" || !mimeMatch(expected, actual) {
+			continue
+		}
+		if strings.HasPrefix(t, "+") || strings.Contains(t, "*") {
+			return req.vm.ToValue(actual)
+		}
+		return req.vm.ToValue(t)
+	}
+	return req.vm.ToValue(false)
+}
+
+// normalizeType resolves the shorthands of the type-is package
+func normalizeType(t string) string {
+	switch {
+	case t == "urlencoded":
+		return "application/x-www-form-urlencoded"
+	case t == "multipart":
+		return "multipart/*"
+	case strings.HasPrefix(t, "+"):
+		return "*/*" + t
+	}
+	return strings.ToLower(lookupMime(t))
+}
+
+// mimeMatch matches actual against expected, which may contain wildcards,
+// such as "text/*" or "*/*+json"
+func mimeMatch(expected, actual string) bool {
+	expectedType, expectedSubtype, ok := strings.Cut(expected, "/")
+	if !ok {
+		return false
+	}
+	actualType, actualSubtype, ok := strings.Cut(actual, "/")
+	if !ok {
+		return false
+	}
+	if expectedType != "*" && expectedType != actualType {
+		return false
+	}
+	if strings.HasPrefix(expectedSubtype, "*+") {
+		return len(actualSubtype) > len(expectedSubtype)-1 &&
+			strings.HasSuffix(actualSubtype, expectedSubtype[1:])
+	}
+	return expectedSubtype == "*" || expectedSubtype == actualSubtype
+}
+
+var noCacheDirective = regexp.MustCompile(`(?:^|,)\s*no-cache\s*(?:,|$)`)
+
+// fresh implements Request.fresh of Express.js, comparing the conditional
+// headers of the request with ETag and Last-Modified of the response. It is
+// also used by res.send() to respond with 304.
+func (ctx *RequestContext) fresh() bool {
+	r := ctx.httpReq
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	status := http.StatusOK
+	if ctx.responseProxy != nil && ctx.statusSet {
+		status = ctx.responseProxy.statusCode
+	}
+	if (status < 200 || status >= 300) && status != http.StatusNotModified {
+		return false
+	}
+
+	modifiedSince := r.Header.Get("If-Modified-Since")
+	noneMatch := r.Header.Get("If-None-Match")
+	if modifiedSince == "" && noneMatch == "" {
+		return false
+	}
+	if noCacheDirective.MatchString(r.Header.Get("Cache-Control")) {
+		return false
+	}
+
+	header := ctx.httpResp.Header()
+	if noneMatch != "" && noneMatch != "*" {
+		etag := header.Get("ETag")
+		if etag == "" {
+			return false
+		}
+		matched := false
+		for _, tag := range strings.Split(noneMatch, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == etag || tag == "W/"+etag || "W/"+tag == etag {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if modifiedSince != "" {
+		lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+		if err != nil {
+			return false
+		}
+		since, err := http.ParseTime(modifiedSince)
+		if err != nil || lastModified.After(since) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -2,11 +2,15 @@ package express
 
 import (
 	"expvar"
+	"io/fs"
 
+	"go.miragespace.co/heresy/extensions/abort"
 	"go.miragespace.co/heresy/extensions/common"
 	"go.miragespace.co/heresy/extensions/common/x"
-	"go.miragespace.co/heresy/extensions/fetch"
-	"go.miragespace.co/heresy/extensions/kv"
+	"go.miragespace.co/heresy/extensions/errorpage"
+	"go.miragespace.co/heresy/extensions/form"
+	"go.miragespace.co/heresy/extensions/promise"
+	"go.miragespace.co/heresy/extensions/stream"
 
 	"github.com/dop251/goja"
 	"github.com/dop251/goja_nodejs/eventloop"
@@ -21,8 +25,14 @@ var (
 type RequestContextDeps struct {
 	Logger    *zap.Logger
 	Eventloop *eventloop.EventLoop
-	Fetch     *fetch.Fetch
-	KV        *kv.KVManager
+	Abort     *abort.AbortController
+	Form      *form.FormParser
+	Errors    *errorpage.Reporter
+	Cookies   *CookieSigner // nil without a cookie secret
+	Resolver  *promise.PromiseResolver
+	Stream    *stream.StreamController
+	Assets    fs.FS  // nil without assets
+	Views     *Views // nil without views
 }
 
 type RequestContextPool struct {
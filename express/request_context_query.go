@@ -0,0 +1,278 @@
+package express
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// limits of the "extended" query parser of Express.js (qs)
+const (
+	queryDepth      = 5
+	queryArrayLimit = 20
+	queryParamLimit = 1000
+)
+
+// keys inherited from Object.prototype are ignored, like qs does by default
+var queryPrototypeKeys = map[string]bool{
+	"__proto__":            true,
+	"__defineGetter__":     true,
+	"__defineSetter__":     true,
+	"__lookupGetter__":     true,
+	"__lookupSetter__":     true,
+	"constructor":          true,
+	"hasOwnProperty":       true,
+	"isPrototypeOf":        true,
+	"propertyIsEnumerable": true,
+	"toLocaleString":       true,
+	"toString":             true,
+	"valueOf":              true,
+}
+
+// queryObject keeps the insertion order of keys, as a JavaScript object does
+type queryObject struct {
+	keys   []string
+	values map[string]any
+}
+
+// queryArray may have holes (nil) until the query is parsed entirely
+type queryArray []any
+
+func newQueryObject() *queryObject {
+	return &queryObject{values: map[string]any{}}
+}
+
+func (o *queryObject) set(key string, val any) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = val
+}
+
+// parseQuery implements the "extended" query parser of Express.js, such that
+// a[b]=1&a[c][]=2&d=3&d=4 is parsed into { a: { b: "1", c: ["2"] }, d: ["3", "4"] }
+func parseQuery(rawQuery string) *queryObject {
+	root := newQueryObject()
+	if rawQuery == "" {
+		return root
+	}
+
+	pairs := strings.Split(rawQuery, "&")
+	if len(pairs) > queryParamLimit {
+		pairs = pairs[:queryParamLimit]
+	}
+	for _, pair := range pairs {
+		if pair == "" {
+			continue
+		}
+		key, val, _ := strings.Cut(pair, "=")
+		key = decodeQueryComponent(key)
+		if key == "" {
+			continue
+		}
+		leaf := queryLeaf(splitQueryKey(key), decodeQueryComponent(val))
+		if leaf != nil {
+			mergeQuery(root, leaf)
+		}
+	}
+
+	compactQuery(root)
+	return root
+}
+
+func decodeQueryComponent(s string) string {
+	if v, err := url.QueryUnescape(s); err == nil {
+		return v
+	}
+	// keep malformed escapes as-is, but still decode "+"
+	return strings.ReplaceAll(s, "+", " ")
+}
+
+var queryBrackets = regexp.MustCompile(`\[[^\[\]]*\]`)
+
+// splitQueryKey splits a[b][c] into "a", "[b]", "[c]". Segments beyond
+// queryDepth are kept as a single segment.
+func splitQueryKey(key string) []string {
+	matches := queryBrackets.FindAllStringIndex(key, queryDepth+1)
+	if len(matches) == 0 {
+		if queryPrototypeKeys[key] {
+			return nil
+		}
+		return []string{key}
+	}
+
+	var segments []string
+	if parent := key[:matches[0][0]]; parent != "" {
+		if queryPrototypeKeys[parent] {
+			return nil
+		}
+		segments = append(segments, parent)
+	}
+
+	for i, m := range matches {
+		if i == queryDepth {
+			segments = append(segments, "["+key[m[0]:]+"]")
+			break
+		}
+		segment := key[m[0]:m[1]]
+		if queryPrototypeKeys[segment[1:len(segment)-1]] {
+			return nil
+		}
+		segments = append(segments, segment)
+	}
+	return segments
+}
+
+// queryLeaf builds the value of a single pair, from the innermost segment
+func queryLeaf(segments []string, val string) *queryObject {
+	if len(segments) == 0 {
+		return nil
+	}
+
+	var leaf any = val
+	for i := len(segments) - 1; i >= 0; i-- {
+		segment := segments[i]
+		if segment == "[]" && i > 0 {
+			leaf = queryArray{leaf}
+			continue
+		}
+
+		clean := segment
+		bracketed := strings.HasPrefix(segment, "[") && strings.HasSuffix(segment, "]")
+		if bracketed {
+			clean = segment[1 : len(segment)-1]
+		}
+
+		if index, err := strconv.Atoi(clean); bracketed && i > 0 && err == nil &&
+			strconv.Itoa(index) == clean && index >= 0 && index <= queryArrayLimit {
+			arr := make(queryArray, index+1)
+			arr[index] = leaf
+			leaf = arr
+			continue
+		}
+
+		obj := newQueryObject()
+		obj.set(clean, leaf)
+		leaf = obj
+	}
+
+	obj, _ := leaf.(*queryObject)
+	return obj
+}
+
+// mergeQuery follows the merge semantics of qs
+func mergeQuery(target, source any) any {
+	if source == nil {
+		return target
+	}
+
+	switch t := target.(type) {
+	case nil:
+		return source
+	case string:
+		switch s := source.(type) {
+		case queryArray:
+			return append(queryArray{t}, s...)
+		default:
+			return queryArray{t, s}
+		}
+	case queryArray:
+		switch s := source.(type) {
+		case string:
+			return append(t, s)
+		case queryArray:
+			for i, v := range s {
+				if v == nil {
+					continue
+				}
+				if i >= len(t) {
+					t = append(t, make(queryArray, i+1-len(t))...)
+					t[i] = v
+					continue
+				}
+				if t[i] == nil {
+					t[i] = v
+					continue
+				}
+				if _, ok := t[i].(*queryObject); ok {
+					if _, ok := v.(*queryObject); ok {
+						t[i] = mergeQuery(t[i], v)
+						continue
+					}
+				}
+				t = append(t, v)
+			}
+			return t
+		case *queryObject:
+			return mergeQuery(queryArrayToObject(t), s)
+		}
+	case *queryObject:
+		switch s := source.(type) {
+		case string:
+			if !queryPrototypeKeys[s] {
+				t.set(s, "true")
+			}
+			return t
+		case queryArray:
+			return mergeQuery(t, queryArrayToObject(s))
+		case *queryObject:
+			for _, k := range s.keys {
+				t.set(k, mergeQuery(t.values[k], s.values[k]))
+			}
+			return t
+		}
+	}
+	return target
+}
+
+func queryArrayToObject(arr queryArray) *queryObject {
+	obj := newQueryObject()
+	for i, v := range arr {
+		if v != nil {
+			obj.set(strconv.Itoa(i), v)
+		}
+	}
+	return obj
+}
+
+// compactQuery removes holes of sparse arrays
+func compactQuery(val any) any {
+	switch v := val.(type) {
+	case queryArray:
+		compact := v[:0]
+		for _, e := range v {
+			if e != nil {
+				compact = append(compact, compactQuery(e))
+			}
+		}
+		return compact
+	case *queryObject:
+		for _, k := range v.keys {
+			v.values[k] = compactQuery(v.values[k])
+		}
+	}
+	return val
+}
+
+func queryToValue(vm *goja.Runtime, val any) goja.Value {
+	switch v := val.(type) {
+	case string:
+		return vm.ToValue(v)
+	case queryArray:
+		items := make([]any, 0, len(v))
+		for _, e := range v {
+			items = append(items, queryToValue(vm, e))
+		}
+		return vm.NewArray(items...)
+	case *queryObject:
+		obj := vm.NewObject()
+		for _, k := range v.keys {
+			obj.Set(k, queryToValue(vm, v.values[k]))
+		}
+		return obj
+	}
+	return goja.Undefined()
+}
@@ -0,0 +1,69 @@
+package express
+
+import (
+	"testing"
+
+	"github.com/dop251/goja"
+)
+
+// stringify converts a parsed query to JSON, which keeps the order of keys
+func stringify(t *testing.T, vm *goja.Runtime, val goja.Value) string {
+	t.Helper()
+	vm.Set("value", val)
+	out, err := vm.RunString("JSON.stringify(value)")
+	if err != nil {
+		t.Fatalf("JSON.stringify: %v", err)
+	}
+	return out.String()
+}
+
+func TestParseQuery(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		want  string
+	}{
+		{"", `{}`},
+		{"a=1&b=2", `{"a":"1","b":"2"}`},
+		{"d=3&d=4", `{"d":["3","4"]}`},
+		{"a[b]=1&a[c][]=2", `{"a":{"b":"1","c":["2"]}}`},
+		{"a[]=1&a[]=2", `{"a":["1","2"]}`},
+		{"a[1]=b&a[0]=c", `{"a":["c","b"]}`},
+		{"a[21]=x", `{"a":{"21":"x"}}`},
+		{"a[b][c][d][e][f][g]=1", `{"a":{"b":{"c":{"d":{"e":{"f":{"[g]":"1"}}}}}}}`},
+		{"a=%E2%9C%93+b&c=%ZZ+d", `{"a":"✓ b","c":"%ZZ d"}`},
+		{"a&b=", `{"a":"","b":""}`},
+	} {
+		vm := goja.New()
+		if got := stringify(t, vm, queryToValue(vm, parseQuery(tc.query))); got != tc.want {
+			t.Errorf("parseQuery(%q) = %s, want %s", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestParseQueryIgnoresPrototypeKeys(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		want  string
+	}{
+		{"__proto__[x]=1&a=1", `{"a":"1"}`},
+		{"toString=1&hasOwnProperty=2", `{}`},
+		{"a[constructor]=1&a[b]=2", `{"a":{"b":"2"}}`},
+	} {
+		vm := goja.New()
+		val := queryToValue(vm, parseQuery(tc.query))
+		if got := stringify(t, vm, val); got != tc.want {
+			t.Errorf("parseQuery(%q) = %s, want %s", tc.query, got, tc.want)
+		}
+		if proto := val.ToObject(vm).Prototype(); proto == nil || !proto.SameAs(vm.Get("Object").ToObject(vm).Get("prototype").ToObject(vm)) {
+			t.Errorf("parseQuery(%q) replaced the prototype", tc.query)
+		}
+	}
+}
+
+func TestParseSimpleQuery(t *testing.T) {
+	vm := goja.New()
+	got := stringify(t, vm, queryToValue(vm, parseSimpleQuery("a[b]=1&c=2&c=3&c=4")))
+	if want := `{"a[b]":"1","c":["2","3","4"]}`; got != want {
+		t.Errorf("parseSimpleQuery = %s, want %s", got, want)
+	}
+}
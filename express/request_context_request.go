@@ -2,6 +2,7 @@ package express
 
 import (
 	"net"
+	"strings"
 
 	"github.com/dop251/goja"
 )
@@ -9,18 +10,26 @@ import (
 type contextRequest struct {
 	*RequestContext
 	nativeReq           *goja.Object
-	nativeGet           goja.Value
+	headers             *requestHeaders
+	nativeReqFuncs      map[string]goja.Value
 	nativeReqProperties map[string]goja.Value
+	nativeBody          goja.Value // set by req.stream()
 }
 
 var _ goja.DynamicObject = (*contextRequest)(nil)
 
-var requestProperties = []string{"ip", "method", "path", "protocol", "res", "secure"}
+var requestProperties = []string{
+	"baseUrl", "body", "cookies", "fresh", "headers", "hostname", "ip", "method",
+	"originalUrl", "params", "path", "protocol", "query", "res", "secure", "signal",
+	"signedCookies", "stale", "url", "xhr",
+}
 
 func newContextRequest(ctx *RequestContext) *contextRequest {
 	req := &contextRequest{
 		RequestContext:      ctx,
+		nativeReqFuncs:      map[string]goja.Value{},
 		nativeReqProperties: map[string]goja.Value{},
+		headers:             newRequestHeaders(ctx.vm),
 	}
 	req.nativeReq = ctx.vm.NewDynamicObject(req)
 	return req
@@ -30,6 +39,8 @@ func (req *contextRequest) reset() {
 	for k := range req.nativeReqProperties {
 		delete(req.nativeReqProperties, k)
 	}
+	req.headers.reset()
+	req.nativeBody = nil
 }
 
 func (req *contextRequest) initReqProperty(key string) {
@@ -39,11 +50,40 @@ func (req *contextRequest) initReqProperty(key string) {
 	)
 
 	switch key {
+	case "baseUrl":
+		val = req.vm.ToValue("")
+	case "body":
+		switch {
+		case req.parsedBody != nil:
+			val = req.parsedBody.toValue(req.vm)
+		case req.bodyParsed:
+			// same as body-parser when no parser matches
+			val = req.vm.NewObject()
+		default:
+			val = goja.Undefined()
+		}
+	case "cookies", "signedCookies":
+		// both are parsed at once
+		req.parseCookies()
+		return
+	case "headers":
+		req.headers.useHeader(r.Header)
+		val = req.headers.nativeObj
+	case "hostname":
+		val = req.vm.ToValue(hostname(r.Host))
 	case "ip":
 		ip, _, _ := net.SplitHostPort(r.RemoteAddr)
 		val = req.vm.ToValue(ip)
 	case "method":
 		val = req.vm.ToValue(r.Method)
+	case "originalUrl":
+		if r.RequestURI != "" {
+			val = req.vm.ToValue(r.RequestURI)
+		} else {
+			val = req.vm.ToValue(r.URL.RequestURI())
+		}
+	case "params":
+		val = req.vm.NewObject()
 	case "path":
 		val = req.vm.ToValue(r.URL.Path)
 	case "protocol":
@@ -52,44 +92,98 @@ func (req *contextRequest) initReqProperty(key string) {
 		} else {
 			val = req.vm.ToValue("https")
 		}
+	case "query":
+		val = queryToValue(req.vm, parseQuery(r.URL.RawQuery))
 	case "secure":
 		if r.TLS == nil {
 			val = req.vm.ToValue(false)
 		} else {
 			val = req.vm.ToValue(true)
 		}
+	case "signal":
+		val, req.signalStop = req.deps.Abort.NewSignalVM(r.Context(), req.vm)
+	case "url":
+		val = req.vm.ToValue(r.URL.RequestURI())
+	case "xhr":
+		val = req.vm.ToValue(strings.EqualFold(r.Header.Get("X-Requested-With"), "XMLHttpRequest"))
 	}
 
 	req.nativeReqProperties[key] = val
 }
 
-func (req *contextRequest) Get(key string) goja.Value {
-	if req.Has(key) {
-		if req.nativeReqProperties[key] == nil {
-			req.initReqProperty(key)
-		}
-		return req.nativeReqProperties[key]
+func (req *contextRequest) initFunction(key string) {
+	var val goja.Value
+	switch key {
+	case "accepts":
+		val = req.vm.ToValue(req.accepts)
+	case "arrayBuffer":
+		val = req.vm.ToValue(req.arrayBuffer)
+	case "acceptsCharsets":
+		val = req.vm.ToValue(req.acceptsCharsets)
+	case "acceptsEncodings":
+		val = req.vm.ToValue(req.acceptsEncodings)
+	case "acceptsLanguages":
+		val = req.vm.ToValue(req.acceptsLanguages)
+	case "formData":
+		val = req.vm.ToValue(req.formData)
+	case "get":
+		fallthrough
+	case "header":
+		val = req.vm.ToValue(req.get)
+	case "is":
+		val = req.vm.ToValue(req.is)
+	case "json":
+		val = req.vm.ToValue(req.json)
+	case "stream":
+		val = req.vm.ToValue(req.stream)
+	case "text":
+		val = req.vm.ToValue(req.text)
+	}
+	if val != nil {
+		req.nativeReqFuncs[key] = val
 	}
+}
 
+func (req *contextRequest) Get(key string) goja.Value {
 	switch key {
-	case "get":
-		if req.nativeGet == nil {
-			req.nativeGet = req.vm.ToValue(req.get)
-		}
-		return req.nativeGet
+	case "fresh":
+		// depends on the response headers, so it is not cached
+		return req.vm.ToValue(req.fresh())
+	case "stale":
+		return req.vm.ToValue(!req.fresh())
 	case "res":
 		if req.responseProxy == nil {
 			req.responseProxy = newContextResponse(req.RequestContext)
 		}
 		return req.responseProxy.nativeRes
+	}
 
-	default:
-		return goja.Undefined()
+	if req.Has(key) {
+		if req.nativeReqProperties[key] == nil {
+			req.initReqProperty(key)
+		}
+		return req.nativeReqProperties[key]
+	}
+
+	if req.nativeReqFuncs[key] == nil {
+		req.initFunction(key)
 	}
+	if req.nativeReqFuncs[key] != nil {
+		return req.nativeReqFuncs[key]
+	}
+
+	return goja.Undefined()
 }
 
-func (req *contextRequest) Set(_ string, _ goja.Value) bool {
-	return false
+func (req *contextRequest) Set(key string, val goja.Value) bool {
+	switch key {
+	case "body":
+		// middleware may replace the parsed body
+		req.nativeReqProperties[key] = val
+		return true
+	default:
+		return false
+	}
 }
 
 func (req *contextRequest) Has(key string) bool {
@@ -109,6 +203,18 @@ func (req *contextRequest) Keys() []string {
 	return requestProperties
 }
 
+// implement Request.formData(), which parses multipart/form-data and
+// application/x-www-form-urlencoded bodies into FormData
+func (req *contextRequest) formData(fc goja.FunctionCall) goja.Value {
+	if req.bodyConsumed {
+		promise, _, reject := req.vm.NewPromise()
+		reject(req.vm.NewTypeError("formData: body was already read"))
+		return req.vm.ToValue(promise)
+	}
+	req.bodyConsumed = true
+	return req.deps.Form.NewFormDataVM(req.ioContext, req.vm, req.httpReq.Header.Get("content-type"), req.httpReq.Body)
+}
+
 // implement Request.get(field) of Express.js
 func (req *contextRequest) get(fc goja.FunctionCall) goja.Value {
 	field := fc.Argument(0)
@@ -127,3 +233,17 @@ func (req *contextRequest) get(fc goja.FunctionCall) goja.Value {
 
 	return goja.Undefined()
 }
+
+// hostname strips the port from the Host header, keeping IPv6 literals
+func hostname(host string) string {
+	if strings.HasPrefix(host, "[") {
+		if end := strings.IndexByte(host, ']'); end >= 0 {
+			return host[:end+1]
+		}
+		return host
+	}
+	if i := strings.IndexByte(host, ':'); i >= 0 {
+		return host[:i]
+	}
+	return host
+}
@@ -1,24 +1,36 @@
 package express
 
 import (
-	"fmt"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
 	"net/http"
 	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 
+	"go.miragespace.co/heresy/extensions/blob"
+	"go.miragespace.co/heresy/extensions/common/shared"
+
 	"github.com/dop251/goja"
+	"go.uber.org/zap"
 )
 
 type contextResponse struct {
 	*RequestContext
 	nativeRes       *goja.Object
 	nativeRespFuncs map[string]goja.Value
+	bodyWriter      *chunkWriter // set by res.write()
+	bodyEnded       bool
+	drainWaiters    []func(any)
 	statusCode      int
 }
 
 var _ goja.DynamicObject = (*contextResponse)(nil)
 
-var responseProperties = []string{"headersSent"}
+var responseProperties = []string{"headersSent", "locals"}
 
 func newContextResponse(ctx *RequestContext) *contextResponse {
 	res := &contextResponse{
@@ -43,10 +55,42 @@ func (res *contextResponse) initFunction(key string) {
 		val = res.vm.ToValue(res.get)
 	case "end":
 		val = res.vm.ToValue(res.end)
+	case "write":
+		val = res.vm.ToValue(res.write)
+	case "drain":
+		val = res.vm.ToValue(res.drain)
+	case "cookie":
+		val = res.vm.ToValue(res.cookie)
+	case "clearCookie":
+		val = res.vm.ToValue(res.clearCookie)
 	case "set":
 		fallthrough
 	case "header":
 		val = res.vm.ToValue(res.set)
+	case "append":
+		val = res.vm.ToValue(res.append)
+	case "attachment":
+		val = res.vm.ToValue(res.attachment)
+	case "format":
+		val = res.vm.ToValue(res.format)
+	case "links":
+		val = res.vm.ToValue(res.links)
+	case "location":
+		val = res.vm.ToValue(res.location)
+	case "redirect":
+		val = res.vm.ToValue(res.redirect)
+	case "render":
+		val = res.vm.ToValue(res.render)
+	case "sendFile":
+		val = res.vm.ToValue(res.sendFile)
+	case "sendStatus":
+		val = res.vm.ToValue(res.sendStatus)
+	case "type":
+		fallthrough
+	case "contentType":
+		val = res.vm.ToValue(res.contentType)
+	case "vary":
+		val = res.vm.ToValue(res.vary)
 	}
 	if val != nil {
 		res.nativeRespFuncs[key] = val
@@ -58,6 +102,8 @@ func (res *contextResponse) Get(key string) goja.Value {
 		switch key {
 		case "headersSent":
 			return res.vm.ToValue(res.responseSent)
+		case "locals":
+			return res.locals.NativeObject(res.httpReq)
 		}
 	}
 
@@ -71,8 +117,14 @@ func (res *contextResponse) Get(key string) goja.Value {
 	return goja.Undefined()
 }
 
-func (res *contextResponse) Set(_ string, _ goja.Value) bool {
-	return false
+func (res *contextResponse) Set(key string, val goja.Value) bool {
+	switch key {
+	case "locals":
+		res.locals.Replace(res.httpReq, val)
+		return true
+	default:
+		return false
+	}
 }
 
 func (res *contextResponse) Has(key string) bool {
@@ -95,6 +147,9 @@ func (res *contextResponse) Keys() []string {
 func (res *contextResponse) reset() {
 	res.statusCode = http.StatusNoContent
 	res.statusSet = false
+	res.bodyWriter = nil
+	res.bodyEnded = false
+	res.drainWaiters = nil
 }
 
 // implement Response.get(field) of Express.js
@@ -120,6 +175,10 @@ func (res *contextResponse) get(fc goja.FunctionCall) goja.Value {
 
 // implement Response.set(field [, value]) of Express.js (chainable)
 func (res *contextResponse) set(fc goja.FunctionCall) goja.Value {
+	if res.responseSent {
+		panic(res.vm.NewTypeError("response already sent"))
+	}
+
 	field := fc.Argument(0)
 	val := fc.Argument(1)
 
@@ -128,40 +187,59 @@ func (res *contextResponse) set(fc goja.FunctionCall) goja.Value {
 	}
 
 	if len(fc.Arguments) == 2 {
-		k := fmt.Sprintf("%s", field.Export())
-		v := fmt.Sprintf("%v", val.Export())
-
-		if strings.ToLower(k) == "content-type" {
-			if val.ExportType().Kind() == reflect.Slice {
-				panic(res.vm.NewTypeError("Content-Type cannot be set to an Array"))
-			}
-			// TODO: add charset based on mime like express
+		res.setHeader(field.String(), val)
+	} else {
+		obj := field.ToObject(res.vm)
+		for _, k := range obj.Keys() {
+			res.setHeader(k, obj.Get(k))
 		}
+	}
+	return res.nativeRes
+}
 
-		// TODO: handle slice of values
-		w := res.httpResp
-		header := w.Header()
-		if header.Get(k) == "" {
-			header.Set(k, v)
-		} else {
-			header.Add(k, v)
-		}
-	} else {
-		var m map[string]interface{}
-		if err := res.vm.ExportTo(field, &m); err != nil {
-			panic(res.vm.NewGoError(err))
+// setHeader replaces the values of field. Content-Type gets a charset based
+// on the MIME type, like Express.js does.
+func (res *contextResponse) setHeader(field string, val goja.Value) {
+	values := headerValues(res.vm, val)
+	if strings.EqualFold(field, "content-type") {
+		if len(values) != 1 {
+			panic(res.vm.NewTypeError("Content-Type cannot be set to an Array"))
 		}
-		for k, v := range m {
-			res.set(goja.FunctionCall{
-				This: fc.This,
-				Arguments: []goja.Value{
-					res.vm.ToValue(k),
-					res.vm.ToValue(v),
-				},
-			})
+		values[0] = withCharset(values[0])
+	}
+
+	header := res.httpResp.Header()
+	header.Del(field)
+	for _, v := range values {
+		header.Add(field, v)
+	}
+}
+
+func headerValues(vm *goja.Runtime, val goja.Value) []string {
+	if obj, ok := val.(*goja.Object); ok && obj.ClassName() == "Array" {
+		var values []string
+		if err := vm.ExportTo(val, &values); err != nil {
+			panic(vm.NewGoError(err))
 		}
+		return values
 	}
-	return res.nativeRes
+	return []string{val.String()}
+}
+
+var charsetParam = regexp.MustCompile(`(?i);\s*charset\s*=`)
+
+// withCharset adds charset=utf-8 to text types, unless a charset is present
+func withCharset(contentType string) string {
+	if charsetParam.MatchString(contentType) {
+		return contentType
+	}
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if strings.HasPrefix(mediaType, "text/") ||
+		mediaType == "application/javascript" || mediaType == "application/json" {
+		return contentType + "; charset=utf-8"
+	}
+	return contentType
 }
 
 // implement Response.status(code) of Express.js (chainable)
@@ -197,94 +275,259 @@ func (res *contextResponse) json(fc goja.FunctionCall) goja.Value {
 
 	body := fc.Argument(0)
 
-	var (
-		obj     *goja.Object
-		content []byte
-	)
-
-	w := res.httpResp
-	header := w.Header()
-	header.Set("content-type", "application/json")
-
+	var content []byte
 	if goja.IsUndefined(body) {
 		content = append(content, "{}"...)
 	} else if goja.IsNull(body) {
 		content = []byte(string("null"))
 	} else {
-		obj = body.ToObject(res.vm)
-		content, _ = obj.MarshalJSON()
+		var err error
+		content, err = body.ToObject(res.vm).MarshalJSON()
+		if err != nil {
+			panic(res.vm.NewGoError(err))
+		}
 	}
 
-	res.sendHeaders()
-	w.Write(content)
+	if res.httpResp.Header().Get("content-type") == "" {
+		res.setHeader("content-type", res.vm.ToValue("application/json"))
+	}
+	res.sendBuffered(content)
 
 	return goja.Undefined()
 }
 
-// implement Response.end([body]) of Express.js
+// implement Response.send([body]) of Express.js. Strings default to
+// text/html, ArrayBuffer and typed arrays to application/octet-stream, and
+// other values are sent as JSON. A ReadableStream, such as the body of a
+// fetch Response, is copied to the client in Go.
 func (res *contextResponse) send(fc goja.FunctionCall) goja.Value {
 	if res.responseSent {
 		panic(res.vm.NewTypeError("response already sent"))
 	}
 
 	body := fc.Argument(0)
+	header := res.httpResp.Header()
+
 	if goja.IsUndefined(body) {
+		res.sendBuffered(nil)
 		return goja.Undefined()
 	}
+	if goja.IsNull(body) {
+		return res.json(fc)
+	}
 
-	var (
-		content []byte
-	)
+	if body.ExportType().Kind() == reflect.String {
+		if header.Get("content-type") == "" {
+			res.setHeader("content-type", res.vm.ToValue("text/html"))
+		}
+		res.sendBuffered([]byte(body.String()))
+		return goja.Undefined()
+	}
 
-	w := res.httpResp
-	header := w.Header()
+	if b, ok := blob.AssertBytes(body, res.vm); ok {
+		if header.Get("content-type") == "" {
+			res.setType("bin")
+		}
+		res.sendBuffered(b)
+		return goja.Undefined()
+	}
 
-	if goja.IsNull(body) {
-		return res.json(fc)
-	} else {
-		switch body.ExportType().Kind() {
-		case reflect.String:
-			if header.Get("content-type") == "" {
-				header.Set("content-type", "text/html")
-			}
-			res.vm.ExportTo(body, &content)
-		case reflect.Map, reflect.Slice, reflect.Bool:
-			return res.json(fc)
-		default:
-			fmt.Printf("%+v\n", body.ExportType())
-			fmt.Printf("%+v\n", body.ExportType().Kind() == reflect.Map)
-			fmt.Printf("%+v\n", body.Export())
+	reader, ok, err := res.deps.Stream.NewReaderVM(res.ioContext, body, res.vm)
+	if err != nil {
+		panic(res.vm.NewGoError(err))
+	}
+	if ok {
+		if header.Get("content-type") == "" {
+			res.setType("bin")
 		}
+		res.sendStream(reader)
+		return goja.Undefined()
+	}
+
+	return res.json(fc)
+}
+
+// sendBuffered writes a complete body with Content-Length and a weak ETag,
+// like Express.js. A fresh request gets 304 without the body.
+func (res *contextResponse) sendBuffered(content []byte) {
+	header := res.httpResp.Header()
+	if header.Get("ETag") == "" {
+		header.Set("ETag", weakETag(content))
 	}
+	if res.fresh() {
+		res.statusCode = http.StatusNotModified
+		res.statusSet = true
+	}
+
+	if res.statusSet && (res.statusCode == http.StatusNoContent || res.statusCode == http.StatusNotModified) {
+		header.Del("Content-Type")
+		header.Del("Content-Length")
+		header.Del("Transfer-Encoding")
+		content = nil
+	} else {
+		header.Set("Content-Length", strconv.Itoa(len(content)))
+	}
+
+	res.sendHeaders()
+	if res.httpReq.Method != http.MethodHead && len(content) > 0 {
+		res.httpResp.Write(content)
+	}
+}
+
+// weakETag is the default ETag of Express.js: the length and a truncated
+// SHA-1 of the body
+func weakETag(content []byte) string {
+	sum := sha1.Sum(content)
+	hash := base64.StdEncoding.EncodeToString(sum[:])[:27]
+	return `W/"` + strconv.FormatInt(int64(len(content)), 16) + "-" + hash + `"`
+}
 
+// sendStream copies reader to the client off the loop. The request is
+// concluded after the copy completes.
+func (res *contextResponse) sendStream(reader io.Reader) {
+	w := res.httpResp
 	res.sendHeaders()
-	w.Write(content)
+	if res.httpReq.Method == http.MethodHead {
+		return
+	}
 
-	return goja.Undefined()
+	var dst io.Writer = w
+	if shared.IsEventStream(w.Header()) {
+		dst = shared.NewFlushWriter(w)
+	}
+
+	done := make(chan struct{})
+	res.writerDone = done
+	go func() {
+		defer close(done)
+
+		buf := shared.GetBuffer()
+		defer shared.PutBuffer(buf)
+
+		if _, err := io.CopyBuffer(dst, reader, buf); err != nil {
+			res.deps.Logger.Error("Error writing response", zap.Error(err))
+		}
+	}()
+}
+
+// implement Response.write(chunk [, encoding]) of Node.js. The headers are
+// sent with the first chunk, and every chunk is flushed to the client off the
+// loop. It returns false once the queued chunks exceed the high water mark of
+// Node.js, then res.drain() should be awaited before writing more. The
+// response ends with res.end(), or when the handler settles.
+func (res *contextResponse) write(fc goja.FunctionCall) goja.Value {
+	if res.responseSent && res.bodyWriter == nil {
+		panic(res.vm.NewTypeError("response already sent"))
+	}
+	if res.bodyEnded {
+		panic(res.vm.NewTypeError("write after end"))
+	}
+
+	content := res.chunkBytes(fc.Argument(0), fc.Argument(1))
+	if res.bodyWriter == nil {
+		res.sendHeaders()
+		w := newChunkWriter(shared.NewFlushWriter(res.httpResp), nil)
+		w.onDrain = func() {
+			res.deps.Eventloop.RunOnLoop(func(*goja.Runtime) {
+				// the response may have been reused by then
+				if res.bodyWriter == w {
+					res.resolveDrain()
+				}
+			})
+		}
+		res.bodyWriter = w
+		res.writerDone = w.done
+	}
+	if res.httpReq.Method == http.MethodHead {
+		content = nil
+	}
+
+	return res.vm.ToValue(res.bodyWriter.write(content))
+}
+
+// implement a Promise resolving once the chunks of res.write() are written
+// to the client, in place of the drain event of Node.js
+func (res *contextResponse) drain(fc goja.FunctionCall) goja.Value {
+	promise, resolve, _ := res.vm.NewPromise()
+	if res.bodyWriter == nil || res.bodyWriter.drained() {
+		resolve(goja.Undefined())
+	} else {
+		res.drainWaiters = append(res.drainWaiters, resolve)
+	}
+	return res.vm.ToValue(promise)
+}
+
+func (res *contextResponse) resolveDrain() {
+	waiters := res.drainWaiters
+	res.drainWaiters = nil
+	for _, resolve := range waiters {
+		resolve(goja.Undefined())
+	}
 }
 
 // implement Response.end([data] [, encoding]) of Express.js
 func (res *contextResponse) end(fc goja.FunctionCall) goja.Value {
+	if res.bodyWriter != nil {
+		// streamed with res.write()
+		if !res.bodyEnded && !goja.IsUndefined(fc.Argument(0)) {
+			res.write(fc)
+		}
+		res.bodyEnded = true
+		res.bodyWriter.close()
+		return res.nativeRes
+	}
+
 	if res.responseSent {
 		panic(res.vm.NewTypeError("response already sent"))
 	}
 
-	w := res.httpResp
-	res.sendHeaders()
+	var content []byte
+	if body := fc.Argument(0); !goja.IsUndefined(body) && !goja.IsNull(body) {
+		content = res.chunkBytes(body, fc.Argument(1))
+		res.httpResp.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	}
 
-	body := fc.Argument(0)
-	if goja.IsUndefined(body) {
-		return goja.Undefined()
+	res.sendHeaders()
+	if res.httpReq.Method != http.MethodHead && len(content) > 0 {
+		res.httpResp.Write(content)
 	}
 
-	switch body.ExportType().Kind() {
-	case reflect.String:
-		var content []byte
-		res.vm.ExportTo(body, &content)
-		w.Write(content)
+	return res.nativeRes
+}
+
+// chunkBytes converts the chunk of res.write() and res.end(), which is a
+// string in encoding, an ArrayBuffer or a typed array
+func (res *contextResponse) chunkBytes(chunk, encoding goja.Value) []byte {
+	if b, ok := blob.AssertBytes(chunk, res.vm); ok {
+		return b
+	}
+	if goja.IsUndefined(chunk) || goja.IsNull(chunk) || chunk.ExportType().Kind() != reflect.String {
+		panic(res.vm.NewTypeError("chunk must be a string, ArrayBuffer or typed array"))
 	}
 
-	return goja.Undefined()
+	s := chunk.String()
+	enc := "utf8"
+	if !goja.IsUndefined(encoding) && !goja.IsNull(encoding) {
+		enc = strings.ToLower(encoding.String())
+	}
+	switch enc {
+	case "utf8", "utf-8":
+		return []byte(s)
+	case "base64":
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			panic(res.vm.NewTypeError("invalid base64 chunk"))
+		}
+		return b
+	case "hex":
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			panic(res.vm.NewTypeError("invalid hex chunk"))
+		}
+		return b
+	default:
+		panic(res.vm.NewTypeError("unsupported encoding " + enc))
+	}
 }
 
 func (res *contextResponse) sendHeaders() {
@@ -0,0 +1,354 @@
+package express
+
+import (
+	"errors"
+	"html"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// implement Response.append(field [, value]) of Express.js (chainable)
+func (res *contextResponse) append(fc goja.FunctionCall) goja.Value {
+	if res.responseSent {
+		panic(res.vm.NewTypeError("response already sent"))
+	}
+
+	field := fc.Argument(0)
+	if goja.IsUndefined(field) {
+		panic(res.vm.NewTypeError("invalid undefined argument"))
+	}
+
+	header := res.httpResp.Header()
+	if header.Get(field.String()) == "" {
+		res.setHeader(field.String(), fc.Argument(1))
+		return res.nativeRes
+	}
+	for _, v := range headerValues(res.vm, fc.Argument(1)) {
+		header.Add(field.String(), v)
+	}
+	return res.nativeRes
+}
+
+// implement Response.type(type) and Response.contentType(type) of
+// Express.js (chainable)
+func (res *contextResponse) contentType(fc goja.FunctionCall) goja.Value {
+	if res.responseSent {
+		panic(res.vm.NewTypeError("response already sent"))
+	}
+
+	typ := fc.Argument(0)
+	if goja.IsUndefined(typ) {
+		panic(res.vm.NewTypeError("invalid undefined argument"))
+	}
+
+	res.setType(typ.String())
+	return res.nativeRes
+}
+
+func (res *contextResponse) setType(typ string) {
+	mimeType := lookupMime(typ)
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	res.setHeader("Content-Type", res.vm.ToValue(mimeType))
+}
+
+// implement Response.vary(field) of Express.js (chainable)
+func (res *contextResponse) vary(fc goja.FunctionCall) goja.Value {
+	if res.responseSent {
+		panic(res.vm.NewTypeError("response already sent"))
+	}
+
+	field := fc.Argument(0)
+	if goja.IsUndefined(field) {
+		panic(res.vm.NewTypeError("field argument is required"))
+	}
+
+	var fields []string
+	for _, v := range headerValues(res.vm, field) {
+		fields = append(fields, strings.Split(v, ",")...)
+	}
+	res.addVary(fields...)
+	return res.nativeRes
+}
+
+// addVary appends fields to Vary, skipping those already present
+func (res *contextResponse) addVary(fields ...string) {
+	header := res.httpResp.Header()
+
+	var current []string
+	for _, v := range header.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				current = append(current, f)
+			}
+		}
+	}
+
+	for _, f := range fields {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if f == "*" {
+			current = []string{"*"}
+			break
+		}
+		found := false
+		for _, c := range current {
+			if c == "*" || strings.EqualFold(c, f) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			current = append(current, f)
+		}
+	}
+
+	if len(current) > 0 {
+		header.Set("Vary", strings.Join(current, ", "))
+	}
+}
+
+// implement Response.location(path) of Express.js (chainable)
+func (res *contextResponse) location(fc goja.FunctionCall) goja.Value {
+	if res.responseSent {
+		panic(res.vm.NewTypeError("response already sent"))
+	}
+
+	res.setLocation(fc.Argument(0).String())
+	return res.nativeRes
+}
+
+func (res *contextResponse) setLocation(loc string) string {
+	if loc == "back" {
+		loc = res.httpReq.Referer()
+		if loc == "" {
+			loc = "/"
+		}
+	}
+	loc = encodeURL(loc)
+	res.httpResp.Header().Set("Location", loc)
+	return loc
+}
+
+// encodeURL percent-encodes characters not allowed in a URL, keeping valid
+// escapes as-is, like the encodeurl package used by Express.js
+func encodeURL(s string) string {
+	const upperhex = "0123456789ABCDEF"
+	isHex := func(c byte) bool {
+		return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '%':
+			if i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+				b.WriteByte(c)
+				continue
+			}
+		case c == 0x21, c >= 0x23 && c <= 0x3B, c == 0x3D, c >= 0x3F && c <= 0x5F,
+			c >= 0x61 && c <= 0x7A, c == 0x7C, c == 0x7E:
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(upperhex[c>>4])
+		b.WriteByte(upperhex[c&15])
+	}
+	return b.String()
+}
+
+// implement Response.redirect([status,] path) of Express.js
+func (res *contextResponse) redirect(fc goja.FunctionCall) goja.Value {
+	if res.responseSent {
+		panic(res.vm.NewTypeError("response already sent"))
+	}
+
+	status := http.StatusFound
+	loc := fc.Argument(0)
+	if len(fc.Arguments) > 1 {
+		if err := res.vm.ExportTo(fc.Argument(0), &status); err != nil || http.StatusText(status) == "" {
+			panic(res.vm.NewTypeError("invalid http status code to .redirect()"))
+		}
+		loc = fc.Argument(1)
+	}
+	if goja.IsUndefined(loc) {
+		panic(res.vm.NewTypeError("invalid undefined argument"))
+	}
+
+	address := res.setLocation(loc.String())
+
+	var body string
+	res.addVary("Accept")
+	switch acceptsType(res.httpReq, []string{"text", "html"}) {
+	case 0:
+		res.setType("text")
+		body = http.StatusText(status) + ". Redirecting to " + address
+	case 1:
+		res.setType("html")
+		u := html.EscapeString(address)
+		body = "<p>" + http.StatusText(status) + ". Redirecting to <a href=\"" + u + "\">" + u + "</a></p>"
+	}
+
+	header := res.httpResp.Header()
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	res.statusCode = status
+	res.statusSet = true
+	res.sendHeaders()
+	if res.httpReq.Method != http.MethodHead {
+		res.httpResp.Write([]byte(body))
+	}
+
+	return goja.Undefined()
+}
+
+// implement Response.sendStatus(statusCode) of Express.js
+func (res *contextResponse) sendStatus(fc goja.FunctionCall) goja.Value {
+	res.status(fc)
+
+	if res.statusCode == http.StatusNoContent || res.statusCode == http.StatusNotModified {
+		// no body is allowed
+		res.sendHeaders()
+		return goja.Undefined()
+	}
+
+	body := http.StatusText(res.statusCode)
+	res.setType("txt")
+	res.httpResp.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	res.sendHeaders()
+	if res.httpReq.Method != http.MethodHead {
+		res.httpResp.Write([]byte(body))
+	}
+
+	return goja.Undefined()
+}
+
+// implement Response.attachment([filename]) of Express.js (chainable)
+func (res *contextResponse) attachment(fc goja.FunctionCall) goja.Value {
+	if res.responseSent {
+		panic(res.vm.NewTypeError("response already sent"))
+	}
+
+	disposition := "attachment"
+	if filename := fc.Argument(0); !goja.IsUndefined(filename) {
+		name := path.Base(filename.String())
+		if ext := path.Ext(name); ext != "" {
+			res.setType(ext)
+		}
+		disposition = contentDisposition(name)
+	}
+	res.httpResp.Header().Set("Content-Disposition", disposition)
+	return res.nativeRes
+}
+
+// contentDisposition quotes an ASCII filename, and adds filename* for others
+// with an ASCII fallback, like the content-disposition package
+func contentDisposition(name string) string {
+	ascii := true
+	var fallback strings.Builder
+	for _, r := range name {
+		if r < 0x20 || r > 0x7e {
+			ascii = false
+			fallback.WriteByte('?')
+			continue
+		}
+		fallback.WriteRune(r)
+	}
+
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	if ascii && !strings.Contains(name, "%") {
+		return `attachment; filename="` + quote.Replace(name) + `"`
+	}
+
+	encoded := encodeURIComponent(name)
+	encoded = strings.NewReplacer("'", "%27", "(", "%28", ")", "%29", "*", "%2A").Replace(encoded)
+	return `attachment; filename="` + quote.Replace(fallback.String()) + `"; filename*=UTF-8''` + encoded
+}
+
+// implement Response.links(links) of Express.js (chainable)
+func (res *contextResponse) links(fc goja.FunctionCall) goja.Value {
+	if res.responseSent {
+		panic(res.vm.NewTypeError("response already sent"))
+	}
+
+	arg := fc.Argument(0)
+	if goja.IsUndefined(arg) || goja.IsNull(arg) {
+		panic(res.vm.NewTypeError("invalid undefined argument"))
+	}
+	obj := arg.ToObject(res.vm)
+
+	var links []string
+	if current := res.httpResp.Header().Get("Link"); current != "" {
+		links = append(links, current)
+	}
+	for _, rel := range obj.Keys() {
+		for _, u := range headerValues(res.vm, obj.Get(rel)) {
+			links = append(links, "<"+u+">; rel=\""+rel+"\"")
+		}
+	}
+	res.httpResp.Header().Set("Link", strings.Join(links, ", "))
+	return res.nativeRes
+}
+
+// implement Response.format(object) of Express.js (chainable). Without an
+// acceptable type or default, a 406 error is thrown.
+func (res *contextResponse) format(fc goja.FunctionCall) goja.Value {
+	if res.responseSent {
+		panic(res.vm.NewTypeError("response already sent"))
+	}
+
+	arg := fc.Argument(0)
+	if goja.IsUndefined(arg) || goja.IsNull(arg) {
+		panic(res.vm.NewTypeError("invalid undefined argument"))
+	}
+	obj := arg.ToObject(res.vm)
+
+	var keys []string
+	for _, k := range obj.Keys() {
+		if k != "default" {
+			keys = append(keys, k)
+		}
+	}
+
+	res.addVary("Accept")
+
+	var handler goja.Value
+	if best := acceptsType(res.httpReq, keys); best >= 0 {
+		res.setHeader("Content-Type", res.vm.ToValue(lookupMime(keys[best])))
+		handler = obj.Get(keys[best])
+	} else if def := obj.Get("default"); def != nil && !goja.IsUndefined(def) {
+		handler = def
+	} else {
+		types := make([]any, len(keys))
+		for i, k := range keys {
+			types[i] = lookupMime(k)
+		}
+		err := res.vm.NewGoError(errors.New("Not Acceptable"))
+		err.Set("status", http.StatusNotAcceptable)
+		err.Set("statusCode", http.StatusNotAcceptable)
+		err.Set("types", res.vm.NewArray(types...))
+		panic(err)
+	}
+
+	fn, ok := goja.AssertFunction(handler)
+	if !ok {
+		panic(res.vm.NewTypeError("res.format: expecting functions as values"))
+	}
+	next := res.layerNext
+	if next == nil {
+		next = res.RequestContext.Get("next")
+	}
+	if _, err := fn(obj, res.RequestContext.Get("req"), res.nativeRes, next); err != nil {
+		panic(err)
+	}
+
+	return res.nativeRes
+}
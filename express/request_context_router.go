@@ -0,0 +1,276 @@
+package express
+
+import (
+	"net/http"
+	neturl "net/url"
+	"reflect"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// WithRouter dispatches the request to the routes of r, see Dispatch
+func (ctx *RequestContext) WithRouter(r *Router) *RequestContext {
+	ctx.router = r
+
+	return ctx
+}
+
+// Dispatch returns the handler to invoke in place of the handler registered
+// with registerExpressHandler when a router is used
+func (ctx *RequestContext) Dispatch() goja.Value {
+	return ctx.nativeDispatch
+}
+
+func (ctx *RequestContext) getNativeDispatcher() goja.Value {
+	return ctx.vm.ToValue(func(fc goja.FunctionCall) goja.Value {
+		if ctx.bodyError != nil {
+			// body-parser passes its errors to next(err)
+			return ctx.runFrom(0, -1, false, ctx.bodyErrorVM(ctx.bodyError))
+		}
+		return ctx.runFrom(0, -1, false, nil)
+	})
+}
+
+// layerContext is the context object passed to a handler of the router. It
+// is the RequestContext, except for next, which continues from that handler.
+type layerContext struct {
+	*RequestContext
+	next goja.Value
+}
+
+var _ goja.DynamicObject = (*layerContext)(nil)
+
+func (c *layerContext) Get(key string) goja.Value {
+	if key == "next" {
+		return c.next
+	}
+	return c.RequestContext.Get(key)
+}
+
+// contextOf returns the RequestContext of a context object passed to handlers
+func contextOf(v goja.Value) (*RequestContext, bool) {
+	obj, ok := v.(*goja.Object)
+	if !ok {
+		return nil, false
+	}
+	switch obj.ExportType() {
+	case reflect.TypeOf((*RequestContext)(nil)):
+		return obj.Export().(*RequestContext), true
+	case reflect.TypeOf((*layerContext)(nil)):
+		return obj.Export().(*layerContext).RequestContext, true
+	}
+	return nil, false
+}
+
+// runFrom invokes the first matching handler starting at layer start, and
+// returns a Promise settling after the handler, and the handlers it passed
+// the request to with next(), have settled. If err is not nil, only error
+// handlers are invoked, and the Promise rejects with err if none matches.
+func (ctx *RequestContext) runFrom(start, skipRoute int, routed bool, err goja.Value) goja.Value {
+	promise, resolve, reject := ctx.vm.NewPromise()
+
+	r := ctx.httpReq
+	path := r.URL.EscapedPath()
+	for i := start; i < len(ctx.router.layers); i++ {
+		l := ctx.router.layers[i]
+		if l.onError != (err != nil) || l.route == skipRoute || !l.matchMethod(r.Method) {
+			continue
+		}
+		m, ok := l.match(path)
+		if !ok {
+			continue
+		}
+		if !l.prefix {
+			routed = true
+		}
+		ctx.enterLayer(l, m)
+		ctx.invokeLayer(i, l, routed, err, resolve, reject)
+		return ctx.vm.ToValue(promise)
+	}
+
+	if err != nil {
+		ctx.leaveLayer()
+		reject(err)
+		return ctx.vm.ToValue(promise)
+	}
+	resolve(ctx.routeDone(path, routed))
+	return ctx.vm.ToValue(promise)
+}
+
+func (ctx *RequestContext) invokeLayer(i int, l *layer, routed bool, handlerErr goja.Value, resolve, reject func(any)) {
+	var (
+		nextResult goja.Value
+		settled    bool
+	)
+
+	next := ctx.vm.ToValue(func(fc goja.FunctionCall) goja.Value {
+		if settled {
+			promise, _, rejectNext := ctx.vm.NewPromise()
+			rejectNext(ctx.vm.NewTypeError("next() must be called before the handler settles"))
+			return ctx.vm.ToValue(promise)
+		}
+		if nextResult != nil {
+			return nextResult
+		}
+
+		arg := fc.Argument(0)
+		signal, _ := arg.Export().(string)
+		switch {
+		case goja.IsUndefined(arg) || goja.IsNull(arg):
+			nextResult = ctx.runFrom(i+1, -1, routed, nil)
+		case signal == "route":
+			// skip the remaining handlers of the route
+			skip := l.route
+			if l.prefix {
+				skip = -1
+			}
+			nextResult = ctx.runFrom(i+1, skip, routed, nil)
+		case signal == "router":
+			// skip the remaining routes
+			nextResult = ctx.runFrom(len(ctx.router.layers), -1, true, nil)
+		default:
+			// skip to the error handlers
+			nextResult = ctx.runFrom(i+1, -1, routed, arg)
+		}
+		return nextResult
+	})
+
+	// like req.next of Express.js, for res.format(); restored to the next of
+	// the outer handler once this one settles
+	outerNext := ctx.layerNext
+	ctx.layerNext = next
+	leave := func() {
+		if ctx.layerNext == next {
+			ctx.layerNext = outerNext
+		}
+	}
+
+	// an error of a handler not calling next() is passed to the error
+	// handlers, like next(err)
+	fail := func(err goja.Value) {
+		settled = true
+		leave()
+		if nextResult != nil {
+			reject(err)
+			return
+		}
+		resolve(ctx.runFrom(i+1, -1, routed, err))
+	}
+
+	nativeCtx := ctx.vm.NewDynamicObject(&layerContext{RequestContext: ctx, next: next})
+	var (
+		result goja.Value
+		err    error
+	)
+	if l.onError {
+		result, err = l.handler(goja.Undefined(), handlerErr, nativeCtx)
+	} else {
+		result, err = l.handler(goja.Undefined(), nativeCtx)
+	}
+	if err != nil {
+		if ex, ok := err.(*goja.Exception); ok {
+			fail(ex.Value())
+		} else {
+			fail(ctx.vm.NewGoError(err))
+		}
+		return
+	}
+
+	if err := ctx.deps.Resolver.NewPromiseResultVM(
+		ctx.vm,
+		result,
+		ctx.vm.ToValue(func(fc goja.FunctionCall) goja.Value {
+			settled = true
+			leave()
+			if nextResult != nil {
+				resolve(nextResult)
+			} else {
+				resolve(goja.Undefined())
+			}
+			return goja.Undefined()
+		}),
+		ctx.vm.ToValue(func(fc goja.FunctionCall) goja.Value {
+			fail(fc.Argument(0))
+			return goja.Undefined()
+		}),
+	); err != nil {
+		settled = true
+		leave()
+		reject(ctx.vm.NewGoError(err))
+	}
+}
+
+// enterLayer sets req.params, and req.baseUrl, req.path and req.url
+// relative to the prefix of app.use()
+func (ctx *RequestContext) enterLayer(l *layer, m layerMatch) {
+	ctx.Get("req")
+	properties := ctx.requestProxy.nativeReqProperties
+
+	params := ctx.vm.NewObject()
+	for _, p := range m.params {
+		params.Set(p[0], p[1])
+	}
+	properties["params"] = params
+
+	if !l.prefix {
+		ctx.leaveLayer()
+		return
+	}
+
+	url := m.path
+	if q := ctx.httpReq.URL.RawQuery; q != "" {
+		url += "?" + q
+	}
+	properties["baseUrl"] = ctx.vm.ToValue(m.base)
+	// decoded like req.path without a prefix
+	path := m.path
+	if p, err := neturl.PathUnescape(path); err == nil {
+		path = p
+	}
+	properties["path"] = ctx.vm.ToValue(path)
+	properties["url"] = ctx.vm.ToValue(url)
+}
+
+func (ctx *RequestContext) leaveLayer() {
+	if ctx.requestProxy == nil {
+		return
+	}
+	for _, key := range []string{"baseUrl", "path", "url"} {
+		delete(ctx.requestProxy.nativeReqProperties, key)
+	}
+}
+
+// routeDone concludes the routes. If routes match the path with other
+// methods only, it responds with 405, or the allowed methods to OPTIONS.
+// Otherwise the request is passed to the next handler.
+func (ctx *RequestContext) routeDone(path string, routed bool) goja.Value {
+	ctx.leaveLayer()
+
+	if ctx.responseSent || ctx.nextInvoked {
+		return goja.Undefined()
+	}
+
+	if !routed {
+		if allowed := ctx.router.allowed(path); len(allowed) > 0 {
+			allow := strings.Join(allowed, ",")
+			status, body := http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed)
+			if ctx.httpReq.Method == http.MethodOptions {
+				status, body = http.StatusOK, allow
+			}
+
+			header := ctx.httpResp.Header()
+			header.Set("Allow", allow)
+			header.Set("Content-Type", "text/plain; charset=utf-8")
+			header.Set("X-Content-Type-Options", "nosniff")
+			ctx.httpResp.WriteHeader(status)
+			if ctx.httpReq.Method != http.MethodHead {
+				ctx.httpResp.Write([]byte(body))
+			}
+			ctx.responseSent = true
+			return goja.Undefined()
+		}
+	}
+
+	return ctx.next(goja.FunctionCall{})
+}
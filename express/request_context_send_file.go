@@ -0,0 +1,396 @@
+package express
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.miragespace.co/heresy/extensions/errorpage"
+
+	"github.com/dop251/goja"
+	"go.uber.org/zap"
+)
+
+// fileOptions are the options of res.sendFile() and express.static(), which
+// follow the send package of Express.js
+type fileOptions struct {
+	root         string
+	maxAge       time.Duration
+	immutable    bool
+	cacheControl bool
+	lastModified bool
+	etag         bool
+	acceptRanges bool
+	dotfiles     string
+	headers      map[string]string
+	index        string
+	redirect     bool
+	fallThrough  bool
+}
+
+func defaultFileOptions() fileOptions {
+	return fileOptions{
+		cacheControl: true,
+		lastModified: true,
+		etag:         true,
+		acceptRanges: true,
+		dotfiles:     "ignore",
+		index:        "index.html",
+		redirect:     true,
+		fallThrough:  true,
+	}
+}
+
+func parseFileOptions(vm *goja.Runtime, options goja.Value, opts *fileOptions) error {
+	if goja.IsUndefined(options) || goja.IsNull(options) {
+		return nil
+	}
+	obj := options.ToObject(vm)
+
+	for _, key := range obj.Keys() {
+		v := obj.Get(key)
+		switch key {
+		case "root":
+			opts.root = v.String()
+		case "maxAge":
+			d, err := parseMaxAge(v)
+			if err != nil {
+				return err
+			}
+			opts.maxAge = d
+		case "immutable":
+			opts.immutable = v.ToBoolean()
+		case "cacheControl":
+			opts.cacheControl = v.ToBoolean()
+		case "lastModified":
+			opts.lastModified = v.ToBoolean()
+		case "etag":
+			opts.etag = v.ToBoolean()
+		case "acceptRanges":
+			opts.acceptRanges = v.ToBoolean()
+		case "dotfiles":
+			switch s := v.String(); s {
+			case "allow", "deny", "ignore":
+				opts.dotfiles = s
+			default:
+				return fmt.Errorf("dotfiles must be allow, deny or ignore, got %q", s)
+			}
+		case "headers":
+			if err := vm.ExportTo(v, &opts.headers); err != nil {
+				return fmt.Errorf("headers: %w", err)
+			}
+		case "index":
+			if b, ok := v.Export().(bool); ok && !b {
+				// index: false disables the index
+				opts.index = ""
+			} else {
+				opts.index = v.String()
+			}
+		case "redirect":
+			opts.redirect = v.ToBoolean()
+		case "fallthrough":
+			opts.fallThrough = v.ToBoolean()
+		default:
+			return fmt.Errorf("unknown option %q", key)
+		}
+	}
+	return nil
+}
+
+var maxAgeUnits = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+	"y":  365 * 24 * time.Hour,
+}
+
+// parseMaxAge accepts milliseconds, or a string such as "1d" or "2h"
+func parseMaxAge(v goja.Value) (time.Duration, error) {
+	if s, ok := v.Export().(string); ok {
+		s = strings.TrimSpace(strings.ToLower(s))
+		i := strings.IndexFunc(s, func(r rune) bool {
+			return (r < '0' || r > '9') && r != '.'
+		})
+		unit := "ms"
+		if i >= 0 {
+			s, unit = s[:i], strings.TrimSpace(s[i:])
+		}
+		n, err := strconv.ParseFloat(s, 64)
+		scale, ok := maxAgeUnits[unit]
+		if err != nil || !ok || n < 0 {
+			return 0, fmt.Errorf("invalid maxAge %q", v.String())
+		}
+		return time.Duration(n * float64(scale)), nil
+	}
+	n := v.ToInteger()
+	if n < 0 {
+		return 0, fmt.Errorf("invalid maxAge %d", n)
+	}
+	return time.Duration(n) * time.Millisecond, nil
+}
+
+// errorVM returns an Error with status and statusCode, so the error handler
+// responds with the status
+func (ctx *RequestContext) errorVM(status int, message string) *goja.Object {
+	err := ctx.vm.NewGoError(&errorpage.HTTPError{
+		Status: status,
+		Err:    errors.New(message),
+	})
+	err.Set("status", status)
+	err.Set("statusCode", status)
+	return err
+}
+
+// implement Response.sendFile(path [, options]) of Express.js. Files are
+// served from the fs.FS configured on the Runtime, relative to its root or
+// to options.root. A missing file throws an error with status 404.
+func (res *contextResponse) sendFile(fc goja.FunctionCall) goja.Value {
+	if res.responseSent {
+		panic(res.vm.NewTypeError("response already sent"))
+	}
+
+	name := fc.Argument(0)
+	if goja.IsUndefined(name) || goja.IsNull(name) {
+		panic(res.vm.NewTypeError("path argument is required to res.sendFile"))
+	}
+
+	opts := defaultFileOptions()
+	opts.index = ""
+	opts.redirect = false
+	if err := parseFileOptions(res.vm, fc.Argument(1), &opts); err != nil {
+		panic(res.vm.NewTypeError("res.sendFile: " + err.Error()))
+	}
+
+	if status := res.serveFile(name.String(), opts); status != 0 {
+		panic(res.errorVM(status, http.StatusText(status)))
+	}
+	return goja.Undefined()
+}
+
+// serveFile sends the file name, and returns the status of the error if it
+// cannot be sent. The body is written off the loop by http.ServeContent,
+// which handles Range and conditional requests.
+func (res *contextResponse) serveFile(name string, opts fileOptions) int {
+	assets := res.deps.Assets
+	if assets == nil {
+		panic(res.vm.NewTypeError("no assets are configured on the runtime"))
+	}
+
+	for _, segment := range strings.Split(name, "/") {
+		if segment == ".." {
+			// malicious path
+			return http.StatusForbidden
+		}
+	}
+
+	p := strings.TrimPrefix(path.Join("/", opts.root, name), "/")
+	if p == "" {
+		p = "."
+	}
+	if !fs.ValidPath(p) {
+		return http.StatusNotFound
+	}
+	// only the requested name is subject to dotfiles, not the root
+	for _, segment := range strings.Split(name, "/") {
+		if !strings.HasPrefix(segment, ".") || segment == "." {
+			continue
+		}
+		switch opts.dotfiles {
+		case "deny":
+			return http.StatusForbidden
+		case "ignore":
+			return http.StatusNotFound
+		}
+	}
+
+	f, info, status := openFile(assets, p)
+	if status != 0 {
+		return status
+	}
+
+	if info.IsDir() {
+		f.Close()
+		if opts.redirect && !strings.HasSuffix(name, "/") {
+			// collapse leading slashes, so //evil.com/ is not a host
+			loc := "/" + strings.TrimLeft(res.httpReq.URL.EscapedPath(), "/") + "/"
+			if loc == "//" {
+				loc = "/"
+			}
+			if q := res.httpReq.URL.RawQuery; q != "" {
+				loc += "?" + q
+			}
+			res.redirect(goja.FunctionCall{Arguments: []goja.Value{
+				res.vm.ToValue(http.StatusMovedPermanently),
+				res.vm.ToValue(loc),
+			}})
+			return 0
+		}
+		if opts.index == "" {
+			return http.StatusNotFound
+		}
+		p = path.Join(p, opts.index)
+		if f, info, status = openFile(assets, p); status != 0 {
+			return status
+		}
+		if info.IsDir() {
+			f.Close()
+			return http.StatusNotFound
+		}
+	}
+
+	header := res.httpResp.Header()
+	if opts.cacheControl && header.Get("Cache-Control") == "" {
+		cacheControl := "public, max-age=" + strconv.FormatInt(int64(opts.maxAge/time.Second), 10)
+		if opts.immutable {
+			cacheControl += ", immutable"
+		}
+		header.Set("Cache-Control", cacheControl)
+	}
+	if opts.etag && header.Get("ETag") == "" {
+		header.Set("ETag", `W/"`+strconv.FormatInt(info.Size(), 16)+"-"+
+			strconv.FormatInt(info.ModTime().UnixMilli(), 16)+`"`)
+	}
+	if header.Get("Content-Type") == "" {
+		contentType := lookupMime(path.Ext(p))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header.Set("Content-Type", withCharset(contentType))
+	}
+	for k, v := range opts.headers {
+		header.Set(k, v)
+	}
+
+	var modtime time.Time
+	if opts.lastModified {
+		modtime = info.ModTime()
+	}
+
+	r := res.httpReq
+	if !opts.acceptRanges {
+		r = r.Clone(r.Context())
+		r.Header.Del("Range")
+		r.Header.Del("If-Range")
+	}
+
+	res.responseSent = true
+	res.statusSet = true
+
+	done := make(chan struct{})
+	res.writerDone = done
+	go func() {
+		defer close(done)
+		defer f.Close()
+
+		if rs, ok := f.(io.ReadSeeker); ok {
+			http.ServeContent(res.httpResp, r, p, modtime, rs)
+			return
+		}
+
+		// without Seek, Range is not supported
+		if !modtime.IsZero() {
+			header.Set("Last-Modified", modtime.UTC().Format(http.TimeFormat))
+		}
+		if res.fresh() {
+			header.Del("Content-Type")
+			res.httpResp.WriteHeader(http.StatusNotModified)
+			return
+		}
+		header.Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+		res.httpResp.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodHead {
+			return
+		}
+		if _, err := io.Copy(res.httpResp, f); err != nil {
+			res.deps.Logger.Error("Error writing response", zap.Error(err))
+		}
+	}()
+
+	return 0
+}
+
+func openFile(assets fs.FS, p string) (fs.File, fs.FileInfo, int) {
+	f, err := assets.Open(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, http.StatusNotFound
+		}
+		if errors.Is(err, fs.ErrPermission) {
+			return nil, nil, http.StatusForbidden
+		}
+		return nil, nil, http.StatusInternalServerError
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, http.StatusInternalServerError
+	}
+	return f, info, 0
+}
+
+// NewStaticVM implements express.static(root [, options]), a handler serving
+// the files under root of the fs.FS configured on the Runtime. Requests for
+// missing files, and other than GET or HEAD, are passed to next().
+func NewStaticVM(vm *goja.Runtime, fc goja.FunctionCall) goja.Value {
+	root := fc.Argument(0)
+	if goja.IsUndefined(root) || goja.IsNull(root) {
+		panic(vm.NewTypeError("root path required"))
+	}
+
+	opts := defaultFileOptions()
+	if err := parseFileOptions(vm, fc.Argument(1), &opts); err != nil {
+		panic(vm.NewTypeError("express.static: " + err.Error()))
+	}
+	opts.root = path.Join(root.String(), opts.root)
+
+	return vm.ToValue(func(fc goja.FunctionCall) goja.Value {
+		ctx, ok := contextOf(fc.Argument(0))
+		if !ok {
+			panic(vm.NewTypeError("express.static: expecting the context of an Express.js style handler"))
+		}
+		// next of the router is specific to the handler
+		next, _ := goja.AssertFunction(fc.Argument(0).ToObject(vm).Get("next"))
+
+		r := ctx.httpReq
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			if !opts.fallThrough {
+				ctx.httpResp.Header().Set("Allow", "GET, HEAD")
+				panic(ctx.errorVM(http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed)))
+			}
+			result, err := next(goja.Undefined())
+			if err != nil {
+				panic(err)
+			}
+			return result
+		}
+
+		name := ctx.Get("req").ToObject(vm).Get("path").String()
+		if name == "/" && !strings.HasSuffix(r.URL.Path, "/") {
+			// redirect the mount point to the directory
+			name = ""
+		}
+		ctx.Get("res")
+		status := ctx.responseProxy.serveFile(name, opts)
+		switch {
+		case status == 0:
+			return goja.Undefined()
+		case status == http.StatusNotFound && opts.fallThrough:
+			result, err := next(goja.Undefined())
+			if err != nil {
+				panic(err)
+			}
+			return result
+		default:
+			panic(ctx.errorVM(status, http.StatusText(status)))
+		}
+	})
+}
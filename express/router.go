@@ -0,0 +1,365 @@
+package express
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// Router matches requests against the routes of an app created with
+// express(), compiled when the routes are registered:
+//
+//	const app = express()
+//	app.use("/api", auth)
+//	app.get("/users/:id", async ({ req, res }) => res.json({ id: req.params.id }))
+//	registerExpressApp(app)
+//
+// Like registerExpressHandler, handlers receive the context. next() invokes
+// the next matching handler, and the next handler in Go after the last one.
+// Handlers taking two arguments handle errors, as the four arguments of
+// Express.js: next(err), or a handler throwing, skips to them.
+//
+//	app.use((err, { req, res, next }) => res.status(err.status || 500).send(err.message))
+type Router struct {
+	layers []*layer
+	routes int
+}
+
+type layer struct {
+	method  string // empty for app.use() and app.all()
+	prefix  bool   // app.use() matches path prefixes
+	root    bool   // app.use("/") matches any path
+	re      *regexp.Regexp
+	keys    []string
+	handler goja.Callable
+	onError bool // handles errors, as (err, ctx)
+	route   int  // handlers of the same call share the route
+}
+
+type layerMatch struct {
+	params [][2]string
+	base   string
+	path   string
+}
+
+var routerMethods = []string{"get", "post", "put", "delete", "patch", "head", "options"}
+
+// NewRouterVM returns the app object of express()
+func NewRouterVM(vm *goja.Runtime) *goja.Object {
+	r := &Router{}
+	app := vm.NewObject()
+
+	register := func(method string, prefix bool) func(fc goja.FunctionCall) goja.Value {
+		return func(fc goja.FunctionCall) goja.Value {
+			args := fc.Arguments
+			path := "/"
+			if len(args) > 0 {
+				if _, ok := goja.AssertFunction(args[0]); !ok && !isArray(args[0]) {
+					path = args[0].String()
+					args = args[1:]
+				}
+			}
+			if err := r.add(vm, method, path, prefix, args); err != nil {
+				panic(vm.NewTypeError(err.Error()))
+			}
+			return app
+		}
+	}
+
+	for _, m := range routerMethods {
+		app.Set(m, register(strings.ToUpper(m), false))
+	}
+	app.Set("all", register("", false))
+	app.Set("use", register("", true))
+	app.DefineDataProperty("_router", vm.ToValue(r), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+
+	return app
+}
+
+// AssertRouter returns the Router of an app created with express()
+func AssertRouter(app goja.Value, vm *goja.Runtime) (*Router, bool) {
+	if app == nil || goja.IsUndefined(app) || goja.IsNull(app) {
+		return nil, false
+	}
+	native := app.ToObject(vm).Get("_router")
+	if native == nil {
+		return nil, false
+	}
+	r, ok := native.Export().(*Router)
+	return r, ok
+}
+
+func isArray(v goja.Value) bool {
+	obj, ok := v.(*goja.Object)
+	return ok && obj.ClassName() == "Array"
+}
+
+func (r *Router) add(vm *goja.Runtime, method, path string, prefix bool, args []goja.Value) error {
+	var handlers []layer
+	addHandler := func(v goja.Value) error {
+		fn, ok := goja.AssertFunction(v)
+		if !ok {
+			return fmt.Errorf("app.%s(%q): handlers must be functions", strings.ToLower(method), path)
+		}
+		handlers = append(handlers, layer{
+			handler: fn,
+			onError: v.ToObject(vm).Get("length").ToInteger() == 2,
+		})
+		return nil
+	}
+	for _, arg := range args {
+		if isArray(arg) {
+			obj := arg.ToObject(vm)
+			for _, k := range obj.Keys() {
+				if err := addHandler(obj.Get(k)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := addHandler(arg); err != nil {
+			return err
+		}
+	}
+	if len(handlers) == 0 {
+		return fmt.Errorf("app.%s(%q): requires a handler", strings.ToLower(method), path)
+	}
+
+	l := layer{
+		method: method,
+		prefix: prefix,
+		root:   prefix && strings.Trim(path, "/") == "",
+		route:  r.routes,
+	}
+	if !l.root {
+		re, keys, err := compilePath(path, !prefix)
+		if err != nil {
+			return fmt.Errorf("invalid path %q: %w", path, err)
+		}
+		l.re, l.keys = re, keys
+	}
+	r.routes++
+
+	for _, h := range handlers {
+		hl := l
+		hl.handler, hl.onError = h.handler, h.onError
+		r.layers = append(r.layers, &hl)
+	}
+	return nil
+}
+
+// compilePath compiles an Express.js route path, such as /users/:id,
+// /files/:name(\\w+\\.txt), /posts/:slug? or /assets/*. Paths are case
+// insensitive, and match with or without a trailing slash.
+func compilePath(path string, end bool) (*regexp.Regexp, []string, error) {
+	var (
+		b        strings.Builder
+		keys     []string
+		wildcard int
+	)
+	b.WriteString("(?i)^")
+
+	param := func(i int) (capture string, optional bool, next int, err error) {
+		// path[i] == ':'
+		j := i + 1
+		for j < len(path) && (path[j] == '_' || path[j] >= 'a' && path[j] <= 'z' ||
+			path[j] >= 'A' && path[j] <= 'Z' || path[j] >= '0' && path[j] <= '9') {
+			j++
+		}
+		if j == i+1 {
+			return "", false, 0, fmt.Errorf("missing parameter name at %d", i)
+		}
+		keys = append(keys, path[i+1:j])
+		capture = "[^/]+?"
+		if j < len(path) && path[j] == '(' {
+			depth := 0
+			inClass := false
+			k := j
+			for ; k < len(path); k++ {
+				switch c := path[k]; {
+				case c == '\\':
+					k++
+				case inClass:
+					inClass = c != ']'
+				case c == '[':
+					inClass = true
+				case c == '(':
+					depth++
+				case c == ')':
+					depth--
+				}
+				if depth == 0 {
+					break
+				}
+			}
+			if k >= len(path) {
+				return "", false, 0, fmt.Errorf("unbalanced parenthesis at %d", j)
+			}
+			capture = nonCapturing(path[j+1 : k])
+			j = k + 1
+		}
+		if j < len(path) && path[j] == '?' {
+			optional = true
+			j++
+		}
+		return capture, optional, j, nil
+	}
+
+	for i := 0; i < len(path); {
+		c := path[i]
+		switch {
+		case c == '/' && i+1 < len(path) && path[i+1] == ':':
+			capture, optional, next, err := param(i + 1)
+			if err != nil {
+				return nil, nil, err
+			}
+			if optional {
+				b.WriteString("(?:/(" + capture + "))?")
+			} else {
+				b.WriteString("/(" + capture + ")")
+			}
+			i = next
+		case c == ':':
+			capture, optional, next, err := param(i)
+			if err != nil {
+				return nil, nil, err
+			}
+			b.WriteString("(" + capture + ")")
+			if optional {
+				b.WriteString("?")
+			}
+			i = next
+		case c == '*':
+			keys = append(keys, strconv.Itoa(wildcard))
+			wildcard++
+			b.WriteString("(.*)")
+			i++
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+			i++
+		}
+	}
+
+	if end {
+		if !strings.HasSuffix(path, "/") {
+			b.WriteString("/")
+		}
+		b.WriteString("?$")
+	}
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	return re, keys, nil
+}
+
+// nonCapturing rewrites the groups of a custom parameter pattern, such as
+// :id((a|b)\\d+), as non-capturing, so they do not shift the parameters
+func nonCapturing(pattern string) string {
+	var b strings.Builder
+	inClass := false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\' && i+1 < len(pattern):
+			b.WriteByte(c)
+			i++
+			c = pattern[i]
+		case inClass:
+			inClass = c != ']'
+		case c == '[':
+			inClass = true
+		case c == '(' && (i+1 >= len(pattern) || pattern[i+1] != '?'):
+			b.WriteString("(?:")
+			continue
+		case strings.HasPrefix(pattern[i:], "(?P<") || strings.HasPrefix(pattern[i:], "(?<"):
+			// named groups capture as well
+			if end := strings.IndexByte(pattern[i:], '>'); end > 0 {
+				b.WriteString("(?:")
+				i += end
+				continue
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+func (l *layer) matchMethod(method string) bool {
+	return l.method == "" || l.method == method ||
+		(method == http.MethodHead && l.method == http.MethodGet)
+}
+
+// match matches the escaped path of a request
+func (l *layer) match(path string) (layerMatch, bool) {
+	if l.root {
+		return layerMatch{path: path}, true
+	}
+
+	m := l.re.FindStringSubmatchIndex(path)
+	if m == nil {
+		return layerMatch{}, false
+	}
+
+	matched := path[:m[1]]
+	if l.prefix {
+		// app.use() matches whole segments only
+		rest := path[m[1]:]
+		if rest != "" && rest[0] != '/' && !strings.HasSuffix(matched, "/") {
+			return layerMatch{}, false
+		}
+	}
+
+	result := layerMatch{path: path}
+	for i, key := range l.keys {
+		start, end := m[2*i+2], m[2*i+3]
+		if start < 0 {
+			continue
+		}
+		value := path[start:end]
+		if v, err := url.PathUnescape(value); err == nil {
+			value = v
+		}
+		result.params = append(result.params, [2]string{key, value})
+	}
+
+	if l.prefix {
+		result.base = strings.TrimSuffix(matched, "/")
+		result.path = path[len(result.base):]
+		if result.path == "" {
+			result.path = "/"
+		}
+	}
+	return result, true
+}
+
+// allowed lists the methods of routes matching path, for 405 responses and
+// OPTIONS requests
+func (r *Router) allowed(path string) []string {
+	seen := map[string]bool{}
+	for _, l := range r.layers {
+		if l.prefix || l.method == "" {
+			continue
+		}
+		if _, ok := l.match(path); !ok {
+			continue
+		}
+		seen[l.method] = true
+		if l.method == http.MethodGet {
+			seen[http.MethodHead] = true
+		}
+	}
+	methods := make([]string, 0, len(seen))
+	for m := range seen {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	return methods
+}
@@ -0,0 +1,187 @@
+package express
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dop251/goja"
+)
+
+// testLayer compiles a route the way app.get(path) or app.use(path) does
+func testLayer(t *testing.T, path string, prefix bool) *layer {
+	t.Helper()
+	vm := goja.New()
+	r := &Router{}
+	if err := r.add(vm, "", path, prefix, []goja.Value{vm.ToValue(func() {})}); err != nil {
+		t.Fatalf("add(%q): %v", path, err)
+	}
+	return r.layers[0]
+}
+
+func TestCompilePath(t *testing.T) {
+	for _, tc := range []struct {
+		path   string
+		url    string
+		params [][2]string
+		ok     bool
+	}{
+		{"/users/:id", "/users/42", [][2]string{{"id", "42"}}, true},
+		{"/users/:id", "/users/42/", [][2]string{{"id", "42"}}, true},
+		{"/users/:id", "/USERS/42", [][2]string{{"id", "42"}}, true},
+		{"/users/:id", "/users", nil, false},
+		{"/users/:id", "/users/42/posts", nil, false},
+		{"/users/:id", "/users/a%20b", [][2]string{{"id", "a b"}}, true},
+		{"/posts/:slug?", "/posts", nil, true},
+		{"/posts/:slug?", "/posts/hello", [][2]string{{"slug", "hello"}}, true},
+		{"/files/:name(\\w+\\.txt)", "/files/a.txt", [][2]string{{"name", "a.txt"}}, true},
+		{"/files/:name(\\w+\\.txt)", "/files/a.png", nil, false},
+		{"/:from-:to", "/a-b", [][2]string{{"from", "a"}, {"to", "b"}}, true},
+		{"/assets/*", "/assets/css/site.css", [][2]string{{"0", "css/site.css"}}, true},
+		{"/a.b", "/axb", nil, false},
+	} {
+		got, ok := testLayer(t, tc.path, false).match(tc.url)
+		if ok != tc.ok {
+			t.Errorf("%q matching %q = %v, want %v", tc.path, tc.url, ok, tc.ok)
+			continue
+		}
+		if ok && !reflect.DeepEqual(got.params, tc.params) {
+			t.Errorf("%q matching %q: params = %v, want %v", tc.path, tc.url, got.params, tc.params)
+		}
+	}
+}
+
+func TestCompilePathGroups(t *testing.T) {
+	// groups of a pattern must not shift the parameters after it
+	for _, tc := range []struct {
+		path   string
+		url    string
+		params [][2]string
+	}{
+		{"/:id((a|b)\\d+)/:rest", "/a1/x", [][2]string{{"id", "a1"}, {"rest", "x"}}},
+		{"/:id((?P<kind>a|b)\\d+)/:rest", "/b2/y", [][2]string{{"id", "b2"}, {"rest", "y"}}},
+		{"/:id([(]\\(x\\))/:rest", "/((x)/z", [][2]string{{"id", "((x)"}, {"rest", "z"}}},
+	} {
+		got, ok := testLayer(t, tc.path, false).match(tc.url)
+		if !ok {
+			t.Errorf("%q did not match %q", tc.path, tc.url)
+			continue
+		}
+		if !reflect.DeepEqual(got.params, tc.params) {
+			t.Errorf("%q matching %q: params = %v, want %v", tc.path, tc.url, got.params, tc.params)
+		}
+	}
+}
+
+func TestCompilePathErrors(t *testing.T) {
+	for _, path := range []string{"/users/:", "/files/:name(\\w+", "/:id([)"} {
+		if _, _, err := compilePath(path, true); err == nil {
+			t.Errorf("compilePath(%q): expected an error", path)
+		}
+	}
+}
+
+func TestNonCapturing(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		want    string
+	}{
+		{"a|b", "a|b"},
+		{"(a|b)\\d+", "(?:a|b)\\d+"},
+		{"(?:a)(b)", "(?:a)(?:b)"},
+		{"(?P<x>a)(?<y>b)", "(?:a)(?:b)"},
+		{"\\(a\\)", "\\(a\\)"},
+		{"[(]a", "[(]a"},
+		{"(?i)a", "(?i)a"},
+	} {
+		if got := nonCapturing(tc.pattern); got != tc.want {
+			t.Errorf("nonCapturing(%q) = %q, want %q", tc.pattern, got, tc.want)
+		}
+	}
+}
+
+func TestLayerPrefix(t *testing.T) {
+	l := testLayer(t, "/api", true)
+	for _, tc := range []struct {
+		url  string
+		base string
+		path string
+		ok   bool
+	}{
+		{"/api", "/api", "/", true},
+		{"/api/", "/api", "/", true},
+		{"/api/users", "/api", "/users", true},
+		{"/apis", "", "", false},
+		{"/other", "", "", false},
+	} {
+		got, ok := l.match(tc.url)
+		if ok != tc.ok {
+			t.Errorf("app.use(\"/api\") matching %q = %v, want %v", tc.url, ok, tc.ok)
+			continue
+		}
+		if ok && (got.base != tc.base || got.path != tc.path) {
+			t.Errorf("app.use(\"/api\") matching %q: base %q path %q, want %q %q", tc.url, got.base, got.path, tc.base, tc.path)
+		}
+	}
+
+	root := testLayer(t, "/", true)
+	if got, ok := root.match("/anything"); !ok || got.path != "/anything" {
+		t.Errorf("app.use(\"/\") matching /anything = %v, %v", got, ok)
+	}
+}
+
+func TestRouterLayers(t *testing.T) {
+	vm := goja.New()
+	app := NewRouterVM(vm)
+	vm.Set("app", app)
+	_, err := vm.RunString(`
+		app.use((ctx) => ctx.next())
+		app.get("/users/:id", (ctx) => {}, [(ctx) => {}, (ctx) => {}])
+		app.post("/users/:id", (ctx) => {})
+		app.use((err, ctx) => {})
+	`)
+	if err != nil {
+		t.Fatalf("RunString: %v", err)
+	}
+
+	r, ok := AssertRouter(app, vm)
+	if !ok {
+		t.Fatalf("AssertRouter: not a router")
+	}
+	if len(r.layers) != 6 {
+		t.Fatalf("expected 6 layers, got %d", len(r.layers))
+	}
+	for i, want := range []struct {
+		method  string
+		route   int
+		onError bool
+	}{
+		{"", 0, false},
+		{"GET", 1, false},
+		{"GET", 1, false},
+		{"GET", 1, false},
+		{"POST", 2, false},
+		{"", 3, true},
+	} {
+		l := r.layers[i]
+		if l.method != want.method || l.route != want.route || l.onError != want.onError {
+			t.Errorf("layer %d = %s route %d onError %v, want %s route %d onError %v",
+				i, l.method, l.route, l.onError, want.method, want.route, want.onError)
+		}
+	}
+
+	if got := r.allowed("/users/1"); !reflect.DeepEqual(got, []string{"GET", "HEAD", "POST"}) {
+		t.Errorf("allowed = %v", got)
+	}
+	if !r.layers[1].matchMethod("HEAD") || r.layers[4].matchMethod("GET") {
+		t.Errorf("GET routes must match HEAD, and only HEAD")
+	}
+
+	for _, script := range []string{`app.get("/x")`, `app.get("/x", 1)`, `app.get("/:", () => {})`} {
+		if _, err := vm.RunString(script); err == nil {
+			t.Errorf("%s: expected a TypeError", script)
+		}
+	}
+	if _, ok := AssertRouter(vm.NewObject(), vm); ok {
+		t.Errorf("AssertRouter: a plain object is not a router")
+	}
+}
@@ -0,0 +1,181 @@
+package express
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// viewExtensions are the files parsed as templates
+var viewExtensions = []string{".html", ".tmpl"}
+
+// Views are the html/template templates rendered by res.render(), named by
+// their path, such as "users/show.html". Templates under layouts/ and
+// partials/ are shared by every page, so a page can use a layout:
+//
+//	{{template "layouts/main.html" .}}
+//	{{define "content"}}<h1>{{.title}}</h1>{{end}}
+//
+// Each page is parsed separately, so pages can define the same blocks.
+type Views struct {
+	pages map[string]*template.Template
+}
+
+// NewViews parses the templates of fsys. It is called on every LoadScript,
+// so changes to the templates are reloaded with the script.
+func NewViews(fsys fs.FS) (*Views, error) {
+	var shared, pages []string
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isViewFile(p) {
+			return nil
+		}
+		if strings.HasPrefix(p, "layouts/") || strings.HasPrefix(p, "partials/") {
+			shared = append(shared, p)
+		} else {
+			pages = append(pages, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	base := template.New("")
+	for _, p := range shared {
+		if err := parseView(fsys, base, p); err != nil {
+			return nil, err
+		}
+	}
+
+	v := &Views{
+		pages: make(map[string]*template.Template, len(pages)+len(shared)),
+	}
+	for _, p := range shared {
+		v.pages[p] = base.Lookup(p)
+	}
+	for _, p := range pages {
+		t, err := base.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if err := parseView(fsys, t, p); err != nil {
+			return nil, err
+		}
+		v.pages[p] = t.Lookup(p)
+	}
+
+	return v, nil
+}
+
+func isViewFile(p string) bool {
+	for _, ext := range viewExtensions {
+		if strings.HasSuffix(p, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseView(fsys fs.FS, t *template.Template, p string) error {
+	b, err := fs.ReadFile(fsys, p)
+	if err != nil {
+		return err
+	}
+	if _, err := t.New(p).Parse(string(b)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// lookup finds the template of name, with or without the extension
+func (v *Views) lookup(name string) (*template.Template, bool) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if t, ok := v.pages[name]; ok {
+		return t, true
+	}
+	for _, ext := range viewExtensions {
+		if t, ok := v.pages[name+ext]; ok {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// implement Response.render(view [, locals] [, callback]) of Express.js.
+// res.locals and locals are passed to the template, and the HTML is sent as
+// text/html. With a callback, it is invoked with (err, html) instead.
+func (res *contextResponse) render(fc goja.FunctionCall) goja.Value {
+	name := fc.Argument(0)
+	if goja.IsUndefined(name) || goja.IsNull(name) {
+		panic(res.vm.NewTypeError("view argument is required to res.render"))
+	}
+
+	locals := fc.Argument(1)
+	callback, hasCallback := goja.AssertFunction(fc.Argument(2))
+	if fn, ok := goja.AssertFunction(locals); ok {
+		callback, hasCallback = fn, true
+		locals = goja.Undefined()
+	}
+
+	if !hasCallback && res.responseSent {
+		panic(res.vm.NewTypeError("response already sent"))
+	}
+
+	html, err := res.renderView(name.String(), locals)
+	if hasCallback {
+		var errValue goja.Value = goja.Null()
+		if err != nil {
+			errValue = res.vm.NewGoError(err)
+		}
+		if _, err := callback(goja.Undefined(), errValue, res.vm.ToValue(string(html))); err != nil {
+			panic(err)
+		}
+		return goja.Undefined()
+	}
+	if err != nil {
+		panic(res.vm.NewGoError(err))
+	}
+
+	if res.httpResp.Header().Get("Content-Type") == "" {
+		res.setType("html")
+	}
+	res.sendBuffered(html)
+	return goja.Undefined()
+}
+
+func (res *contextResponse) renderView(name string, locals goja.Value) ([]byte, error) {
+	views := res.deps.Views
+	if views == nil {
+		panic(res.vm.NewTypeError("no views are configured on the runtime"))
+	}
+
+	t, ok := views.lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("failed to lookup view %q", name)
+	}
+
+	data := map[string]any{}
+	for _, v := range []goja.Value{res.locals.NativeObject(res.httpReq), locals} {
+		if goja.IsUndefined(v) || goja.IsNull(v) {
+			continue
+		}
+		obj := v.ToObject(res.vm)
+		for _, k := range obj.Keys() {
+			data[k] = obj.Get(k).Export()
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
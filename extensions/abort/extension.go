@@ -0,0 +1,121 @@
+package abort
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja_nodejs/eventloop"
+)
+
+// AbortController installs AbortController and AbortSignal in the runtime,
+// and creates AbortSignals tied to the lifetime of a context.Context.
+type AbortController struct {
+	eventLoop     *eventloop.EventLoop
+	runtimeSignal goja.Callable
+}
+
+func NewController(eventLoop *eventloop.EventLoop) (*AbortController, error) {
+	a := &AbortController{
+		eventLoop: eventLoop,
+	}
+
+	setup := make(chan error, 1)
+	eventLoop.RunOnLoop(func(vm *goja.Runtime) {
+		_, err := vm.RunProgram(abortWrapperProg)
+		if err != nil {
+			setup <- err
+			return
+		}
+
+		helper := vm.Get(abortSignalSymbol)
+		fn, ok := goja.AssertFunction(helper)
+		if !ok {
+			setup <- fmt.Errorf("internal error: %s is not a function", abortSignalSymbol)
+			return
+		}
+		a.runtimeSignal = fn
+
+		setup <- nil
+	})
+
+	err := <-setup
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// NewSignalVM returns an AbortSignal that fires when ctx is done. stop must be
+// called once the signal is no longer relevant (e.g. the handler has concluded),
+// so normal completion of ctx will not fire the signal.
+func (a *AbortController) NewSignalVM(ctx context.Context, vm *goja.Runtime) (signal goja.Value, stop func()) {
+	ret, err := a.runtimeSignal(goja.Undefined())
+	if err != nil {
+		panic(fmt.Errorf("runtime panic: Failed to get native AbortSignal: %w", err))
+	}
+
+	obj := ret.ToObject(vm)
+	signal = obj.Get("signal")
+	abort, ok := goja.AssertFunction(obj.Get("abort"))
+	if !ok {
+		panic(fmt.Errorf("runtime panic: abort is not a function"))
+	}
+
+	var (
+		done = make(chan struct{})
+		once sync.Once
+	)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			a.eventLoop.RunOnLoop(func(*goja.Runtime) {
+				abort(goja.Undefined())
+			})
+		case <-done:
+		}
+	}()
+
+	stop = func() {
+		once.Do(func() {
+			close(done)
+		})
+	}
+
+	return
+}
+
+// OnAbort invokes fn on the event loop when signal is aborted. It returns
+// false if signal is not an AbortSignal. remove detaches fn from signal, and
+// must be called on the event loop once fn is no longer relevant.
+func OnAbort(vm *goja.Runtime, signal goja.Value, fn func()) (remove func(), ok bool) {
+	remove = func() {}
+	if signal == nil || goja.IsUndefined(signal) || goja.IsNull(signal) {
+		return remove, false
+	}
+	obj := signal.ToObject(vm)
+	if obj.Get("aborted").ToBoolean() {
+		fn()
+		return remove, true
+	}
+	addEventListener, ok := goja.AssertFunction(obj.Get("addEventListener"))
+	if !ok {
+		return remove, false
+	}
+	removeEventListener, ok := goja.AssertFunction(obj.Get("removeEventListener"))
+	if !ok {
+		return remove, false
+	}
+	listener := vm.ToValue(func(goja.FunctionCall) goja.Value {
+		fn()
+		return goja.Undefined()
+	})
+	addEventListener(obj, vm.ToValue("abort"), listener)
+	remove = func() {
+		removeEventListener(obj, vm.ToValue("abort"), listener)
+	}
+	return remove, true
+}
@@ -0,0 +1,16 @@
+package abort
+
+import (
+	_ "embed"
+
+	"github.com/dop251/goja"
+)
+
+const (
+	abortSignalSymbol = "__runtimeAbortSignal"
+)
+
+//go:embed wrapper.js
+var abortWrapperScript string
+
+var abortWrapperProg = goja.MustCompile("abort", abortWrapperScript, false)
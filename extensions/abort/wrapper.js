@@ -0,0 +1,101 @@
+"use strict";
+// minimal AbortSignal, since AbortController is not polyfilled
+class RuntimeAbortSignal {
+    constructor() {
+        this.aborted = false;
+        this.reason = undefined;
+        this.onabort = null;
+        this._listeners = [];
+    }
+    addEventListener(type, listener) {
+        if (type !== "abort" || this._listeners.includes(listener)) {
+            return;
+        }
+        this._listeners.push(listener);
+    }
+    removeEventListener(type, listener) {
+        if (type !== "abort") {
+            return;
+        }
+        this._listeners = this._listeners.filter((l) => l !== listener);
+    }
+    throwIfAborted() {
+        if (this.aborted) {
+            throw this.reason;
+        }
+    }
+    _abort(reason) {
+        if (this.aborted) {
+            return;
+        }
+        this.aborted = true;
+        this.reason = reason === undefined ? __runtimeAbortError() : reason;
+        const ev = { type: "abort" };
+        const listeners = [this.onabort, ...this._listeners];
+        this._listeners = [];
+        for (const listener of listeners) {
+            if (typeof listener !== "function") {
+                continue;
+            }
+            try {
+                listener.call(this, ev);
+            }
+            catch (e) {
+                console.error("Uncaught exception in abort listener:", e);
+            }
+        }
+    }
+    static abort(reason) {
+        const signal = new RuntimeAbortSignal();
+        signal._abort(reason);
+        return signal;
+    }
+    static timeout(ms) {
+        const signal = new RuntimeAbortSignal();
+        setTimeout(() => {
+            const err = new Error("The operation timed out.");
+            err.name = "TimeoutError";
+            signal._abort(err);
+        }, ms);
+        return signal;
+    }
+    get [Symbol.toStringTag]() {
+        return "AbortSignal";
+    }
+}
+class RuntimeAbortController {
+    constructor() {
+        this.signal = new RuntimeAbortSignal();
+    }
+    abort(reason) {
+        this.signal._abort(reason);
+    }
+    get [Symbol.toStringTag]() {
+        return "AbortController";
+    }
+}
+const __runtimeAbortError = () => {
+    const err = new Error("The operation was aborted.");
+    err.name = "AbortError";
+    return err;
+};
+if (typeof AbortController === "undefined") {
+    Object.defineProperty(globalThis, "AbortController", {
+        value: RuntimeAbortController,
+        writable: true,
+        configurable: true,
+    });
+    Object.defineProperty(globalThis, "AbortSignal", {
+        value: RuntimeAbortSignal,
+        writable: true,
+        configurable: true,
+    });
+}
+// this is a helper for signals tied to the context of the http request
+const __runtimeAbortSignal = () => {
+    const controller = new AbortController();
+    return {
+        signal: controller.signal,
+        abort: () => controller.abort(),
+    };
+};
@@ -0,0 +1,121 @@
+type AbortListener = (this: AbortSignal, ev: { type: string }) => any;
+
+// minimal AbortSignal, since AbortController is not polyfilled
+class RuntimeAbortSignal {
+  aborted: boolean;
+  reason: any;
+  onabort: AbortListener | null;
+  _listeners: AbortListener[];
+
+  constructor() {
+    this.aborted = false;
+    this.reason = undefined;
+    this.onabort = null;
+    this._listeners = [];
+  }
+
+  addEventListener(type: string, listener: AbortListener) {
+    if (type !== "abort" || this._listeners.includes(listener)) {
+      return;
+    }
+    this._listeners.push(listener);
+  }
+
+  removeEventListener(type: string, listener: AbortListener) {
+    if (type !== "abort") {
+      return;
+    }
+    this._listeners = this._listeners.filter((l) => l !== listener);
+  }
+
+  throwIfAborted() {
+    if (this.aborted) {
+      throw this.reason;
+    }
+  }
+
+  _abort(reason?: any) {
+    if (this.aborted) {
+      return;
+    }
+    this.aborted = true;
+    this.reason = reason === undefined ? __runtimeAbortError() : reason;
+    const ev = { type: "abort" };
+    const listeners = [this.onabort, ...this._listeners];
+    this._listeners = [];
+    for (const listener of listeners) {
+      if (typeof listener !== "function") {
+        continue;
+      }
+      try {
+        listener.call(this as any, ev);
+      } catch (e) {
+        console.error("Uncaught exception in abort listener:", e);
+      }
+    }
+  }
+
+  static abort(reason?: any) {
+    const signal = new RuntimeAbortSignal();
+    signal._abort(reason);
+    return signal;
+  }
+
+  static timeout(ms: number) {
+    const signal = new RuntimeAbortSignal();
+    setTimeout(() => {
+      const err = new Error("The operation timed out.");
+      err.name = "TimeoutError";
+      signal._abort(err);
+    }, ms);
+    return signal;
+  }
+
+  get [Symbol.toStringTag]() {
+    return "AbortSignal";
+  }
+}
+
+class RuntimeAbortController {
+  readonly signal: RuntimeAbortSignal;
+
+  constructor() {
+    this.signal = new RuntimeAbortSignal();
+  }
+
+  abort(reason?: any) {
+    this.signal._abort(reason);
+  }
+
+  get [Symbol.toStringTag]() {
+    return "AbortController";
+  }
+}
+
+const __runtimeAbortError = () => {
+  const err = new Error("The operation was aborted.");
+  err.name = "AbortError";
+  return err;
+};
+
+if (typeof AbortController === "undefined") {
+  Object.defineProperty(globalThis, "AbortController", {
+    value: RuntimeAbortController,
+    writable: true,
+    configurable: true,
+  });
+  Object.defineProperty(globalThis, "AbortSignal", {
+    value: RuntimeAbortSignal,
+    writable: true,
+    configurable: true,
+  });
+}
+
+// this is a helper for signals tied to the context of the http request
+const __runtimeAbortSignal = () => {
+  const controller = new AbortController();
+  return {
+    signal: controller.signal,
+    abort: () => controller.abort(),
+  };
+};
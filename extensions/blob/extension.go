@@ -0,0 +1,124 @@
+package blob
+
+import (
+	"io"
+	"reflect"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja_nodejs/eventloop"
+)
+
+// PolyfillBlob installs Blob in the runtime, and wraps the Request and Response
+// constructors so Blob and ArrayBufferView bodies are kept byte-exact.
+// It must be called after polyfill.PolyfillRuntime.
+func PolyfillBlob(eventLoop *eventloop.EventLoop) error {
+	setup := make(chan error, 1)
+	eventLoop.RunOnLoop(func(vm *goja.Runtime) {
+		_, err := vm.RunProgram(blobWrapperProg)
+		setup <- err
+	})
+
+	return <-setup
+}
+
+var arrayBufferType = reflect.TypeOf(goja.ArrayBuffer{})
+
+// Source is the content of a Blob which is not kept in memory, such as a file
+// of a form kept in a temp file. Such a Blob has a _source object, with the
+// Source in its native property.
+type Source interface {
+	// NewReader returns a reader of the content, to be read off the loop
+	NewReader() io.Reader
+}
+
+// AssertSource returns the Source of a Blob which is not kept in memory
+func AssertSource(native goja.Value, vm *goja.Runtime) (Source, bool) {
+	obj, ok := native.(*goja.Object)
+	if !ok || !isBlob(obj, vm) {
+		return nil, false
+	}
+	return blobSource(obj)
+}
+
+func blobSource(blob *goja.Object) (Source, bool) {
+	source, ok := blob.Get("_source").(*goja.Object)
+	if !ok {
+		return nil, false
+	}
+	native := source.Get("native")
+	if native == nil {
+		return nil, false
+	}
+	src, ok := native.Export().(Source)
+	return src, ok
+}
+
+// AssertBytes returns the bytes backing an ArrayBuffer, an ArrayBufferView or
+// a Blob kept in memory. The returned slice is not a copy.
+func AssertBytes(native goja.Value, vm *goja.Runtime) ([]byte, bool) {
+	obj, ok := native.(*goja.Object)
+	if !ok {
+		return nil, false
+	}
+	// checking the type first, as Export() copies the properties of objects
+	if obj.ExportType() == arrayBufferType {
+		return obj.Export().(goja.ArrayBuffer).Bytes(), true
+	}
+	if isBlob(obj, vm) {
+		if _, ok := blobSource(obj); ok {
+			// reading it would block the loop, see AssertSource
+			return nil, false
+		}
+		if obj, ok = obj.Get("_bytes").(*goja.Object); !ok {
+			return nil, false
+		}
+	}
+	if !isView(obj, vm) {
+		return nil, false
+	}
+
+	buffer := obj.Get("buffer")
+	if buffer == nil {
+		return nil, false
+	}
+	ab, ok := buffer.Export().(goja.ArrayBuffer)
+	if !ok {
+		return nil, false
+	}
+	// byteOffset and byteLength are getters, which can be shadowed
+	var (
+		b      = ab.Bytes()
+		offset = obj.Get("byteOffset").ToInteger()
+		length = obj.Get("byteLength").ToInteger()
+	)
+	if offset < 0 || length < 0 || offset > int64(len(b)) || length > int64(len(b))-offset {
+		return nil, false
+	}
+	return b[offset : offset+length], true
+}
+
+func isView(obj *goja.Object, vm *goja.Runtime) bool {
+	isView, ok := goja.AssertFunction(vm.Get("ArrayBuffer").ToObject(vm).Get("isView"))
+	if !ok {
+		return false
+	}
+	ret, err := isView(goja.Undefined(), obj)
+	return err == nil && ret.ToBoolean()
+}
+
+func isBlob(obj *goja.Object, vm *goja.Runtime) bool {
+	ctor, ok := vm.Get("Blob").(*goja.Object)
+	if !ok {
+		return false
+	}
+	proto, ok := ctor.Get("prototype").(*goja.Object)
+	if !ok {
+		return false
+	}
+	for p := obj.Prototype(); p != nil; p = p.Prototype() {
+		if p == proto {
+			return true
+		}
+	}
+	return false
+}
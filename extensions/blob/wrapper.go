@@ -0,0 +1,12 @@
+package blob
+
+import (
+	_ "embed"
+
+	"github.com/dop251/goja"
+)
+
+//go:embed wrapper.js
+var blobWrapperScript string
+
+var blobWrapperProg = goja.MustCompile("blob", blobWrapperScript, false)
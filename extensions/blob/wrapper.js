@@ -0,0 +1,128 @@
+"use strict";
+// minimal in-memory Blob, since Blob is not polyfilled
+class RuntimeBlob {
+    constructor(parts, options) {
+        var _a;
+        const encoder = new TextEncoder();
+        const chunks = [];
+        let size = 0;
+        for (const part of parts !== null && parts !== void 0 ? parts : []) {
+            let chunk;
+            if (part instanceof RuntimeBlob) {
+                chunk = part._bytes;
+            }
+            else if (part instanceof ArrayBuffer) {
+                chunk = new Uint8Array(part);
+            }
+            else if (ArrayBuffer.isView(part)) {
+                chunk = new Uint8Array(part.buffer, part.byteOffset, part.byteLength);
+            }
+            else {
+                chunk = encoder.encode(String(part));
+            }
+            chunks.push(chunk);
+            size += chunk.byteLength;
+        }
+        this._bytes = new Uint8Array(size);
+        let offset = 0;
+        for (const chunk of chunks) {
+            this._bytes.set(chunk, offset);
+            offset += chunk.byteLength;
+        }
+        this.type = ((_a = options === null || options === void 0 ? void 0 : options.type) !== null && _a !== void 0 ? _a : "").toLowerCase();
+    }
+    get size() {
+        return this._bytes.byteLength;
+    }
+    async arrayBuffer() {
+        return this._bytes.slice().buffer;
+    }
+    async text() {
+        return new TextDecoder().decode(this._bytes);
+    }
+    slice(start, end, contentType) {
+        return new RuntimeBlob([this._bytes.slice(start, end)], {
+            type: contentType,
+        });
+    }
+    stream() {
+        const bytes = this._bytes.slice();
+        return new ReadableStream({
+            start(controller) {
+                if (bytes.byteLength > 0) {
+                    controller.enqueue(bytes);
+                }
+                controller.close();
+            },
+        });
+    }
+    get [Symbol.toStringTag]() {
+        return "Blob";
+    }
+}
+if (typeof Blob === "undefined") {
+    Object.defineProperty(globalThis, "Blob", {
+        value: RuntimeBlob,
+        writable: true,
+        configurable: true,
+    });
+}
+// Body polyfill would stringify a Blob, and keeps the entire underlying buffer
+// of an ArrayBufferView, so we normalize both into an exact ArrayBuffer
+const __runtimeNormalizeBody = (body, headers) => {
+    if (body instanceof Blob) {
+        const blob = body;
+        if (blob.type) {
+            const h = new Headers(headers);
+            if (!h.has("content-type")) {
+                h.set("content-type", blob.type);
+            }
+            headers = h;
+        }
+        if (blob._source) {
+            // not kept in memory, the stream is read in Go
+            return [blob.stream(), headers];
+        }
+        return [blob._bytes.slice().buffer, headers];
+    }
+    if (ArrayBuffer.isView(body)) {
+        const { buffer, byteOffset, byteLength } = body;
+        return [buffer.slice(byteOffset, byteOffset + byteLength), headers];
+    }
+    return [body, headers];
+};
+// NOTE: Proxy cannot be used here, as goja does not accept Proxy in instanceof.
+// The wrapper shares the prototype, so instanceof works for both.
+// finalize receives the constructed instance and the original arguments.
+const __runtimeWrapBodyConstructor = (target, normalize, finalize) => {
+    const wrapped = function (...args) {
+        if (!new.target) {
+            throw new TypeError(`Failed to construct '${target.name}': Please use the 'new' operator`);
+        }
+        const instance = Reflect.construct(target, normalize(args), new.target);
+        finalize === null || finalize === void 0 ? void 0 : finalize(instance, args);
+        return instance;
+    };
+    wrapped.prototype = target.prototype;
+    Object.setPrototypeOf(wrapped, target);
+    return wrapped;
+};
+globalThis.Response = __runtimeWrapBodyConstructor(Response, (args) => {
+    const [body, init] = args;
+    if (body instanceof Blob || ArrayBuffer.isView(body)) {
+        const [useBody, headers] = __runtimeNormalizeBody(body, init === null || init === void 0 ? void 0 : init.headers);
+        return [useBody, Object.assign(Object.assign({}, init), { headers })];
+    }
+    return args;
+});
+globalThis.Request = __runtimeWrapBodyConstructor(Request, (args) => {
+    var _a;
+    const [input, init] = args;
+    if (init &&
+        !(init instanceof Request) &&
+        (init.body instanceof Blob || ArrayBuffer.isView(init.body))) {
+        const [useBody, headers] = __runtimeNormalizeBody(init.body, (_a = init.headers) !== null && _a !== void 0 ? _a : (input instanceof Request ? input.headers : undefined));
+        return [input, Object.assign(Object.assign({}, init), { body: useBody, headers })];
+    }
+    return args;
+});
@@ -0,0 +1,101 @@
+package common
+
+import (
+	"github.com/dop251/goja"
+	"github.com/dop251/goja_nodejs/eventloop"
+)
+
+// HandlerOptions are the options passed as the second argument to
+// registerEventHandler or registerExpressHandler.
+type HandlerOptions map[string]any
+
+// Bool returns the value of key as a boolean, or false if the option is
+// missing or is not a boolean.
+func (o HandlerOptions) Bool(key string) bool {
+	b, _ := o[key].(bool)
+	return b
+}
+
+// Extension is a per-request binding exposed as a property on both FetchEvent
+// and Express-style RequestContext (e.g. evt.fetch or ctx.kv).
+type Extension interface {
+	// Name is the property name of the extension.
+	Name() string
+	// Enabled reports whether the extension should be exposed given the
+	// options the handler was registered with.
+	Enabled(options HandlerOptions) bool
+	// New constructs an instance bound to vm. It is called on the event loop,
+	// and the instance is pooled along with the FetchEvent or RequestContext.
+	New(vm *goja.Runtime, eventLoop *eventloop.EventLoop) ExtensionInstance
+}
+
+// ExtensionInstance is an instance of Extension bound to a single VM.
+type ExtensionInstance interface {
+	// WithIOContext attaches the IOContext of the current request.
+	WithIOContext(t *IOContext)
+	// NativeObject returns the value exposed to JavaScript.
+	NativeObject() goja.Value
+	// Reset is called before the instance is returned to the pool.
+	Reset()
+}
+
+// ExtensionHost manages the extension instances of a pooled FetchEvent or RequestContext.
+type ExtensionHost struct {
+	vm        *goja.Runtime
+	eventLoop *eventloop.EventLoop
+	ioContext *IOContext
+	enabled   []Extension
+	instances map[string]ExtensionInstance
+	names     []string
+}
+
+func NewExtensionHost(vm *goja.Runtime, eventLoop *eventloop.EventLoop) *ExtensionHost {
+	return &ExtensionHost{
+		vm:        vm,
+		eventLoop: eventLoop,
+		instances: map[string]ExtensionInstance{},
+		names:     make([]string, 0, 2),
+	}
+}
+
+// Use sets the IOContext and the enabled extensions for the current request.
+func (h *ExtensionHost) Use(t *IOContext, enabled []Extension) {
+	h.ioContext = t
+	h.enabled = enabled
+	h.names = h.names[:0]
+	for _, ext := range enabled {
+		h.names = append(h.names, ext.Name())
+	}
+}
+
+// Get returns the native object of the extension, constructing the instance
+// on first access. ok is false if the extension is not enabled.
+func (h *ExtensionHost) Get(name string) (val goja.Value, ok bool) {
+	for _, ext := range h.enabled {
+		if ext.Name() != name {
+			continue
+		}
+		instance := h.instances[name]
+		if instance == nil {
+			instance = ext.New(h.vm, h.eventLoop)
+			h.instances[name] = instance
+		}
+		instance.WithIOContext(h.ioContext)
+		return instance.NativeObject(), true
+	}
+	return nil, false
+}
+
+// Names returns the names of the enabled extensions.
+func (h *ExtensionHost) Names() []string {
+	return h.names
+}
+
+func (h *ExtensionHost) Reset() {
+	for _, instance := range h.instances {
+		instance.Reset()
+	}
+	h.ioContext = nil
+	h.enabled = nil
+	h.names = h.names[:0]
+}
@@ -0,0 +1,125 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/dop251/goja"
+)
+
+type localsKey struct{}
+
+type localsHolder struct {
+	value any
+}
+
+// WithLocals attaches v to ctx. v is exposed to scripts as event.locals, ctx.locals
+// and res.locals. If v implements goja.DynamicObject, it is exposed as-is,
+// otherwise it is copied into a plain JavaScript object via encoding/json.
+func WithLocals(ctx context.Context, v any) context.Context {
+	return context.WithValue(ctx, localsKey{}, &localsHolder{value: v})
+}
+
+// GetLocals returns the locals attached to ctx. After the script has passed the
+// request to the next handler, this returns the value as left by the script:
+// either the goja.DynamicObject passed to WithLocals, or the JavaScript object
+// exported with (goja.Value).Export (usually map[string]any). If the script did
+// not access locals, the value passed to WithLocals is returned unchanged.
+func GetLocals(ctx context.Context) (any, bool) {
+	h, ok := ctx.Value(localsKey{}).(*localsHolder)
+	if !ok {
+		return nil, false
+	}
+	return h.value, true
+}
+
+// RequestLocals binds the locals of a request to a VM. It is pooled along with
+// the FetchEvent or RequestContext.
+type RequestLocals struct {
+	vm        *goja.Runtime
+	jsonParse goja.Callable
+	holder    *localsHolder
+	dynamic   *goja.Object
+	native    goja.Value
+}
+
+func NewRequestLocals(vm *goja.Runtime) *RequestLocals {
+	parse, ok := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("parse"))
+	if !ok {
+		panic(fmt.Errorf("runtime panic: JSON.parse is not a function"))
+	}
+	return &RequestLocals{
+		vm:        vm,
+		jsonParse: parse,
+	}
+}
+
+// NativeObject returns the locals of r as a JavaScript value, initializing it on first access.
+func (l *RequestLocals) NativeObject(r *http.Request) goja.Value {
+	if l.native != nil {
+		return l.native
+	}
+
+	l.holder, _ = r.Context().Value(localsKey{}).(*localsHolder)
+	if l.holder == nil || l.holder.value == nil {
+		l.native = l.vm.NewObject()
+		return l.native
+	}
+
+	switch v := l.holder.value.(type) {
+	case goja.DynamicObject:
+		l.dynamic = l.vm.NewDynamicObject(v)
+		l.native = l.dynamic
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			panic(l.vm.NewTypeError("locals is not JSON-serializable: %s", err))
+		}
+		native, err := l.jsonParse(goja.Undefined(), l.vm.ToValue(string(b)))
+		if err != nil {
+			panic(err)
+		}
+		l.native = native
+	}
+
+	return l.native
+}
+
+// Replace replaces the locals with val, e.g. event.locals = { ... }
+func (l *RequestLocals) Replace(r *http.Request, val goja.Value) {
+	if l.native == nil {
+		l.holder, _ = r.Context().Value(localsKey{}).(*localsHolder)
+	}
+	l.native = val
+}
+
+// Conclude exports the locals as left by the script, and returns the request
+// to be passed to the next handler. Must be called on the event loop.
+func (l *RequestLocals) Conclude(r *http.Request) *http.Request {
+	if l.native == nil {
+		return r
+	}
+
+	var value any
+	if l.dynamic != nil && l.native == l.dynamic {
+		value = l.holder.value
+	} else {
+		value = l.native.Export()
+	}
+
+	if l.holder != nil {
+		l.holder.value = value
+		return r
+	}
+
+	l.holder = &localsHolder{value: value}
+	return r.WithContext(context.WithValue(r.Context(), localsKey{}, l.holder))
+}
+
+func (l *RequestLocals) Reset() {
+	l.holder = nil
+	l.dynamic = nil
+	l.native = nil
+}
@@ -0,0 +1,37 @@
+package shared
+
+import (
+	"io"
+	"mime"
+	"net/http"
+)
+
+type flushWriter struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// NewFlushWriter returns a writer that flushes w after every write, so each
+// chunk reaches the client without waiting for the buffer to fill. The
+// headers are flushed immediately. If w cannot be flushed, w is returned.
+func NewFlushWriter(w http.ResponseWriter) io.Writer {
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		return w
+	}
+	return &flushWriter{w: w, rc: rc}
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, f.rc.Flush()
+}
+
+// IsEventStream reports whether the Content-Type of h is text/event-stream
+func IsEventStream(h http.Header) bool {
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	return mediaType == "text/event-stream"
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"sort"
+	"strings"
 
 	"go.miragespace.co/heresy/polyfill"
 
@@ -15,6 +16,7 @@ type HeadersProxy struct {
 	header           http.Header
 	vm               *goja.Runtime
 	nativeProperties map[string]goja.Value
+	values           *headersValuesProxy
 	keys             []string
 }
 
@@ -32,7 +34,12 @@ func newHeadersProxy(vm *goja.Runtime, symbols *polyfill.RuntimeSymbols) *Header
 		nativeProperties: map[string]goja.Value{},
 		keys:             make([]string, 0, 1),
 	}
+	proxy.values = &headersValuesProxy{
+		HeadersProxy: proxy,
+	}
 	headersInstance.Set("map", vm.NewDynamicObject(proxy))
+	// backing storage of .getAll() and .getSetCookie(), see polyfill.js
+	headersInstance.Set("_values", vm.NewDynamicObject(proxy.values))
 
 	return proxy
 }
@@ -40,7 +47,8 @@ func newHeadersProxy(vm *goja.Runtime, symbols *polyfill.RuntimeSymbols) *Header
 func (h *HeadersProxy) UseHeader(header http.Header) {
 	h.header = header
 	for k := range h.header {
-		h.keys = append(h.keys, k)
+		// Headers normalizes names to lowercase
+		h.keys = append(h.keys, strings.ToLower(k))
 	}
 	sort.Strings(h.keys)
 }
@@ -59,17 +67,22 @@ func (h *HeadersProxy) NativeObject() goja.Value {
 
 func (h *HeadersProxy) Get(key string) goja.Value {
 	if h.nativeProperties[key] == nil {
-		v := h.header.Get(key)
-		if v == "" {
+		v := h.header.Values(key)
+		if len(v) == 0 {
 			return goja.Undefined()
 		}
-		h.nativeProperties[key] = h.vm.ToValue(v)
+		h.nativeProperties[key] = h.vm.ToValue(strings.Join(v, ", "))
 	}
 	return h.nativeProperties[key]
 }
 
+// Set writes through to the http.Header, so scripts can modify a request
+// before it is passed to the next handler
 func (h *HeadersProxy) Set(key string, val goja.Value) bool {
-	return false
+	h.assertHeader()
+	h.header.Set(key, val.String())
+	h.touch(key)
+	return true
 }
 
 func (h *HeadersProxy) Has(key string) bool {
@@ -82,9 +95,82 @@ func (h *HeadersProxy) Has(key string) bool {
 }
 
 func (h *HeadersProxy) Delete(key string) bool {
-	return false
+	h.assertHeader()
+	h.header.Del(key)
+	delete(h.nativeProperties, key)
+	for i, k := range h.keys {
+		if k == key {
+			h.keys = append(h.keys[:i], h.keys[i+1:]...)
+			break
+		}
+	}
+	return true
 }
 
 func (h *HeadersProxy) Keys() []string {
 	return h.keys
 }
+
+// assertHeader throws if the request of the headers has ended
+func (h *HeadersProxy) assertHeader() {
+	if h.header == nil {
+		panic(h.vm.NewTypeError("Headers of a request which has ended cannot be modified"))
+	}
+}
+
+// touch invalidates the cached value of key after a write
+func (h *HeadersProxy) touch(key string) {
+	delete(h.nativeProperties, key)
+	if !h.Has(key) {
+		h.keys = append(h.keys, key)
+		sort.Strings(h.keys)
+	}
+}
+
+// headersValuesProxy exposes all values of a header as an array
+type headersValuesProxy struct {
+	*HeadersProxy
+}
+
+var _ goja.DynamicObject = (*headersValuesProxy)(nil)
+
+func (v *headersValuesProxy) Get(key string) goja.Value {
+	values := v.header.Values(key)
+	if len(values) == 0 {
+		return goja.Undefined()
+	}
+	return v.vm.ToValue(values)
+}
+
+func (v *headersValuesProxy) Set(key string, val goja.Value) bool {
+	var values []string
+	if err := v.vm.ExportTo(val, &values); err != nil {
+		return false
+	}
+	v.assertHeader()
+	v.header.Del(key)
+	for _, s := range values {
+		v.header.Add(key, s)
+	}
+	v.touch(key)
+	return true
+}
+
+// CopyHeaders copies headers exported from JavaScript to dst, replacing existing
+// values of the same name. Values are either a string, or an array of strings
+// for multi-value headers (e.g. Set-Cookie).
+func CopyHeaders(dst http.Header, src map[string]any) {
+	for k, v := range src {
+		dst.Del(k)
+		switch values := v.(type) {
+		case []any:
+			for _, s := range values {
+				dst.Add(k, fmt.Sprintf("%v", s))
+			}
+		case string:
+			dst.Add(k, values)
+		default:
+			dst.Add(k, fmt.Sprintf("%v", values))
+		}
+	}
+}
@@ -3,7 +3,6 @@ package shared
 import (
 	"expvar"
 
-	"go.miragespace.co/heresy/extensions/common/x"
 	"go.miragespace.co/heresy/polyfill"
 
 	"github.com/dop251/goja"
@@ -14,27 +13,29 @@ var (
 	hdrPxyPut = expvar.NewInt("headersProxy.Put")
 )
 
+// HeadersProxyPool creates the HeadersProxy of requests. A Headers object
+// can be retained by the script after its request has ended, so proxies are
+// detached from their header when put back instead of being reused by the
+// next request.
 type HeadersProxyPool struct {
-	hdrPool *x.Pool[*HeadersProxy]
+	vm      *goja.Runtime
+	symbols *polyfill.RuntimeSymbols
 }
 
 func NewHeadersProxyPool(vm *goja.Runtime, symbols *polyfill.RuntimeSymbols) *HeadersProxyPool {
-	hp := &HeadersProxyPool{}
-	hp.hdrPool = x.NewPool[*HeadersProxy](x.DefaultPoolCapacity).
-		WithFactory(func() *HeadersProxy {
-			hdrPxyNew.Add(1)
-			return newHeadersProxy(vm, symbols)
-		})
-	return hp
+	return &HeadersProxyPool{
+		vm:      vm,
+		symbols: symbols,
+	}
 }
 
+// Get must be called on the loop
 func (p *HeadersProxyPool) Get() *HeadersProxy {
-	h := p.hdrPool.Get()
-	return h
+	hdrPxyNew.Add(1)
+	return newHeadersProxy(p.vm, p.symbols)
 }
 
 func (p *HeadersProxyPool) Put(h *HeadersProxy) {
 	h.unsetHeader()
-	p.hdrPool.Put(h)
 	hdrPxyPut.Add(1)
 }
@@ -0,0 +1,129 @@
+package errorpage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dop251/goja"
+)
+
+// Error describes a failed request to a Handler
+type Error struct {
+	// RequestID is logged with the exception
+	RequestID string
+	Status    int
+	Err       error
+}
+
+// Handler renders the response of a failed request. The exception is already
+// logged with the request ID, and should not be sent to the client.
+type Handler func(w http.ResponseWriter, r *http.Request, e *Error)
+
+// DefaultHandler responds with the status and the request ID only
+func DefaultHandler(w http.ResponseWriter, r *http.Request, e *Error) {
+	http.Error(w, fmt.Sprintf("%d %s\nRequest ID: %s", e.Status, http.StatusText(e.Status), e.RequestID), e.Status)
+}
+
+// HTTPError is an error with the status of the response, such as a
+// malformed request body
+type HTTPError struct {
+	Status int
+	// Type classifies the error the same way body-parser does, such as
+	// "entity.parse.failed" or "entity.too.large"
+	Type string
+	Err  error
+}
+
+func (e *HTTPError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// statusOf returns the status of HTTPError, or of a thrown error with a
+// status between 400 and 599 like Express.js does, or 500
+func statusOf(err error) int {
+	var (
+		httpErr   *HTTPError
+		scriptErr *ScriptError
+	)
+	if errors.As(err, &httpErr) {
+		return httpErr.Status
+	}
+	if errors.As(err, &scriptErr) && scriptErr.Status != 0 {
+		return scriptErr.Status
+	}
+	return http.StatusInternalServerError
+}
+
+// ScriptError is a value thrown or rejected by a script. Its stack is
+// captured on the loop, so it can be logged from any goroutine.
+type ScriptError struct {
+	Message string
+	Stack   string
+	// Status is the status or statusCode property of the thrown error, if
+	// it is between 400 and 599
+	Status int
+	value  goja.Value
+}
+
+func (e *ScriptError) Error() string {
+	return e.Message
+}
+
+// NewScriptError captures v, which must be called on the loop
+func NewScriptError(vm *goja.Runtime, v goja.Value) *ScriptError {
+	if v == nil {
+		v = goja.Undefined()
+	}
+	e := &ScriptError{
+		Message: v.String(),
+		value:   v,
+	}
+	if obj, ok := v.(*goja.Object); ok {
+		if stack := obj.Get("stack"); stack != nil && !goja.IsUndefined(stack) {
+			e.Stack = stack.String()
+		}
+		for _, key := range []string{"status", "statusCode"} {
+			if status := obj.Get(key); status != nil {
+				if code := status.ToInteger(); code >= 400 && code < 600 {
+					e.Status = int(code)
+					break
+				}
+			}
+		}
+	}
+	return e
+}
+
+const requestIDHeader = "X-Request-Id"
+
+// requestID reuses the request ID of a proxy in front, if any
+func requestID(r *http.Request) string {
+	if id := r.Header.Get(requestIDHeader); validRequestID(id) {
+		return id
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
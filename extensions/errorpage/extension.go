@@ -0,0 +1,236 @@
+package errorpage
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"go.miragespace.co/heresy/extensions/blob"
+	"go.miragespace.co/heresy/extensions/common/shared"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja_nodejs/eventloop"
+	"go.uber.org/zap"
+)
+
+// Reporter logs exceptions of handlers with a request ID, and renders the
+// response to the client. Without a Handler or a handler registered by the
+// script with registerErrorHandler, the exception is sent to the client as-is.
+type Reporter struct {
+	eventLoop *eventloop.EventLoop
+	logger    *zap.Logger
+	handler   Handler
+	render    goja.Callable
+	script    goja.Value // registered by the script, only accessed on the loop
+	scripted  atomic.Bool
+}
+
+// NewReporter installs the helper rendering the Response of a handler
+// registered with registerErrorHandler. handler is optional.
+func NewReporter(eventLoop *eventloop.EventLoop, logger *zap.Logger, handler Handler) (*Reporter, error) {
+	r := &Reporter{
+		eventLoop: eventLoop,
+		logger:    logger,
+		handler:   handler,
+	}
+
+	setup := make(chan error, 1)
+	eventLoop.RunOnLoop(func(vm *goja.Runtime) {
+		_, err := vm.RunProgram(errorPageWrapperProg)
+		if err != nil {
+			setup <- err
+			return
+		}
+
+		render, ok := goja.AssertFunction(vm.Get(errorPageWrapperSymbol))
+		if !ok {
+			setup <- fmt.Errorf("internal error: %s is not a function", errorPageWrapperSymbol)
+			return
+		}
+		r.render = render
+
+		setup <- nil
+	})
+
+	if err := <-setup; err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// SetScriptHandler registers the handler of registerErrorHandler. It must be
+// called on the loop.
+func (r *Reporter) SetScriptHandler(fn goja.Value) {
+	r.script = fn
+	r.scripted.Store(true)
+}
+
+// hidden reports whether exceptions are hidden from the client
+func (r *Reporter) hidden() bool {
+	return r.handler != nil || r.scripted.Load()
+}
+
+// Log logs an exception that cannot be reported to the client, e.g. thrown
+// after the response was sent
+func (r *Reporter) Log(req *http.Request, message string, err error) {
+	r.logger.Warn(message, r.fields(req, requestID(req), err)...)
+}
+
+// Report logs err, and renders the error response to w. done is called once
+// the response is written. Report does not block, and can be called on the loop.
+func (r *Reporter) Report(w http.ResponseWriter, req *http.Request, message string, err error, done func()) {
+	id := requestID(req)
+	status := statusOf(err)
+	if status < http.StatusInternalServerError {
+		r.logger.Warn(message, r.fields(req, id, err)...)
+	} else {
+		r.logger.Error(message, r.fields(req, id, err)...)
+	}
+
+	if !r.hidden() {
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "%s: %+v", message, err)
+		done()
+		return
+	}
+
+	w.Header().Set(requestIDHeader, id)
+	e := &Error{
+		RequestID: id,
+		Status:    status,
+		Err:       err,
+	}
+
+	if !r.scripted.Load() {
+		go func() {
+			r.fallback(w, req, e)
+			done()
+		}()
+		return
+	}
+
+	r.eventLoop.RunOnLoop(func(vm *goja.Runtime) {
+		r.renderVM(vm, w, req, e, done)
+	})
+}
+
+// Respond is Report that waits for the response to be written. It must not
+// be called on the loop.
+func (r *Reporter) Respond(w http.ResponseWriter, req *http.Request, message string, err error) {
+	written := make(chan struct{})
+	r.Report(w, req, message, err, func() {
+		close(written)
+	})
+	<-written
+}
+
+func (r *Reporter) fields(req *http.Request, id string, err error) []zap.Field {
+	fields := []zap.Field{
+		zap.String("requestId", id),
+		zap.String("method", req.Method),
+		zap.String("url", req.URL.String()),
+		zap.Error(err),
+	}
+	var (
+		scriptErr *ScriptError
+		exception *goja.Exception
+	)
+	if errors.As(err, &scriptErr) && scriptErr.Stack != "" {
+		fields = append(fields, zap.String("stack", scriptErr.Stack))
+	} else if errors.As(err, &exception) {
+		fields = append(fields, zap.String("stack", exception.String()))
+	}
+	return fields
+}
+
+func (r *Reporter) fallback(w http.ResponseWriter, req *http.Request, e *Error) {
+	if r.handler != nil {
+		r.handler(w, req, e)
+		return
+	}
+	DefaultHandler(w, req, e)
+}
+
+func (r *Reporter) renderVM(vm *goja.Runtime, w http.ResponseWriter, req *http.Request, e *Error, done func()) {
+	failed := func(err any) {
+		r.logger.Error("Error handler failed, using the default error page",
+			zap.String("requestId", e.RequestID),
+			zap.Any("error", err),
+		)
+		go func() {
+			r.fallback(w, req, e)
+			done()
+		}()
+	}
+
+	var value goja.Value
+	var (
+		scriptErr *ScriptError
+		httpErr   *HTTPError
+	)
+	if errors.As(e.Err, &scriptErr) {
+		value = scriptErr.value
+	} else {
+		goErr := vm.NewGoError(e.Err)
+		if errors.As(e.Err, &httpErr) {
+			goErr.Set("status", httpErr.Status)
+			goErr.Set("statusCode", httpErr.Status)
+			goErr.Set("type", httpErr.Type)
+		}
+		value = goErr
+	}
+
+	info := vm.NewObject()
+	info.Set("requestId", e.RequestID)
+	info.Set("status", e.Status)
+	info.Set("method", req.Method)
+	info.Set("url", req.URL.String())
+
+	promise, err := r.render(goja.Undefined(), r.script, value, info)
+	if err != nil {
+		failed(err)
+		return
+	}
+	then, ok := goja.AssertFunction(promise.ToObject(vm).Get("then"))
+	if !ok {
+		failed("internal error: not a Promise")
+		return
+	}
+
+	onPage := func(fc goja.FunctionCall) goja.Value {
+		page := fc.Argument(0)
+		if goja.IsNull(page) || goja.IsUndefined(page) {
+			failed("registerErrorHandler did not return a Response")
+			return goja.Undefined()
+		}
+
+		obj := page.ToObject(vm)
+		status := int(obj.Get("status").ToInteger())
+		if status < 100 || status > 999 {
+			status = e.Status
+		}
+		headers, _ := obj.Get("headers").Export().(map[string]any)
+		var body []byte
+		if b, ok := blob.AssertBytes(obj.Get("body"), vm); ok {
+			body = append(body, b...)
+		}
+
+		go func() {
+			shared.CopyHeaders(w.Header(), headers)
+			w.WriteHeader(status)
+			w.Write(body)
+			done()
+		}()
+		return goja.Undefined()
+	}
+	onError := func(fc goja.FunctionCall) goja.Value {
+		failed(NewScriptError(vm, fc.Argument(0)))
+		return goja.Undefined()
+	}
+
+	if _, err := then(promise, vm.ToValue(onPage), vm.ToValue(onError)); err != nil {
+		failed(err)
+	}
+}
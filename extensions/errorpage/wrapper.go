@@ -0,0 +1,16 @@
+package errorpage
+
+import (
+	_ "embed"
+
+	"github.com/dop251/goja"
+)
+
+const (
+	errorPageWrapperSymbol = "__runtimeErrorPage"
+)
+
+//go:embed wrapper.js
+var errorPageWrapperScript string
+
+var errorPageWrapperProg = goja.MustCompile("errorPage", errorPageWrapperScript, false)
@@ -0,0 +1,13 @@
+// this is a helper for the handler of registerErrorHandler. The body of an
+// error page is read entirely, it is expected to be small.
+const __runtimeErrorPage = async (handler, error, info) => {
+    const response = await handler(error, info);
+    if (!(response instanceof Response)) {
+        return null;
+    }
+    return {
+        status: response.status,
+        headers: __runtimeHeadersValues(response.headers),
+        body: await response.arrayBuffer(),
+    };
+};
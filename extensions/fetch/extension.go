@@ -6,8 +6,8 @@ import (
 	"net/http"
 
 	"go.miragespace.co/heresy/extensions/common"
-	"go.miragespace.co/heresy/extensions/common/x"
 	"go.miragespace.co/heresy/extensions/stream"
+	"go.miragespace.co/heresy/extensions/websocket"
 
 	"github.com/dop251/goja"
 	"github.com/dop251/goja_nodejs/eventloop"
@@ -15,24 +15,28 @@ import (
 
 var (
 	fetcherNew = expvar.NewInt("fetcher.New")
-	fetcherPut = expvar.NewInt("fetcher.Put")
 )
 
 const UserAgent = "heresy-runtime/fetcher"
 
-var ErrUnsupportedReadableStream = fmt.Errorf("using custom ReadableStream as body is currently unsupported")
+var ErrUnsupportedReadableStream = fmt.Errorf("body is not a string, an ArrayBuffer or a ReadableStream")
 
 type Fetch struct {
 	FetchConfig
 	runtimeFetchWrapper  goja.Callable
 	runtimeReponseHelper goja.Value
-	fetcherPool          *x.Pool[*NativeFetcher]
+	runtimeRequestHelper goja.Callable
+	runtimeResultHelper  goja.Callable
 }
 
+var _ common.Extension = (*Fetch)(nil)
+
 type FetchConfig struct {
 	Stream    *stream.StreamController
 	Eventloop *eventloop.EventLoop
 	Client    *http.Client
+	// WebSocket handles requests with Upgrade: websocket, optional
+	WebSocket *websocket.Controller
 }
 
 type NativeFetcher struct {
@@ -40,10 +44,20 @@ type NativeFetcher struct {
 	nativeFunc    goja.Value
 }
 
-func (n *NativeFetcher) NativeFunc() goja.Value {
+var _ common.ExtensionInstance = (*NativeFetcher)(nil)
+
+func (n *NativeFetcher) WithIOContext(t *common.IOContext) {
+	n.nativeWrapper.ioContext = t
+}
+
+func (n *NativeFetcher) NativeObject() goja.Value {
 	return n.nativeFunc
 }
 
+func (n *NativeFetcher) Reset() {
+	n.nativeWrapper.ioContext = nil
+}
+
 func (c *FetchConfig) Validate() error {
 	if c.Eventloop == nil {
 		return fmt.Errorf("nil Eventloop is invalid")
@@ -85,23 +99,19 @@ func NewFetch(cfg FetchConfig) (*Fetch, error) {
 		promiseResolver = vm.Get(responseHelperSymbol)
 		f.runtimeReponseHelper = promiseResolver
 
-		f.fetcherPool = x.NewPool[*NativeFetcher](x.DefaultPoolCapacity).
-			WithFactory(func() *NativeFetcher {
-				fetcherNew.Add(1)
-				wrapper := &NativeFetchWrapper{
-					cfg: f.FetchConfig,
-				}
-				obj := vm.CreateObject(nil)
-				obj.Set("doFetch", vm.ToValue(wrapper.doFetch))
-				fn, err := f.runtimeFetchWrapper(goja.Undefined(), obj)
-				if err != nil {
-					panic(fmt.Errorf("runtime panic: Failed to get native fetch: %w", err))
-				}
-				return &NativeFetcher{
-					nativeWrapper: wrapper,
-					nativeFunc:    fn,
-				}
-			})
+		requestHelper, ok := goja.AssertFunction(vm.Get(requestHelperSymbol))
+		if !ok {
+			setup <- fmt.Errorf("internal error: %s is not a function", requestHelperSymbol)
+			return
+		}
+		f.runtimeRequestHelper = requestHelper
+
+		resultHelper, ok := goja.AssertFunction(vm.Get(resultHelperSymbol))
+		if !ok {
+			setup <- fmt.Errorf("internal error: %s is not a function", resultHelperSymbol)
+			return
+		}
+		f.runtimeResultHelper = resultHelper
 
 		setup <- nil
 	})
@@ -117,24 +127,40 @@ func (f *Fetch) GetResponseHelper() goja.Value {
 	return f.runtimeReponseHelper
 }
 
-// func (f *Fetch) NewNativeFetch(t *common.IOContext) *NativeFetcher {
-// 	valCh := make(chan *NativeFetcher, 1)
-// 	f.Eventloop.RunOnLoop(func(vm *goja.Runtime) {
-// 		valCh <- f.NewNativeFetchVM(t, vm)
-// 	})
+// GetRequestHelper returns the helper that flattens (input, init) of the
+// Request constructor into url, method, headers and body
+func (f *Fetch) GetRequestHelper() goja.Callable {
+	return f.runtimeRequestHelper
+}
 
-// 	return <-valCh
-// }
+// GetResultHelper returns the helper that constructs a Response from a
+// ResponseProxy
+func (f *Fetch) GetResultHelper() goja.Callable {
+	return f.runtimeResultHelper
+}
 
-func (f *Fetch) NewNativeFetchVM(t *common.IOContext, vm *goja.Runtime) *NativeFetcher {
-	fetcher := f.fetcherPool.Get()
-	fetcher.nativeWrapper.ioContext = t
+func (f *Fetch) Name() string {
+	return "fetch"
+}
 
-	t.RegisterCleanup(func() {
-		fetcher.nativeWrapper.ioContext = nil
-		f.fetcherPool.Put(fetcher)
-		fetcherPut.Add(1)
-	})
+// Enabled reports whether the handler opted in network access with { fetch: true }
+func (f *Fetch) Enabled(options common.HandlerOptions) bool {
+	return options.Bool("fetch")
+}
 
-	return fetcher
+func (f *Fetch) New(vm *goja.Runtime, _ *eventloop.EventLoop) common.ExtensionInstance {
+	fetcherNew.Add(1)
+	wrapper := &NativeFetchWrapper{
+		cfg: f.FetchConfig,
+	}
+	obj := vm.CreateObject(nil)
+	obj.Set("doFetch", vm.ToValue(wrapper.doFetch))
+	fn, err := f.runtimeFetchWrapper(goja.Undefined(), obj)
+	if err != nil {
+		panic(fmt.Errorf("runtime panic: Failed to get native fetch: %w", err))
+	}
+	return &NativeFetcher{
+		nativeWrapper: wrapper,
+		nativeFunc:    fn,
+	}
 }
@@ -1,13 +1,19 @@
 package fetch
 
 import (
-	"fmt"
+	"bytes"
+	"context"
 	"io"
 	"net/http"
 	"reflect"
+	"sync"
 
+	"go.miragespace.co/heresy/extensions/abort"
+	"go.miragespace.co/heresy/extensions/blob"
 	"go.miragespace.co/heresy/extensions/common"
+	"go.miragespace.co/heresy/extensions/common/shared"
 	"go.miragespace.co/heresy/extensions/stream"
+	"go.miragespace.co/heresy/extensions/websocket"
 
 	"github.com/dop251/goja"
 	pool "github.com/libp2p/go-buffer-pool"
@@ -27,6 +33,7 @@ func (f *NativeFetchWrapper) doFetch(fc goja.FunctionCall, vm *goja.Runtime) (re
 		reqMethod                 = fc.Argument(1)
 		reqHeaders                = fc.Argument(2)
 		reqBody                   = fc.Argument(3)
+		reqSignal                 = fc.Argument(4)
 		result                    = f.cfg.Stream.GetResponseProxy(f.ioContext)
 		bodyType                  = reqBody.ExportType()
 		url        string         = reqURL.String()
@@ -42,21 +49,47 @@ func (f *NativeFetchWrapper) doFetch(fc goja.FunctionCall, vm *goja.Runtime) (re
 		strBuf := pool.NewBufferString(reqBody.String())
 		f.ioContext.RegisterCleanup(strBuf.Reset)
 		useBody = strBuf
+	} else if b, ok := blob.AssertBytes(reqBody, vm); ok {
+		// ArrayBuffer is a copy owned by the Request
+		useBody = bytes.NewReader(b)
 	} else {
-		// possibly wrapped ReadableStream
-		reader, ok := stream.AssertReader(reqBody, vm)
-		if !ok {
+		// wrapped or JavaScript ReadableStream
+		reader, ok, err := f.cfg.Stream.NewReaderVM(f.ioContext, reqBody, vm)
+		if err != nil || !ok {
+			if err == nil {
+				err = ErrUnsupportedReadableStream
+			}
 			f.cfg.Eventloop.RunOnLoop(func(vm *goja.Runtime) {
-				reject(vm.NewGoError(ErrUnsupportedReadableStream))
+				reject(vm.NewGoError(err))
 			})
 			return
 		}
 		useBody = reader
 	}
 
+	ctx := f.ioContext.Context()
+	release := func() {}
+	if !goja.IsUndefined(reqSignal) {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		remove, _ := abort.OnAbort(vm, reqSignal, cancel)
+		// the signal can outlive the fetch, so the listener is removed and the
+		// context is canceled once the response body is closed
+		var once sync.Once
+		release = func() {
+			once.Do(func() {
+				cancel()
+				f.cfg.Eventloop.RunOnLoop(func(*goja.Runtime) {
+					remove()
+				})
+			})
+		}
+	}
+
 	go func() {
 		err := f.ioContext.AcquireFetchToken()
 		if err != nil {
+			release()
 			f.cfg.Eventloop.RunOnLoop(func(vm *goja.Runtime) {
 				reject(vm.NewGoError(err))
 			})
@@ -64,29 +97,31 @@ func (f *NativeFetchWrapper) doFetch(fc goja.FunctionCall, vm *goja.Runtime) (re
 		}
 		defer f.ioContext.ReleaseFetchToken()
 
-		req, err := http.NewRequestWithContext(f.ioContext.Context(), method, url, useBody)
+		req, err := http.NewRequestWithContext(ctx, method, url, useBody)
 		if err != nil {
+			release()
 			f.cfg.Eventloop.RunOnLoop(func(vm *goja.Runtime) {
 				reject(vm.NewGoError(err))
 			})
 			return
 		}
 
-		for k, v := range headers {
-			if s, ok := v.(string); ok {
-				req.Header.Set(k, s)
-			} else {
-				req.Header.Set(k, fmt.Sprintf("%s", v))
-			}
-		}
+		shared.CopyHeaders(req.Header, headers)
 		req.Header.Set("user-agent", UserAgent)
 
+		if f.cfg.WebSocket != nil && websocket.IsUpgrade(req) {
+			f.doUpgrade(req, result, release, resolve, reject)
+			return
+		}
+
 		resp, err := f.cfg.Client.Do(req)
 		if err != nil {
+			release()
 			f.cfg.Eventloop.RunOnLoop(func(vm *goja.Runtime) {
 				reject(vm.NewGoError(err))
 			})
 		} else {
+			resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
 			f.cfg.Eventloop.RunOnLoop(func(vm *goja.Runtime) {
 				result.WithResponse(f.ioContext, vm, resp)
 				resolve(result.NativeObject())
@@ -96,3 +131,45 @@ func (f *NativeFetchWrapper) doFetch(fc goja.FunctionCall, vm *goja.Runtime) (re
 
 	return
 }
+
+func (f *NativeFetchWrapper) doUpgrade(req *http.Request, result *stream.ResponseProxy, release func(), resolve, reject func(any)) {
+	resp, conn, err := websocket.Dial(f.cfg.Client, req)
+	switch {
+	case resp != nil && conn == nil:
+		resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+	default:
+		// the upgraded connection is no longer tied to the request context
+		release()
+	}
+	f.cfg.Eventloop.RunOnLoop(func(vm *goja.Runtime) {
+		if err != nil {
+			reject(vm.NewGoError(err))
+			return
+		}
+		result.WithResponse(f.ioContext, vm, resp)
+		if conn != nil {
+			result.WithWebSocket(f.cfg.WebSocket.NewSocketVM(f.ioContext, vm, conn))
+		}
+		resolve(result.NativeObject())
+	})
+}
+
+// releaseOnClose releases the AbortSignal of a fetch once its body is read
+// to the end or closed
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r *releaseOnClose) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err == io.EOF {
+		r.release()
+	}
+	return n, err
+}
+
+func (r *releaseOnClose) Close() error {
+	defer r.release()
+	return r.ReadCloser.Close()
+}
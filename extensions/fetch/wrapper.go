@@ -9,6 +9,8 @@ import (
 const (
 	fetchWrapperSymbol   = "__runtimeFetch"
 	responseHelperSymbol = "__runtimeResponseHelper"
+	requestHelperSymbol  = "__runtimeRequestHelper"
+	resultHelperSymbol   = "__runtimeResultHelper"
 )
 
 //go:embed wrapper.js
@@ -1,22 +1,92 @@
 "use strict";
+// every value of every header, so multi-value headers (e.g. Set-Cookie) are preserved
+const __runtimeHeadersValues = (headers) => {
+    const values = {};
+    headers.forEach((_, name) => {
+        if (!values[name]) {
+            values[name] = headers.getAll(name);
+        }
+    });
+    return values;
+};
 const __runtimeFetch = (goWrapper) => {
     return async (input, options) => {
+        var _a;
         const request = new Request(input, options);
+        // Request polyfill does not keep the signal
+        const signal = (_a = options === null || options === void 0 ? void 0 : options.signal) !== null && _a !== void 0 ? _a : input === null || input === void 0 ? void 0 : input.signal;
+        signal === null || signal === void 0 ? void 0 : signal.throwIfAborted();
         const requestBody = request;
         let useBody;
         if (requestBody._bodyReadableStream) {
             useBody = requestBody._bodyReadableStream;
         }
-        else if (requestBody._bodyArrayBuffer || requestBody._bodyText) {
+        else if (requestBody._bodyArrayBuffer) {
+            // pass the bytes as-is, .text() would corrupt non-UTF-8 content
+            useBody = await requestBody.arrayBuffer();
+        }
+        else if (requestBody._bodyText) {
             useBody = await requestBody.text();
         }
-        const { statusText, statusCode, header, body } = await goWrapper.doFetch(request.url, request.method, request.headers.map, // .map property is the backing storage of headers
-        useBody);
-        return new Response(body, {
-            status: statusCode,
-            statusText: statusText,
-            headers: header,
-        });
+        let result;
+        try {
+            result = await goWrapper.doFetch(request.url, request.method, __runtimeHeadersValues(request.headers), useBody, signal);
+        }
+        catch (e) {
+            signal === null || signal === void 0 ? void 0 : signal.throwIfAborted();
+            throw e;
+        }
+        return __runtimeResultHelper(result);
+    };
+};
+// this is a helper for Response of fetch and FetchEvent.next
+const __runtimeResultHelper = (result) => {
+    const { statusText, statusCode, headers, body, webSocket } = result;
+    return new Response(body, {
+        status: statusCode,
+        statusText: statusText,
+        headers,
+        // set when fetch was a WebSocket upgrade
+        webSocket,
+    });
+};
+// this is a helper for FetchEvent.passThrough
+const __runtimeRequestHelper = (input, options) => {
+    var _a, _b;
+    let request;
+    if (input instanceof Request) {
+        // Request polyfill turns the body into a ReadableStream, and only takes
+        // the headers from options when input is a Request
+        request =
+            options === undefined
+                ? input
+                : new Request(input.url, {
+                    method: ((_a = options.method) !== null && _a !== void 0 ? _a : input.method),
+                    headers: (_b = options.headers) !== null && _b !== void 0 ? _b : input.headers,
+                    body: options.body !== undefined
+                        ? options.body
+                        : input.bodyInit,
+                });
+    }
+    else {
+        request = new Request(input, options);
+    }
+    const requestBody = request;
+    let useBody;
+    if (requestBody._bodyReadableStream) {
+        useBody = requestBody._bodyReadableStream;
+    }
+    else if (requestBody._bodyArrayBuffer) {
+        useBody = requestBody._bodyArrayBuffer.slice(0);
+    }
+    else if (requestBody._bodyText) {
+        useBody = requestBody._bodyText;
+    }
+    return {
+        url: request.url,
+        method: request.method,
+        headers: __runtimeHeadersValues(request.headers),
+        body: useBody,
     };
 };
 // this is a helper for FetchEvent.respondWith
@@ -25,14 +95,26 @@ const __runtimeResponseHelper = async (response) => {
         return { ok: false };
     }
     const { status, headers } = response;
+    const webSocket = response.webSocket;
+    const flush = response._flush === true;
     const requestBody = response;
     let useBody;
     if (requestBody._bodyReadableStream) {
         useBody = requestBody._bodyReadableStream;
     }
-    else if (requestBody._bodyArrayBuffer || requestBody._bodyText) {
+    else if (requestBody._bodyArrayBuffer) {
+        // pass the bytes as-is, .text() would corrupt non-UTF-8 content
+        useBody = await requestBody.arrayBuffer();
+    }
+    else if (requestBody._bodyText) {
         useBody = await requestBody.text();
     }
-    // .map property is the backing storage of headers
-    return { ok: true, status, headers: headers.map, body: useBody };
+    return {
+        ok: true,
+        status,
+        headers: __runtimeHeadersValues(headers),
+        body: useBody,
+        webSocket,
+        flush,
+    };
 };
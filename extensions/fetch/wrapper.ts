@@ -6,24 +6,38 @@ declare function runtimeFetch(
 interface RuntimeFetchResult {
   statusText: string;
   statusCode: number;
-  header: Headers;
+  headers: Headers;
   body: ReadableStream;
+  webSocket?: WebSocket;
 }
 
 interface RuntimeFetchHandler {
   doFetch(
     url: string,
     method: string,
-    headers: Record<string, string>,
-    body?: ReadableStream | string
+    headers: Record<string, string[]>,
+    body?: ReadableStream | ArrayBuffer | string,
+    signal?: AbortSignal
   ): Promise<RuntimeFetchResult>;
 }
 
+// every value of every header, so multi-value headers (e.g. Set-Cookie) are preserved
+const __runtimeHeadersValues = (headers: Headers) => {
+  const values: Record<string, string[]> = {};
+  headers.forEach((_, name) => {
+    if (!values[name]) {
+      values[name] = (headers as any).getAll(name);
+    }
+  });
+  return values;
+};
+
 interface Body {
   readonly _bodyReadableStream?: ReadableStream;
   readonly _bodyArrayBuffer?: ArrayBuffer;
   readonly _bodyText?: string;
   text(): Promise<string>;
+  arrayBuffer(): Promise<ArrayBuffer>;
 }
 
 const __runtimeFetch = (
@@ -34,27 +48,91 @@ const __runtimeFetch = (
     options?: Request | RequestInit
   ): Promise<Response> => {
     const request = new Request(input, options);
+    // Request polyfill does not keep the signal
+    const signal: AbortSignal | undefined =
+      (options as any)?.signal ?? (input as any)?.signal;
+    signal?.throwIfAborted();
 
     const requestBody = request as Body;
-    let useBody: ReadableStream | string | undefined;
+    let useBody: ReadableStream | ArrayBuffer | string | undefined;
     if (requestBody._bodyReadableStream) {
       useBody = requestBody._bodyReadableStream;
-    } else if (requestBody._bodyArrayBuffer || requestBody._bodyText) {
+    } else if (requestBody._bodyArrayBuffer) {
+      // pass the bytes as-is, .text() would corrupt non-UTF-8 content
+      useBody = await requestBody.arrayBuffer();
+    } else if (requestBody._bodyText) {
       useBody = await requestBody.text();
     }
 
-    const { statusText, statusCode, header, body } = await goWrapper.doFetch(
-      request.url,
-      request.method,
-      (request.headers as any).map, // .map property is the backing storage of headers
-      useBody
-    );
-
-    return new Response(body, {
-      status: statusCode,
-      statusText: statusText,
-      headers: header,
-    });
+    let result: RuntimeFetchResult;
+    try {
+      result = await goWrapper.doFetch(
+        request.url,
+        request.method,
+        __runtimeHeadersValues(request.headers),
+        useBody,
+        signal
+      );
+    } catch (e) {
+      signal?.throwIfAborted();
+      throw e;
+    }
+    return __runtimeResultHelper(result);
+  };
+};
+
+// this is a helper for Response of fetch and FetchEvent.next
+const __runtimeResultHelper = (result: RuntimeFetchResult) => {
+  const { statusText, statusCode, headers, body, webSocket } = result;
+
+  return new Response(body, {
+    status: statusCode,
+    statusText: statusText,
+    headers,
+    // set when fetch was a WebSocket upgrade
+    webSocket,
+  } as ResponseInit);
+};
+
+// this is a helper for FetchEvent.passThrough
+const __runtimeRequestHelper = (
+  input: Request | string,
+  options?: RequestInit
+) => {
+  let request: Request;
+  if (input instanceof Request) {
+    // Request polyfill turns the body into a ReadableStream, and only takes
+    // the headers from options when input is a Request
+    request =
+      options === undefined
+        ? input
+        : new Request(input.url, {
+            method: (options.method ?? input.method) as any,
+            headers: options.headers ?? input.headers,
+            body:
+              options.body !== undefined
+                ? (options.body as any)
+                : (input as any).bodyInit,
+          });
+  } else {
+    request = new Request(input, options as any);
+  }
+
+  const requestBody = request as Body;
+  let useBody: ReadableStream | ArrayBuffer | string | undefined;
+  if (requestBody._bodyReadableStream) {
+    useBody = requestBody._bodyReadableStream;
+  } else if (requestBody._bodyArrayBuffer) {
+    useBody = requestBody._bodyArrayBuffer.slice(0);
+  } else if (requestBody._bodyText) {
+    useBody = requestBody._bodyText;
+  }
+
+  return {
+    url: request.url,
+    method: request.method,
+    headers: __runtimeHeadersValues(request.headers),
+    body: useBody,
   };
 };
 
@@ -65,15 +143,26 @@ const __runtimeResponseHelper = async (response: Response) => {
   }
 
   const { status, headers } = response;
+  const webSocket = (response as any).webSocket;
+  const flush = (response as any)._flush === true;
 
   const requestBody = response as Body;
-  let useBody: ReadableStream | string | undefined;
+  let useBody: ReadableStream | ArrayBuffer | string | undefined;
   if (requestBody._bodyReadableStream) {
     useBody = requestBody._bodyReadableStream;
-  } else if (requestBody._bodyArrayBuffer || requestBody._bodyText) {
+  } else if (requestBody._bodyArrayBuffer) {
+    // pass the bytes as-is, .text() would corrupt non-UTF-8 content
+    useBody = await requestBody.arrayBuffer();
+  } else if (requestBody._bodyText) {
     useBody = await requestBody.text();
   }
 
-  // .map property is the backing storage of headers
-  return { ok: true, status, headers: (headers as any).map, body: useBody };
+  return {
+    ok: true,
+    status,
+    headers: __runtimeHeadersValues(headers),
+    body: useBody,
+    webSocket,
+    flush,
+  };
 };
@@ -0,0 +1,210 @@
+package form
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"go.miragespace.co/heresy/extensions/blob"
+	"go.miragespace.co/heresy/extensions/common"
+	"go.miragespace.co/heresy/extensions/stream"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja_nodejs/eventloop"
+)
+
+// FormParser parses multipart/form-data and application/x-www-form-urlencoded
+// bodies into FormData. File parts are exposed as File objects, which are
+// backed by a temp file when they are larger than Limits.MaxMemory.
+type FormParser struct {
+	eventLoop   *eventloop.EventLoop
+	stream      *stream.StreamController
+	limits      Limits
+	fromEntries goja.Callable
+}
+
+// NewFormParser installs File and FormData in the runtime, and implements
+// Body.formData() for Request and Response created by scripts.
+// It must be called after blob.PolyfillBlob.
+func NewFormParser(eventLoop *eventloop.EventLoop, stream *stream.StreamController, limits Limits) (*FormParser, error) {
+	p := &FormParser{
+		eventLoop: eventLoop,
+		stream:    stream,
+		limits:    limits.withDefaults(),
+	}
+
+	// the body passed to parse is already in memory
+	inMemory := p.limits
+	inMemory.MaxMemory = inMemory.MaxPartSize
+
+	setup := make(chan error, 1)
+	eventLoop.RunOnLoop(func(vm *goja.Runtime) {
+		_, err := vm.RunProgram(formWrapperProg)
+		if err != nil {
+			setup <- err
+			return
+		}
+
+		wrapper, ok := goja.AssertFunction(vm.Get(formWrapperSymbol))
+		if !ok {
+			setup <- fmt.Errorf("internal error: %s is not a function", formWrapperSymbol)
+			return
+		}
+
+		native := vm.NewObject()
+		native.Set("parse", func(fc goja.FunctionCall) goja.Value {
+			b, ok := blob.AssertBytes(fc.Argument(1), vm)
+			if !ok {
+				b = []byte(fc.Argument(1).String())
+			}
+			entries, err := parse(fc.Argument(0).String(), bytes.NewReader(b), inMemory)
+			if err != nil {
+				panic(vm.NewTypeError("formData: %s", err.Error()))
+			}
+			return p.entriesVM(nil, vm, entries)
+		})
+
+		fromEntries, err := wrapper(goja.Undefined(), native)
+		if err != nil {
+			setup <- err
+			return
+		}
+		p.fromEntries, ok = goja.AssertFunction(fromEntries)
+		if !ok {
+			setup <- fmt.Errorf("internal error: %s did not return a function", formWrapperSymbol)
+			return
+		}
+
+		setup <- nil
+	})
+
+	if err := <-setup; err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *FormParser) entriesVM(t *common.IOContext, vm *goja.Runtime, entries []entry) goja.Value {
+	values := make([]any, 0, len(entries))
+	for _, e := range entries {
+		if !e.file {
+			values = append(values, vm.NewArray(e.name, e.value))
+			continue
+		}
+		file := vm.NewObject()
+		if e.spill != nil {
+			file.Set("source", p.newSourceVM(t, vm, e.spill, e.size))
+		} else {
+			file.Set("bytes", vm.NewArrayBuffer(e.data))
+		}
+		file.Set("filename", e.filename)
+		file.Set("type", e.contentType)
+		values = append(values, vm.NewArray(e.name, file))
+	}
+	return vm.NewArray(values...)
+}
+
+// fileSource is the blob.Source of a File kept in a temp file
+type fileSource struct {
+	f    *os.File
+	size int64
+}
+
+var _ blob.Source = (*fileSource)(nil)
+
+func (s *fileSource) NewReader() io.Reader {
+	return io.NewSectionReader(s.f, 0, s.size)
+}
+
+// newSourceVM returns the source of a File kept in the temp file f, which is
+// read off the loop by arrayBuffer(), text() and stream() of the File, and
+// streamed from Go when the File is used as a body
+func (p *FormParser) newSourceVM(t *common.IOContext, vm *goja.Runtime, f *os.File, size int64) goja.Value {
+	source := vm.NewObject()
+	source.Set("native", &fileSource{f: f, size: size})
+	source.Set("size", size)
+	source.Set("bytes", func(goja.FunctionCall) goja.Value {
+		b, err := readAll(f, size)
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		return vm.ToValue(vm.NewArrayBuffer(b))
+	})
+	source.Set("read", func(goja.FunctionCall) goja.Value {
+		promise, resolve, reject := vm.NewPromise()
+		go func() {
+			b, err := readAll(f, size)
+			p.eventLoop.RunOnLoop(func(vm *goja.Runtime) {
+				if err != nil {
+					reject(vm.NewGoError(err))
+					return
+				}
+				resolve(vm.NewArrayBuffer(b))
+			})
+		}()
+		return vm.ToValue(promise)
+	})
+	source.Set("stream", func(goja.FunctionCall) goja.Value {
+		r := io.NopCloser(io.NewSectionReader(f, 0, size))
+		return p.stream.NewReadableStreamVM(t, r, vm).NativeStream()
+	})
+	return source
+}
+
+func readAll(f *os.File, size int64) ([]byte, error) {
+	b := make([]byte, size)
+	if _, err := f.ReadAt(b, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return b, nil
+}
+
+// NewFormDataVM returns a Promise resolving to the FormData parsed from body.
+// body is read off the loop, and must not be read by anything else. Files
+// backed by a temp file can be read until the request is handled.
+func (p *FormParser) NewFormDataVM(t *common.IOContext, vm *goja.Runtime, contentType string, body io.Reader) goja.Value {
+	promise, resolve, reject := vm.NewPromise()
+
+	// the request may conclude before the body is parsed
+	var (
+		mu       sync.Mutex
+		parsed   []entry
+		released bool
+	)
+	t.RegisterCleanup(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		released = true
+		release(parsed)
+	})
+
+	go func() {
+		entries, err := parse(contentType, body, p.limits)
+		mu.Lock()
+		if released {
+			mu.Unlock()
+			release(entries)
+			return
+		}
+		parsed = entries
+		mu.Unlock()
+
+		p.eventLoop.RunOnLoop(func(vm *goja.Runtime) {
+			if err != nil {
+				reject(vm.NewTypeError("formData: %s", err.Error()))
+				return
+			}
+			form, err := p.fromEntries(goja.Undefined(), p.entriesVM(t, vm, entries))
+			if err != nil {
+				reject(vm.NewGoError(err))
+				return
+			}
+			resolve(form)
+		})
+	}()
+
+	return vm.ToValue(promise)
+}
@@ -0,0 +1,249 @@
+package form
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"strings"
+)
+
+var (
+	ErrBodyTooLarge = errors.New("form body exceeds the size limit")
+	ErrPartTooLarge = errors.New("form part exceeds the size limit")
+	ErrTooManyParts = errors.New("form exceeds the number of parts limit")
+)
+
+// Limits of formData() parsing. Zero values use the respective default.
+type Limits struct {
+	// MaxSize is the limit of the entire body in bytes
+	MaxSize int64
+	// MaxPartSize is the limit of a single value or file in bytes
+	MaxPartSize int64
+	// MaxParts is the limit of the number of entries
+	MaxParts int
+	// MaxMemory is the size of a file kept in memory before spilling to a
+	// temp file. Values of fields are always kept in memory.
+	MaxMemory int64
+	// TempDir is the directory of temp files, os.TempDir() if empty
+	TempDir string
+}
+
+var DefaultLimits = Limits{
+	MaxSize:     32 << 20,
+	MaxPartSize: 10 << 20,
+	MaxParts:    1000,
+	MaxMemory:   1 << 20,
+}
+
+func (l Limits) withDefaults() Limits {
+	if l.MaxSize <= 0 {
+		l.MaxSize = DefaultLimits.MaxSize
+	}
+	if l.MaxPartSize <= 0 {
+		l.MaxPartSize = DefaultLimits.MaxPartSize
+	}
+	if l.MaxParts <= 0 {
+		l.MaxParts = DefaultLimits.MaxParts
+	}
+	if l.MaxMemory <= 0 {
+		l.MaxMemory = DefaultLimits.MaxMemory
+	}
+	return l
+}
+
+// entry is a string value, or a file if filename is set. The content of a
+// file is in data, or in spill if it is larger than Limits.MaxMemory.
+type entry struct {
+	name        string
+	value       string
+	file        bool
+	filename    string
+	contentType string
+	data        []byte
+	spill       *os.File
+	size        int64
+}
+
+// release removes the temp files of entries
+func release(entries []entry) {
+	for _, e := range entries {
+		if e.spill != nil {
+			e.spill.Close()
+			os.Remove(e.spill.Name())
+		}
+	}
+}
+
+// parse reads the body according to contentType. Parts of multipart bodies are
+// read from body as they arrive, so a body over the limits is rejected without
+// reading the rest of it. Files larger than limits.MaxMemory are copied to temp
+// files, which must be removed with release.
+func parse(contentType string, body io.Reader, limits Limits) ([]entry, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content-type %q: %w", contentType, err)
+	}
+
+	// one more byte to tell if the body was truncated
+	lr := &io.LimitedReader{R: body, N: limits.MaxSize + 1}
+
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		return parseURLEncoded(lr, limits)
+	case "multipart/form-data":
+		boundary := params["boundary"]
+		if boundary == "" {
+			return nil, fmt.Errorf("missing boundary in content-type")
+		}
+		entries, err := parseMultipart(multipart.NewReader(lr, boundary), limits)
+		if lr.N <= 0 {
+			// parsing a truncated body usually fails before the limit is noticed
+			release(entries)
+			entries, err = nil, ErrBodyTooLarge
+		}
+		if err != nil {
+			return nil, err
+		}
+		return entries, nil
+	default:
+		return nil, fmt.Errorf("unsupported content-type %q", mediaType)
+	}
+}
+
+func parseURLEncoded(lr *io.LimitedReader, limits Limits) ([]entry, error) {
+	b, err := io.ReadAll(lr)
+	if err != nil {
+		return nil, err
+	}
+	if lr.N <= 0 {
+		return nil, ErrBodyTooLarge
+	}
+
+	// url.ParseQuery does not keep the order of the keys
+	var entries []entry
+	for _, pair := range strings.Split(string(b), "&") {
+		if pair == "" {
+			continue
+		}
+		if len(entries) >= limits.MaxParts {
+			return nil, ErrTooManyParts
+		}
+		name, value, _ := strings.Cut(pair, "=")
+		if name, err = url.QueryUnescape(name); err != nil {
+			return nil, err
+		}
+		if value, err = url.QueryUnescape(value); err != nil {
+			return nil, err
+		}
+		if int64(len(value)) > limits.MaxPartSize {
+			return nil, ErrPartTooLarge
+		}
+		entries = append(entries, entry{name: name, value: value})
+	}
+	return entries, nil
+}
+
+func parseMultipart(mr *multipart.Reader, limits Limits) (entries []entry, err error) {
+	defer func() {
+		if err != nil {
+			release(entries)
+			entries = nil
+		}
+	}()
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+
+		name := part.FormName()
+		if name == "" {
+			// not a form field
+			part.Close()
+			continue
+		}
+		if len(entries) >= limits.MaxParts {
+			part.Close()
+			return entries, ErrTooManyParts
+		}
+
+		e := entry{name: name}
+		if isFile(part) {
+			e.file = true
+			e.filename = part.FileName()
+			e.contentType = part.Header.Get("content-type")
+			if e.contentType == "" {
+				e.contentType = "application/octet-stream"
+			}
+			err = readFile(&e, part, limits)
+		} else {
+			var buf bytes.Buffer
+			var n int64
+			n, err = buf.ReadFrom(io.LimitReader(part, limits.MaxPartSize+1))
+			if err == nil && n > limits.MaxPartSize {
+				err = ErrPartTooLarge
+			}
+			e.value = buf.String()
+		}
+		part.Close()
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+}
+
+// readFile reads a file part into memory, and spills it to a temp file once
+// it is larger than limits.MaxMemory
+func readFile(e *entry, part io.Reader, limits Limits) error {
+	lr := &io.LimitedReader{R: part, N: limits.MaxPartSize + 1}
+
+	var buf bytes.Buffer
+	n, err := buf.ReadFrom(io.LimitReader(lr, limits.MaxMemory+1))
+	if err != nil {
+		return err
+	}
+	if n > limits.MaxPartSize {
+		return ErrPartTooLarge
+	}
+	if n <= limits.MaxMemory {
+		e.data = buf.Bytes()
+		e.size = n
+		return nil
+	}
+
+	f, err := os.CreateTemp(limits.TempDir, "heresy-form-*")
+	if err != nil {
+		return err
+	}
+	if n, err = io.Copy(f, io.MultiReader(&buf, lr)); err == nil && n > limits.MaxPartSize {
+		err = ErrPartTooLarge
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	e.spill = f
+	e.size = n
+	return nil
+}
+
+// a part with a filename parameter is a file, even if the filename is empty
+func isFile(part *multipart.Part) bool {
+	_, params, err := mime.ParseMediaType(part.Header.Get("content-disposition"))
+	if err != nil {
+		return false
+	}
+	_, ok := params["filename"]
+	return ok
+}
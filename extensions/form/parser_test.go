@@ -0,0 +1,173 @@
+package form
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+)
+
+type testPart struct {
+	name     string
+	filename string // a file if not empty
+	content  string
+}
+
+func multipartBody(t *testing.T, parts ...testPart) (string, *bytes.Buffer) {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, p := range parts {
+		var (
+			pw  io.Writer
+			err error
+		)
+		if p.filename != "" {
+			h := textproto.MIMEHeader{}
+			h.Set("Content-Disposition", `form-data; name="`+p.name+`"; filename="`+p.filename+`"`)
+			pw, err = w.CreatePart(h)
+		} else {
+			pw, err = w.CreateFormField(p.name)
+		}
+		if err != nil {
+			t.Fatalf("multipart: %v", err)
+		}
+		pw.Write([]byte(p.content))
+	}
+	w.Close()
+	return w.FormDataContentType(), &body
+}
+
+func testLimits(t *testing.T) Limits {
+	return Limits{MaxMemory: 16, TempDir: t.TempDir()}.withDefaults()
+}
+
+func TestParseURLEncoded(t *testing.T) {
+	entries, err := parse("application/x-www-form-urlencoded", strings.NewReader("b=2&a=1&b=%E2%9C%93+x&&c"), testLimits(t))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := [][2]string{{"b", "2"}, {"a", "1"}, {"b", "✓ x"}, {"c", ""}}
+	if len(entries) != len(want) {
+		t.Fatalf("expected %d entries, got %d", len(want), len(entries))
+	}
+	for i, e := range entries {
+		if e.name != want[i][0] || e.value != want[i][1] || e.file {
+			t.Errorf("entry %d = %q=%q, want %q=%q", i, e.name, e.value, want[i][0], want[i][1])
+		}
+	}
+
+	if _, err := parse("application/x-www-form-urlencoded", strings.NewReader("a=%ZZ"), testLimits(t)); err == nil {
+		t.Errorf("expected an error for a malformed escape")
+	}
+}
+
+func TestParseMultipart(t *testing.T) {
+	limits := testLimits(t)
+	large := strings.Repeat("x", 64)
+	contentType, body := multipartBody(t,
+		testPart{name: "field", content: "value"},
+		testPart{name: "small", filename: "a.txt", content: "hello"},
+		testPart{name: "large", filename: "b.bin", content: large},
+	)
+
+	entries, err := parse(contentType, body, limits)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	defer release(entries)
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+
+	if e := entries[0]; e.file || e.name != "field" || e.value != "value" {
+		t.Errorf("field = %+v", e)
+	}
+
+	small := entries[1]
+	if !small.file || small.filename != "a.txt" || string(small.data) != "hello" || small.spill != nil || small.size != 5 {
+		t.Errorf("small file = %+v", small)
+	}
+	if small.contentType != "application/octet-stream" {
+		t.Errorf("default content type = %q", small.contentType)
+	}
+
+	// files over MaxMemory are spilled to a temp file
+	spilled := entries[2]
+	if spilled.spill == nil || spilled.data != nil || spilled.size != int64(len(large)) {
+		t.Fatalf("large file = %+v", spilled)
+	}
+	b, err := io.ReadAll(io.NewSectionReader(spilled.spill, 0, spilled.size))
+	if err != nil || string(b) != large {
+		t.Fatalf("spilled content = %q, %v", b, err)
+	}
+
+	release(entries)
+	if _, err := os.Stat(spilled.spill.Name()); !os.IsNotExist(err) {
+		t.Errorf("release did not remove the temp file: %v", err)
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		limits Limits
+		parts  []testPart
+		want   error
+	}{
+		{
+			name:   "part",
+			limits: Limits{MaxPartSize: 8},
+			parts:  []testPart{{name: "a", content: strings.Repeat("x", 9)}},
+			want:   ErrPartTooLarge,
+		},
+		{
+			name:   "file",
+			limits: Limits{MaxPartSize: 32, MaxMemory: 4},
+			parts:  []testPart{{name: "a", filename: "a", content: strings.Repeat("x", 33)}},
+			want:   ErrPartTooLarge,
+		},
+		{
+			name:   "parts",
+			limits: Limits{MaxParts: 2},
+			parts:  []testPart{{name: "a"}, {name: "b"}, {name: "c"}},
+			want:   ErrTooManyParts,
+		},
+		{
+			name:   "body",
+			limits: Limits{MaxSize: 256},
+			parts:  []testPart{{name: "a", content: strings.Repeat("x", 512)}},
+			want:   ErrBodyTooLarge,
+		},
+	} {
+		limits := tc.limits
+		limits.TempDir = t.TempDir()
+		contentType, body := multipartBody(t, tc.parts...)
+		_, err := parse(contentType, body, limits.withDefaults())
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, err)
+		}
+		if entries, _ := os.ReadDir(limits.TempDir); len(entries) != 0 {
+			t.Errorf("%s: temp files were left behind", tc.name)
+		}
+	}
+
+	if _, err := parse("application/x-www-form-urlencoded", strings.NewReader("a=1&b=2&c=3"), Limits{MaxParts: 2}.withDefaults()); !errors.Is(err, ErrTooManyParts) {
+		t.Errorf("urlencoded: expected ErrTooManyParts, got %v", err)
+	}
+	if _, err := parse("application/x-www-form-urlencoded", strings.NewReader(strings.Repeat("a", 64)), Limits{MaxSize: 32}.withDefaults()); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("urlencoded: expected ErrBodyTooLarge, got %v", err)
+	}
+}
+
+func TestParseContentType(t *testing.T) {
+	for _, contentType := range []string{"", "text/plain", "multipart/form-data"} {
+		if _, err := parse(contentType, strings.NewReader(""), testLimits(t)); err == nil {
+			t.Errorf("parse(%q): expected an error", contentType)
+		}
+	}
+}
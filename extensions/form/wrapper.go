@@ -0,0 +1,16 @@
+package form
+
+import (
+	_ "embed"
+
+	"github.com/dop251/goja"
+)
+
+const (
+	formWrapperSymbol = "__runtimeFormData"
+)
+
+//go:embed wrapper.js
+var formWrapperScript string
+
+var formWrapperProg = goja.MustCompile("form", formWrapperScript, false)
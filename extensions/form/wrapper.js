@@ -0,0 +1,158 @@
+const __runtimeFormData = (goWrapper) => {
+    // Blob is installed by the blob extension
+    class RuntimeFile extends Blob {
+        constructor(bits, name, options) {
+            var _a;
+            super(bits, options);
+            this.name = String(name);
+            this.lastModified = (_a = options === null || options === void 0 ? void 0 : options.lastModified) !== null && _a !== void 0 ? _a : Date.now();
+        }
+        get [Symbol.toStringTag]() {
+            return "File";
+        }
+    }
+    // File of a part in a temp file, which is read on demand instead of being
+    // copied into memory by the Blob constructor
+    class RuntimeFormFile extends RuntimeFile {
+        constructor(source, name, type) {
+            super([], name, { type });
+            this._source = source;
+        }
+        // read by the Blob constructor and slice(), bodies stream it in Go instead
+        get _bytes() {
+            return new Uint8Array(this._source.bytes());
+        }
+        set _bytes(_) { }
+        get size() {
+            return this._source.size;
+        }
+        arrayBuffer() {
+            return this._source.read();
+        }
+        async text() {
+            return new TextDecoder().decode(await this._source.read());
+        }
+        stream() {
+            return this._source.stream();
+        }
+    }
+    if (typeof File === "undefined") {
+        Object.defineProperty(globalThis, "File", {
+            value: RuntimeFile,
+            writable: true,
+            configurable: true,
+        });
+    }
+    const toValue = (value, filename) => {
+        var _a;
+        if (!(value instanceof Blob)) {
+            return String(value);
+        }
+        if (value instanceof File && filename === undefined) {
+            return value;
+        }
+        return new File([value], (_a = filename !== null && filename !== void 0 ? filename : value.name) !== null && _a !== void 0 ? _a : "blob", {
+            type: value.type,
+        });
+    };
+    class RuntimeFormData {
+        constructor() {
+            this._entries = [];
+        }
+        append(name, value, filename) {
+            this._entries.push([String(name), toValue(value, filename)]);
+        }
+        set(name, value, filename) {
+            name = String(name);
+            const entry = [name, toValue(value, filename)];
+            const index = this._entries.findIndex(([n]) => n === name);
+            if (index < 0) {
+                this._entries.push(entry);
+                return;
+            }
+            this._entries[index] = entry;
+            for (let i = this._entries.length - 1; i > index; i--) {
+                if (this._entries[i][0] === name) {
+                    this._entries.splice(i, 1);
+                }
+            }
+        }
+        get(name) {
+            name = String(name);
+            const entry = this._entries.find(([n]) => n === name);
+            return entry ? entry[1] : null;
+        }
+        getAll(name) {
+            name = String(name);
+            return this._entries.filter(([n]) => n === name).map(([, v]) => v);
+        }
+        has(name) {
+            name = String(name);
+            return this._entries.some(([n]) => n === name);
+        }
+        delete(name) {
+            name = String(name);
+            for (let i = this._entries.length - 1; i >= 0; i--) {
+                if (this._entries[i][0] === name) {
+                    this._entries.splice(i, 1);
+                }
+            }
+        }
+        forEach(callback, thisArg) {
+            for (const [name, value] of this._entries) {
+                callback.call(thisArg, value, name, this);
+            }
+        }
+        *entries() {
+            for (const [name, value] of this._entries) {
+                yield [name, value];
+            }
+        }
+        *keys() {
+            for (const [name] of this._entries) {
+                yield name;
+            }
+        }
+        *values() {
+            for (const [, value] of this._entries) {
+                yield value;
+            }
+        }
+        [Symbol.iterator]() {
+            return this.entries();
+        }
+        get [Symbol.toStringTag]() {
+            return "FormData";
+        }
+    }
+    if (typeof FormData === "undefined") {
+        Object.defineProperty(globalThis, "FormData", {
+            value: RuntimeFormData,
+            writable: true,
+            configurable: true,
+        });
+    }
+    const fromEntries = (entries) => {
+        const form = new FormData();
+        for (const [name, value] of entries) {
+            if (typeof value === "string") {
+                form.append(name, value);
+            }
+            else if (value.source) {
+                form.append(name, new RuntimeFormFile(value.source, value.filename, value.type));
+            }
+            else {
+                form.append(name, new File([value.bytes], value.filename, { type: value.type }));
+            }
+        }
+        return form;
+    };
+    // Body is not exported by the polyfill
+    const Body = Object.getPrototypeOf(Response.prototype);
+    Body.formData = async function () {
+        var _a;
+        const contentType = (_a = this.headers.get("content-type")) !== null && _a !== void 0 ? _a : "";
+        return fromEntries(goWrapper.parse(contentType, await this.arrayBuffer()));
+    };
+    return fromEntries;
+};
@@ -0,0 +1,222 @@
+// a file larger than the memory limit is kept in a temp file by Go
+interface RuntimeFormFileSource {
+  readonly size: number;
+  bytes(): ArrayBuffer;
+  read(): Promise<ArrayBuffer>;
+  stream(): ReadableStream;
+}
+
+type RuntimeFormEntry = [
+  string,
+  | string
+  | {
+      bytes?: ArrayBuffer;
+      source?: RuntimeFormFileSource;
+      filename: string;
+      type: string;
+    }
+];
+
+interface RuntimeFormHandler {
+  parse(contentType: string, body: ArrayBuffer): RuntimeFormEntry[];
+}
+
+interface RuntimeFilePropertyBag {
+  type?: string;
+  lastModified?: number;
+}
+
+const __runtimeFormData = (goWrapper: RuntimeFormHandler) => {
+  // Blob is installed by the blob extension
+  class RuntimeFile extends (Blob as any) {
+    readonly name: string;
+    readonly lastModified: number;
+
+    constructor(bits: any[], name: string, options?: RuntimeFilePropertyBag) {
+      super(bits, options);
+      this.name = String(name);
+      this.lastModified = options?.lastModified ?? Date.now();
+    }
+
+    get [Symbol.toStringTag]() {
+      return "File";
+    }
+  }
+
+  // File of a part in a temp file, which is read on demand instead of being
+  // copied into memory by the Blob constructor
+  class RuntimeFormFile extends RuntimeFile {
+    private readonly _source: RuntimeFormFileSource;
+
+    constructor(source: RuntimeFormFileSource, name: string, type: string) {
+      super([], name, { type });
+      this._source = source;
+    }
+
+    // read by the Blob constructor and slice(), bodies stream it in Go instead
+    get _bytes(): Uint8Array {
+      return new Uint8Array(this._source.bytes());
+    }
+
+    set _bytes(_: Uint8Array) {}
+
+    get size() {
+      return this._source.size;
+    }
+
+    arrayBuffer(): Promise<ArrayBuffer> {
+      return this._source.read();
+    }
+
+    async text(): Promise<string> {
+      return new TextDecoder().decode(await this._source.read());
+    }
+
+    stream(): ReadableStream {
+      return this._source.stream();
+    }
+  }
+
+  if (typeof File === "undefined") {
+    Object.defineProperty(globalThis, "File", {
+      value: RuntimeFile,
+      writable: true,
+      configurable: true,
+    });
+  }
+
+  type FormDataValue = string | File;
+
+  const toValue = (value: any, filename?: string): FormDataValue => {
+    if (!(value instanceof Blob)) {
+      return String(value);
+    }
+    if (value instanceof File && filename === undefined) {
+      return value;
+    }
+    return new File([value], filename ?? (value as any).name ?? "blob", {
+      type: value.type,
+    });
+  };
+
+  class RuntimeFormData {
+    private readonly _entries: [string, FormDataValue][] = [];
+
+    append(name: string, value: any, filename?: string) {
+      this._entries.push([String(name), toValue(value, filename)]);
+    }
+
+    set(name: string, value: any, filename?: string) {
+      name = String(name);
+      const entry: [string, FormDataValue] = [name, toValue(value, filename)];
+      const index = this._entries.findIndex(([n]) => n === name);
+      if (index < 0) {
+        this._entries.push(entry);
+        return;
+      }
+      this._entries[index] = entry;
+      for (let i = this._entries.length - 1; i > index; i--) {
+        if (this._entries[i][0] === name) {
+          this._entries.splice(i, 1);
+        }
+      }
+    }
+
+    get(name: string): FormDataValue | null {
+      name = String(name);
+      const entry = this._entries.find(([n]) => n === name);
+      return entry ? entry[1] : null;
+    }
+
+    getAll(name: string): FormDataValue[] {
+      name = String(name);
+      return this._entries.filter(([n]) => n === name).map(([, v]) => v);
+    }
+
+    has(name: string) {
+      name = String(name);
+      return this._entries.some(([n]) => n === name);
+    }
+
+    delete(name: string) {
+      name = String(name);
+      for (let i = this._entries.length - 1; i >= 0; i--) {
+        if (this._entries[i][0] === name) {
+          this._entries.splice(i, 1);
+        }
+      }
+    }
+
+    forEach(
+      callback: (value: FormDataValue, name: string, parent: any) => void,
+      thisArg?: any
+    ) {
+      for (const [name, value] of this._entries) {
+        callback.call(thisArg, value, name, this);
+      }
+    }
+
+    *entries(): IterableIterator<[string, FormDataValue]> {
+      for (const [name, value] of this._entries) {
+        yield [name, value];
+      }
+    }
+
+    *keys(): IterableIterator<string> {
+      for (const [name] of this._entries) {
+        yield name;
+      }
+    }
+
+    *values(): IterableIterator<FormDataValue> {
+      for (const [, value] of this._entries) {
+        yield value;
+      }
+    }
+
+    [Symbol.iterator]() {
+      return this.entries();
+    }
+
+    get [Symbol.toStringTag]() {
+      return "FormData";
+    }
+  }
+
+  if (typeof FormData === "undefined") {
+    Object.defineProperty(globalThis, "FormData", {
+      value: RuntimeFormData,
+      writable: true,
+      configurable: true,
+    });
+  }
+
+  const fromEntries = (entries: RuntimeFormEntry[]): FormData => {
+    const form = new FormData();
+    for (const [name, value] of entries) {
+      if (typeof value === "string") {
+        form.append(name, value);
+      } else if (value.source) {
+        form.append(
+          name,
+          new RuntimeFormFile(value.source, value.filename, value.type) as any
+        );
+      } else {
+        form.append(
+          name,
+          new File([value.bytes], value.filename, { type: value.type })
+        );
+      }
+    }
+    return form;
+  };
+
+  // Body is not exported by the polyfill
+  const Body = Object.getPrototypeOf(Response.prototype);
+  Body.formData = async function (this: Response) {
+    const contentType = this.headers.get("content-type") ?? "";
+    return fromEntries(goWrapper.parse(contentType, await this.arrayBuffer()));
+  };
+
+  return fromEntries;
+};
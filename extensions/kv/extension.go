@@ -1,6 +1,8 @@
 package kv
 
 import (
+	"go.miragespace.co/heresy/extensions/common"
+
 	"github.com/dop251/goja"
 	"github.com/dop251/goja_nodejs/eventloop"
 	"github.com/puzpuzpuz/xsync/v2"
@@ -10,6 +12,8 @@ type KVManager struct {
 	kvMapping *xsync.MapOf[string, KV]
 }
 
+var _ common.Extension = (*KVManager)(nil)
+
 func NewKVManager() *KVManager {
 	return &KVManager{
 		kvMapping: xsync.NewMapOf[KV](),
@@ -42,3 +46,15 @@ func (m *KVManager) Configure(name string, uri string) error {
 func (m *KVManager) GetKVMapper(vm *goja.Runtime, eventLoop *eventloop.EventLoop) *KVMapper {
 	return newKVMapper(m.kvMapping, vm, eventLoop)
 }
+
+func (m *KVManager) Name() string {
+	return "kv"
+}
+
+func (m *KVManager) Enabled(_ common.HandlerOptions) bool {
+	return true
+}
+
+func (m *KVManager) New(vm *goja.Runtime, eventLoop *eventloop.EventLoop) common.ExtensionInstance {
+	return m.GetKVMapper(vm, eventLoop)
+}
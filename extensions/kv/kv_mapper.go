@@ -17,6 +17,7 @@ type KVMapper struct {
 }
 
 var _ goja.DynamicObject = (*KVMapper)(nil)
+var _ common.ExtensionInstance = (*KVMapper)(nil)
 
 func newKVMapper(bMap *xsync.MapOf[string, KV], vm *goja.Runtime, eventLoop *eventloop.EventLoop) *KVMapper {
 	m := &KVMapper{
@@ -0,0 +1,213 @@
+package native
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"unicode"
+
+	"go.miragespace.co/heresy/extensions/abort"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja_nodejs/eventloop"
+	"github.com/dop251/goja_nodejs/require"
+)
+
+var (
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
+// ModuleFactory returns a require.ModuleLoader bound to the event loop of a shard.
+// The factory is invoked once per shard on every script reload, and ctx is
+// canceled when the shard is stopped by the next reload.
+type ModuleFactory func(ctx context.Context, eventLoop *eventloop.EventLoop) require.ModuleLoader
+
+// AsyncModule returns a ModuleFactory that exposes the exported methods of impl
+// as a JavaScript module. Each method is exported with its first letter lowercased
+// (e.g. GetUser becomes getUser), and calling it returns a Promise. The Go method
+// is invoked on its own goroutine, so slow methods do not block the event loop.
+//
+// Supported method signatures are func(args...), func(args...) T,
+// func(args...) error and func(args...) (T, error). If the first parameter is
+// a context.Context, it is canceled when the shard is reloaded, or when the
+// AbortSignal passed after the last argument aborts, such as the signal of the
+// request. Arguments are converted with (*goja.Runtime).ExportTo, and a
+// non-nil error rejects the Promise.
+//
+//	func (u *Users) Lookup(ctx context.Context, id int) (*User, error)
+//	// await users.lookup(42, req.signal)
+func AsyncModule(impl any) (ModuleFactory, error) {
+	v := reflect.ValueOf(impl)
+	if !v.IsValid() {
+		return nil, fmt.Errorf("native: module implementation cannot be nil")
+	}
+
+	t := v.Type()
+	methods := make([]asyncMethod, 0, t.NumMethod())
+	for i := 0; i < t.NumMethod(); i++ {
+		m := t.Method(i)
+		fn := v.Method(i)
+		if err := validateMethod(fn.Type()); err != nil {
+			return nil, fmt.Errorf("native: method %s: %w", m.Name, err)
+		}
+		methods = append(methods, asyncMethod{
+			name: uncapitalize(m.Name),
+			fn:   fn,
+		})
+	}
+
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("native: %s has no exported methods", t)
+	}
+
+	return func(ctx context.Context, eventLoop *eventloop.EventLoop) require.ModuleLoader {
+		return func(vm *goja.Runtime, module *goja.Object) {
+			o := module.Get("exports").(*goja.Object)
+			for _, m := range methods {
+				o.Set(m.name, m.nativeFunc(ctx, eventLoop))
+			}
+		}
+	}, nil
+}
+
+type asyncMethod struct {
+	name string
+	fn   reflect.Value
+}
+
+func validateMethod(t reflect.Type) error {
+	switch t.NumOut() {
+	case 0:
+	case 1:
+	case 2:
+		if t.Out(1) != errorType {
+			return fmt.Errorf("second return value must be an error")
+		}
+	default:
+		return fmt.Errorf("expecting at most 2 return values, got %d", t.NumOut())
+	}
+	return nil
+}
+
+func (m asyncMethod) nativeFunc(ctx context.Context, eventLoop *eventloop.EventLoop) func(goja.FunctionCall, *goja.Runtime) goja.Value {
+	t := m.fn.Type()
+	withContext := t.NumIn() > 0 && t.In(0) == contextType
+
+	return func(fc goja.FunctionCall, vm *goja.Runtime) goja.Value {
+		promise, resolve, reject := vm.NewPromise()
+
+		args, err := m.convertArgs(fc, vm)
+		if err != nil {
+			reject(vm.NewTypeError("%s: %s", m.name, err))
+			return vm.ToValue(promise)
+		}
+
+		// done releases the context of the call on the loop once it returns
+		done := func() {}
+		if withContext {
+			callCtx, cancel := context.WithCancel(ctx)
+			args[0] = reflect.ValueOf(callCtx)
+			remove := func() {}
+			if !t.IsVariadic() {
+				remove, _ = abort.OnAbort(vm, fc.Argument(t.NumIn()-1), cancel)
+			}
+			done = func() {
+				cancel()
+				remove()
+			}
+		}
+
+		go func() {
+			var (
+				ret    any
+				retErr error
+			)
+
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						retErr = fmt.Errorf("%s: panic: %v", m.name, r)
+					}
+				}()
+				ret, retErr = m.unpack(t, m.fn.Call(args))
+			}()
+
+			eventLoop.RunOnLoop(func(vm *goja.Runtime) {
+				done()
+				if retErr != nil {
+					reject(vm.NewGoError(retErr))
+				} else {
+					resolve(ret)
+				}
+			})
+		}()
+
+		return vm.ToValue(promise)
+	}
+}
+
+func (m asyncMethod) convertArgs(fc goja.FunctionCall, vm *goja.Runtime) ([]reflect.Value, error) {
+	var (
+		t     = m.fn.Type()
+		args  = make([]reflect.Value, t.NumIn())
+		start = 0
+	)
+
+	if t.NumIn() > 0 && t.In(0) == contextType {
+		// set by nativeFunc
+		start = 1
+	}
+
+	for i := start; i < t.NumIn(); i++ {
+		in := t.In(i)
+		if t.IsVariadic() && i == t.NumIn()-1 {
+			rest := fc.Arguments
+			if len(rest) > i-start {
+				rest = rest[i-start:]
+			} else {
+				rest = nil
+			}
+			variadic := reflect.New(in)
+			if err := vm.ExportTo(vm.ToValue(rest), variadic.Interface()); err != nil {
+				return nil, fmt.Errorf("argument %d: %w", i-start, err)
+			}
+			args[i] = variadic.Elem()
+			continue
+		}
+		arg := reflect.New(in)
+		if v := fc.Argument(i - start); !goja.IsUndefined(v) {
+			if err := vm.ExportTo(v, arg.Interface()); err != nil {
+				return nil, fmt.Errorf("argument %d: %w", i-start, err)
+			}
+		}
+		args[i] = arg.Elem()
+	}
+
+	return args, nil
+}
+
+func (m asyncMethod) unpack(t reflect.Type, out []reflect.Value) (ret any, err error) {
+	switch t.NumOut() {
+	case 1:
+		if t.Out(0) == errorType {
+			err, _ = out[0].Interface().(error)
+			return nil, err
+		}
+		return out[0].Interface(), nil
+	case 2:
+		err, _ = out[1].Interface().(error)
+		if err != nil {
+			return nil, err
+		}
+		return out[0].Interface(), nil
+	default:
+		return nil, nil
+	}
+}
+
+func uncapitalize(s string) string {
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
@@ -0,0 +1,308 @@
+package rewriter
+
+import (
+	"bytes"
+	"html"
+
+	"github.com/dop251/goja"
+	nethtml "golang.org/x/net/html"
+)
+
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "keygen": true, "link": true,
+	"meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// content inserted by handlers, escaped unless { html: true }
+func contentBytes(content goja.Value, options goja.Value, vm *goja.Runtime) []byte {
+	s := content.String()
+	if !goja.IsUndefined(options) && !goja.IsNull(options) {
+		if asHTML := options.ToObject(vm).Get("html"); asHTML != nil && asHTML.ToBoolean() {
+			return []byte(s)
+		}
+	}
+	return []byte(html.EscapeString(s))
+}
+
+type openElement struct {
+	tag         string
+	name        string
+	attrs       []nethtml.Attribute
+	raw         []byte
+	matched     []int
+	selfClosing bool
+	void        bool
+	skipped     bool
+	modified    bool
+
+	before    []byte
+	prepend   []byte
+	inner     []byte
+	append    []byte
+	after     []byte
+	replace   []byte
+	innerSet  bool
+	replaced  bool
+	removed   bool
+	unwrapped bool
+}
+
+func newOpenElement(t token) *openElement {
+	return &openElement{
+		tag:         t.tok.Data,
+		name:        t.tok.Data,
+		attrs:       t.tok.Attr,
+		raw:         t.raw,
+		selfClosing: t.tt == nethtml.SelfClosingTagToken,
+		void:        t.tt == nethtml.SelfClosingTagToken || voidElements[t.tok.Data],
+	}
+}
+
+// skipContent reports whether the content from the source should be dropped
+func (el *openElement) skipContent() bool {
+	return el.removed || el.replaced || el.innerSet
+}
+
+func (el *openElement) startTag() []byte {
+	if !el.modified {
+		return el.raw
+	}
+	var b bytes.Buffer
+	b.WriteByte('<')
+	b.WriteString(el.name)
+	for _, a := range el.attrs {
+		b.WriteByte(' ')
+		b.WriteString(a.Key)
+		b.WriteString(`="`)
+		b.WriteString(html.EscapeString(a.Val))
+		b.WriteByte('"')
+	}
+	if el.selfClosing {
+		b.WriteString(" /")
+	}
+	b.WriteByte('>')
+	return b.Bytes()
+}
+
+func (el *openElement) writeStart(w *bytes.Buffer) {
+	w.Write(el.before)
+	switch {
+	case el.removed:
+	case el.replaced:
+		w.Write(el.replace)
+	default:
+		if !el.unwrapped {
+			w.Write(el.startTag())
+		}
+		w.Write(el.prepend)
+		if el.innerSet {
+			w.Write(el.inner)
+		}
+	}
+}
+
+func (el *openElement) writeEnd(w *bytes.Buffer, endTag []byte) {
+	if !el.removed && !el.replaced {
+		if !el.void {
+			w.Write(el.append)
+		}
+		if !el.unwrapped && endTag != nil {
+			if el.name != el.tag {
+				endTag = []byte("</" + el.name + ">")
+			}
+			w.Write(endTag)
+		}
+	}
+	w.Write(el.after)
+}
+
+func (el *openElement) setAttr(key, val string) {
+	el.modified = true
+	for i, a := range el.attrs {
+		if a.Key == key {
+			el.attrs[i].Val = val
+			return
+		}
+	}
+	el.attrs = append(el.attrs, nethtml.Attribute{Key: key, Val: val})
+}
+
+func (el *openElement) removeAttr(key string) {
+	for i, a := range el.attrs {
+		if a.Key == key {
+			el.modified = true
+			el.attrs = append(el.attrs[:i], el.attrs[i+1:]...)
+			return
+		}
+	}
+}
+
+func newElementObject(vm *goja.Runtime, el *openElement) goja.Value {
+	obj := vm.NewObject()
+	self := func(call func(fc goja.FunctionCall)) func(goja.FunctionCall) goja.Value {
+		return func(fc goja.FunctionCall) goja.Value {
+			call(fc)
+			return obj
+		}
+	}
+
+	obj.DefineAccessorProperty("tagName", vm.ToValue(func(goja.FunctionCall) goja.Value {
+		return vm.ToValue(el.name)
+	}), vm.ToValue(func(fc goja.FunctionCall) goja.Value {
+		el.name = fc.Argument(0).String()
+		el.modified = true
+		return goja.Undefined()
+	}), goja.FLAG_FALSE, goja.FLAG_TRUE)
+	obj.DefineAccessorProperty("attributes", vm.ToValue(func(goja.FunctionCall) goja.Value {
+		attrs := make([]any, 0, len(el.attrs))
+		for _, a := range el.attrs {
+			attrs = append(attrs, []any{a.Key, a.Val})
+		}
+		return vm.ToValue(attrs)
+	}), nil, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	obj.DefineAccessorProperty("removed", vm.ToValue(func(goja.FunctionCall) goja.Value {
+		return vm.ToValue(el.removed || el.replaced)
+	}), nil, goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	obj.Set("getAttribute", func(fc goja.FunctionCall) goja.Value {
+		if v, ok := getAttr(el.attrs, fc.Argument(0).String()); ok {
+			return vm.ToValue(v)
+		}
+		return goja.Null()
+	})
+	obj.Set("hasAttribute", func(fc goja.FunctionCall) goja.Value {
+		_, ok := getAttr(el.attrs, fc.Argument(0).String())
+		return vm.ToValue(ok)
+	})
+	obj.Set("setAttribute", self(func(fc goja.FunctionCall) {
+		el.setAttr(fc.Argument(0).String(), fc.Argument(1).String())
+	}))
+	obj.Set("removeAttribute", self(func(fc goja.FunctionCall) {
+		el.removeAttr(fc.Argument(0).String())
+	}))
+	obj.Set("before", self(func(fc goja.FunctionCall) {
+		el.before = append(el.before, contentBytes(fc.Argument(0), fc.Argument(1), vm)...)
+	}))
+	obj.Set("after", self(func(fc goja.FunctionCall) {
+		el.after = append(contentBytes(fc.Argument(0), fc.Argument(1), vm), el.after...)
+	}))
+	obj.Set("prepend", self(func(fc goja.FunctionCall) {
+		el.prepend = append(contentBytes(fc.Argument(0), fc.Argument(1), vm), el.prepend...)
+	}))
+	obj.Set("append", self(func(fc goja.FunctionCall) {
+		el.append = append(el.append, contentBytes(fc.Argument(0), fc.Argument(1), vm)...)
+	}))
+	obj.Set("setInnerContent", self(func(fc goja.FunctionCall) {
+		el.inner = contentBytes(fc.Argument(0), fc.Argument(1), vm)
+		el.innerSet = true
+		el.prepend = nil
+		el.append = nil
+	}))
+	obj.Set("replace", self(func(fc goja.FunctionCall) {
+		el.replace = contentBytes(fc.Argument(0), fc.Argument(1), vm)
+		el.replaced = true
+	}))
+	obj.Set("remove", self(func(goja.FunctionCall) {
+		el.removed = true
+	}))
+	obj.Set("removeAndKeepContent", self(func(goja.FunctionCall) {
+		el.unwrapped = true
+	}))
+
+	return obj
+}
+
+// contentChunk is a text or a comment
+type contentChunk struct {
+	text     string
+	before   []byte
+	after    []byte
+	replace  []byte
+	modified bool
+	replaced bool
+	removed  bool
+}
+
+func newContentChunk(text string) *contentChunk {
+	return &contentChunk{text: text}
+}
+
+func (c *contentChunk) write(w *bytes.Buffer, raw []byte) {
+	w.Write(c.before)
+	switch {
+	case c.removed:
+	case c.replaced:
+		w.Write(c.replace)
+	default:
+		w.Write(raw)
+	}
+	w.Write(c.after)
+}
+
+func chunkMethods(vm *goja.Runtime, obj *goja.Object, c *contentChunk) {
+	self := func(call func(fc goja.FunctionCall)) func(goja.FunctionCall) goja.Value {
+		return func(fc goja.FunctionCall) goja.Value {
+			call(fc)
+			return obj
+		}
+	}
+
+	obj.DefineAccessorProperty("removed", vm.ToValue(func(goja.FunctionCall) goja.Value {
+		return vm.ToValue(c.removed || c.replaced)
+	}), nil, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	obj.Set("before", self(func(fc goja.FunctionCall) {
+		c.before = append(c.before, contentBytes(fc.Argument(0), fc.Argument(1), vm)...)
+	}))
+	obj.Set("after", self(func(fc goja.FunctionCall) {
+		c.after = append(contentBytes(fc.Argument(0), fc.Argument(1), vm), c.after...)
+	}))
+	obj.Set("replace", self(func(fc goja.FunctionCall) {
+		c.replace = contentBytes(fc.Argument(0), fc.Argument(1), vm)
+		c.replaced = true
+	}))
+	obj.Set("remove", self(func(goja.FunctionCall) {
+		c.removed = true
+	}))
+}
+
+func newTextObject(vm *goja.Runtime, c *contentChunk) goja.Value {
+	obj := vm.NewObject()
+	obj.Set("text", c.text)
+	// text nodes are never split across chunks
+	obj.Set("lastInTextNode", true)
+	chunkMethods(vm, obj, c)
+	return obj
+}
+
+func newCommentObject(vm *goja.Runtime, c *contentChunk) goja.Value {
+	obj := vm.NewObject()
+	obj.DefineAccessorProperty("text", vm.ToValue(func(goja.FunctionCall) goja.Value {
+		return vm.ToValue(c.text)
+	}), vm.ToValue(func(fc goja.FunctionCall) goja.Value {
+		c.text = fc.Argument(0).String()
+		c.modified = true
+		return goja.Undefined()
+	}), goja.FLAG_FALSE, goja.FLAG_TRUE)
+	chunkMethods(vm, obj, c)
+	return obj
+}
+
+func newDoctypeObject(vm *goja.Runtime, data string) goja.Value {
+	obj := vm.NewObject()
+	obj.Set("name", data)
+	return obj
+}
+
+type documentEnd struct {
+	append []byte
+}
+
+func newDocumentEndObject(vm *goja.Runtime, end *documentEnd) goja.Value {
+	obj := vm.NewObject()
+	obj.Set("append", func(fc goja.FunctionCall) goja.Value {
+		end.append = append(end.append, contentBytes(fc.Argument(0), fc.Argument(1), vm)...)
+		return obj
+	})
+	return obj
+}
@@ -0,0 +1,153 @@
+package rewriter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"go.miragespace.co/heresy/extensions/blob"
+	"go.miragespace.co/heresy/extensions/stream"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja_nodejs/eventloop"
+	"golang.org/x/net/html"
+)
+
+// PolyfillHTMLRewriter installs HTMLRewriter in the runtime. The body of the
+// Response is read and tokenized in Go as it arrives. Bodies which are
+// ReadableStreams constructed in JavaScript stop being read when ctx is done.
+// It must be called after blob.PolyfillBlob.
+func PolyfillHTMLRewriter(ctx context.Context, eventLoop *eventloop.EventLoop, streams *stream.StreamController) error {
+	setup := make(chan error, 1)
+	eventLoop.RunOnLoop(func(vm *goja.Runtime) {
+		_, err := vm.RunProgram(rewriterWrapperProg)
+		if err != nil {
+			setup <- err
+			return
+		}
+
+		wrapper, ok := goja.AssertFunction(vm.Get(rewriterWrapperSymbol))
+		if !ok {
+			setup <- fmt.Errorf("internal error: %s is not a function", rewriterWrapperSymbol)
+			return
+		}
+
+		native := vm.NewObject()
+		native.Set("validate", func(fc goja.FunctionCall) goja.Value {
+			if _, err := parseSelector(fc.Argument(0).String()); err != nil {
+				panic(vm.NewTypeError(err.Error()))
+			}
+			return goja.Undefined()
+		})
+		native.Set("create", func(fc goja.FunctionCall) goja.Value {
+			rw, err := newHTMLRewriter(vm, eventLoop, fc.Argument(0), fc.Argument(1))
+			if err != nil {
+				panic(vm.NewTypeError(err.Error()))
+			}
+			src, err := sourceReader(ctx, streams, fc.Argument(2), vm)
+			if err != nil {
+				panic(vm.NewTypeError(err.Error()))
+			}
+			rw.src = src
+			rw.z = html.NewTokenizer(src)
+			return rw.nativeObject()
+		})
+
+		_, err = wrapper(goja.Undefined(), native)
+		setup <- err
+	})
+
+	return <-setup
+}
+
+// sourceReader returns a reader of the body of a Response, which is a string,
+// an ArrayBuffer or a ReadableStream. A Response without body is an empty document.
+func sourceReader(ctx context.Context, streams *stream.StreamController, body goja.Value, vm *goja.Runtime) (io.Reader, error) {
+	if goja.IsUndefined(body) || goja.IsNull(body) {
+		return bytes.NewReader(nil), nil
+	}
+	if body.ExportType().Kind() == reflect.String {
+		return strings.NewReader(body.String()), nil
+	}
+	if b, ok := blob.AssertBytes(body, vm); ok {
+		// ArrayBuffer is a copy owned by the Response
+		return bytes.NewReader(b), nil
+	}
+
+	// wrapped or JavaScript ReadableStream
+	reader, ok, err := streams.NewReaderContextVM(ctx, body, vm)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("body of the Response is not supported")
+	}
+	return reader, nil
+}
+
+func newHTMLRewriter(vm *goja.Runtime, eventLoop *eventloop.EventLoop, elements goja.Value, documents goja.Value) (*htmlRewriter, error) {
+	rw := &htmlRewriter{
+		vm:        vm,
+		eventLoop: eventLoop,
+	}
+
+	var elementHandlers []*goja.Object
+	if err := vm.ExportTo(elements, &elementHandlers); err != nil {
+		return nil, err
+	}
+	for _, e := range elementHandlers {
+		sel, err := parseSelector(e.Get("selector").String())
+		if err != nil {
+			return nil, err
+		}
+		handlers := e.Get("handlers").ToObject(vm)
+		rw.elements = append(rw.elements, elementRegistration{
+			selector: sel,
+			this:     handlers,
+			element:  handlerFunc(handlers, "element"),
+			comments: handlerFunc(handlers, "comments"),
+			text:     handlerFunc(handlers, "text"),
+		})
+	}
+
+	var documentHandlers []*goja.Object
+	if err := vm.ExportTo(documents, &documentHandlers); err != nil {
+		return nil, err
+	}
+	for _, handlers := range documentHandlers {
+		rw.documents = append(rw.documents, documentRegistration{
+			this:     handlers,
+			doctype:  handlerFunc(handlers, "doctype"),
+			comments: handlerFunc(handlers, "comments"),
+			text:     handlerFunc(handlers, "text"),
+			end:      handlerFunc(handlers, "end"),
+		})
+	}
+
+	return rw, nil
+}
+
+func handlerFunc(handlers *goja.Object, name string) goja.Callable {
+	fn, ok := goja.AssertFunction(handlers.Get(name))
+	if !ok {
+		return nil
+	}
+	return fn
+}
+
+// nativeObject exposes read(), which resolves with the next ArrayBuffer of
+// output or null at the end, and cancel()
+func (rw *htmlRewriter) nativeObject() goja.Value {
+	obj := rw.vm.NewObject()
+	obj.Set("read", func(goja.FunctionCall) goja.Value {
+		return rw.read()
+	})
+	obj.Set("cancel", func(goja.FunctionCall) goja.Value {
+		rw.cancel()
+		return goja.Undefined()
+	})
+	return obj
+}
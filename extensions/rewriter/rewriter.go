@@ -0,0 +1,473 @@
+package rewriter
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"go.miragespace.co/heresy/extensions/stream"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja_nodejs/eventloop"
+	"golang.org/x/net/html"
+)
+
+type elementRegistration struct {
+	selector selectorList
+	this     goja.Value
+	element  goja.Callable
+	comments goja.Callable
+	text     goja.Callable
+}
+
+type documentRegistration struct {
+	this     goja.Value
+	doctype  goja.Callable
+	comments goja.Callable
+	text     goja.Callable
+	end      goja.Callable
+}
+
+type token struct {
+	tt  html.TokenType
+	raw []byte
+	tok html.Token
+}
+
+// step is the handlers to call for a token, and the output after all of them returned
+type step struct {
+	calls  []func() (goja.Value, error)
+	finish func()
+}
+
+// fillTokens is the most tokens handed to the loop at once
+const fillTokens = 512
+
+// htmlRewriter reads the document from src with a single tokenizer, so a token
+// split across chunks is carried over by the tokenizer itself. Tokenizing runs
+// off the loop, and the handlers of the tokens run on the loop. Handlers
+// returning a Promise pause the rewriter until it settles.
+type htmlRewriter struct {
+	vm        *goja.Runtime
+	eventLoop *eventloop.EventLoop
+	elements  []elementRegistration
+	documents []documentRegistration
+	stack     []*openElement
+	src       io.Reader
+	z         *html.Tokenizer
+	tokens    []token
+	current   *step
+	out       bytes.Buffer
+	filling   bool
+	canceled  bool
+	eof       bool
+	ended     bool
+}
+
+// read resolves with the next output of the document, or null once the
+// document has ended. It must not be called again before the Promise settles.
+func (rw *htmlRewriter) read() goja.Value {
+	promise, resolve, reject := rw.vm.NewPromise()
+	rw.pump(resolve, reject)
+	return rw.vm.ToValue(promise)
+}
+
+// cancel stops reading the document. A JavaScript stream being read is
+// canceled once the pending read returns.
+func (rw *htmlRewriter) cancel() {
+	rw.canceled = true
+	if !rw.filling {
+		rw.close()
+	}
+}
+
+// close cancels src if it is a stream constructed in JavaScript. Native
+// streams are closed along with the request they belong to.
+func (rw *htmlRewriter) close() {
+	rw.tokens = nil
+	rw.current = nil
+	if c, ok := rw.src.(*stream.JSStreamReader); ok && !rw.eof {
+		c.Close()
+	}
+	rw.eof = true
+	rw.ended = true
+}
+
+// pump runs the handlers of the tokens read so far, and reads more of the
+// document until there is output to resolve with
+func (rw *htmlRewriter) pump(resolve, reject func(any)) {
+	if rw.canceled {
+		resolve(goja.Null())
+		return
+	}
+
+	wait, err := rw.run()
+	if err != nil {
+		rw.close()
+		if ex, ok := err.(*goja.Exception); ok {
+			reject(ex.Value())
+		} else {
+			reject(rw.vm.NewGoError(err))
+		}
+		return
+	}
+	if wait != nil {
+		rw.await(wait, resolve, reject)
+		return
+	}
+
+	switch {
+	case rw.out.Len() > 0:
+		resolve(rw.vm.NewArrayBuffer(rw.flush()))
+	case rw.ended:
+		resolve(goja.Null())
+	default:
+		rw.filling = true
+		go func() {
+			tokens, eof, err := rw.fill()
+			rw.eventLoop.RunOnLoop(func(vm *goja.Runtime) {
+				rw.filling = false
+				if rw.canceled {
+					rw.close()
+					resolve(goja.Null())
+					return
+				}
+				if err != nil {
+					rw.close()
+					reject(vm.NewGoError(err))
+					return
+				}
+				rw.tokens = append(rw.tokens, tokens...)
+				rw.eof = eof
+				rw.pump(resolve, reject)
+			})
+		}()
+	}
+}
+
+// await continues pumping once the Promise returned by a handler settles
+func (rw *htmlRewriter) await(wait goja.Value, resolve, reject func(any)) {
+	then, ok := goja.AssertFunction(wait.ToObject(rw.vm).Get("then"))
+	if !ok {
+		reject(rw.vm.NewTypeError("internal error: not a Promise"))
+		return
+	}
+	onFulfilled := func(goja.FunctionCall) goja.Value {
+		rw.pump(resolve, reject)
+		return goja.Undefined()
+	}
+	onRejected := func(fc goja.FunctionCall) goja.Value {
+		rw.close()
+		reject(fc.Argument(0))
+		return goja.Undefined()
+	}
+	if _, err := then(wait, rw.vm.ToValue(onFulfilled), rw.vm.ToValue(onRejected)); err != nil {
+		rw.close()
+		reject(err)
+	}
+}
+
+// flush returns the output so far
+func (rw *htmlRewriter) flush() []byte {
+	b := make([]byte, rw.out.Len())
+	copy(b, rw.out.Bytes())
+	rw.out.Reset()
+	return b
+}
+
+// fill tokenizes src off the loop. It stops before the tokenizer would block
+// reading src, so tokens already read are not held back by a slow source.
+func (rw *htmlRewriter) fill() (tokens []token, eof bool, err error) {
+	for len(tokens) < fillTokens {
+		tt := rw.z.Next()
+		if tt == html.ErrorToken {
+			if err := rw.z.Err(); !errors.Is(err, io.EOF) {
+				return nil, false, err
+			}
+			return tokens, true, nil
+		}
+		raw := rw.z.Raw()
+		t := token{
+			tt:  tt,
+			raw: make([]byte, len(raw)),
+		}
+		copy(t.raw, raw)
+		t.tok = rw.z.Token()
+		tokens = append(tokens, t)
+
+		if len(rw.z.Buffered()) == 0 {
+			break
+		}
+	}
+	return tokens, false, nil
+}
+
+func (rw *htmlRewriter) run() (goja.Value, error) {
+	for {
+		if rw.current == nil {
+			switch {
+			case len(rw.tokens) > 0:
+				t := rw.tokens[0]
+				rw.tokens = rw.tokens[1:]
+				rw.current = rw.begin(t)
+			case rw.eof && !rw.ended:
+				rw.ended = true
+				rw.current = rw.documentEnd()
+			default:
+				return nil, nil
+			}
+		}
+
+		for len(rw.current.calls) > 0 {
+			call := rw.current.calls[0]
+			rw.current.calls = rw.current.calls[1:]
+			ret, err := call()
+			if err != nil {
+				return nil, err
+			}
+			if p, ok := ret.Export().(*goja.Promise); ok && p.State() == goja.PromiseStateFulfilled {
+				continue
+			} else if ok {
+				return ret, nil
+			}
+		}
+
+		rw.current.finish()
+		rw.current = nil
+	}
+}
+
+func (rw *htmlRewriter) skipping() bool {
+	for _, el := range rw.stack {
+		if el.skipContent() {
+			return true
+		}
+	}
+	return false
+}
+
+func (rw *htmlRewriter) begin(t token) *step {
+	switch t.tt {
+	case html.StartTagToken, html.SelfClosingTagToken:
+		return rw.beginElement(t)
+	case html.EndTagToken:
+		return rw.endElement(t)
+	case html.TextToken:
+		return rw.beginText(t)
+	case html.CommentToken:
+		return rw.beginComment(t)
+	case html.DoctypeToken:
+		return rw.beginDoctype(t)
+	default:
+		return rw.passthrough(t)
+	}
+}
+
+func (rw *htmlRewriter) passthrough(t token) *step {
+	return &step{
+		finish: func() {
+			if !rw.skipping() {
+				rw.out.Write(t.raw)
+			}
+		},
+	}
+}
+
+func (rw *htmlRewriter) beginElement(t token) *step {
+	skipped := rw.skipping()
+	el := newOpenElement(t)
+	el.skipped = skipped
+	rw.stack = append(rw.stack, el)
+
+	s := &step{}
+	if !skipped {
+		var native goja.Value
+		for i, reg := range rw.elements {
+			if !reg.selector.match(rw.stack) {
+				continue
+			}
+			el.matched = append(el.matched, i)
+			if reg.element == nil {
+				continue
+			}
+			if native == nil {
+				native = newElementObject(rw.vm, el)
+			}
+			reg := reg
+			s.calls = append(s.calls, func() (goja.Value, error) {
+				return reg.element(reg.this, native)
+			})
+		}
+	}
+
+	s.finish = func() {
+		if !skipped {
+			el.writeStart(&rw.out)
+		}
+		if el.void {
+			rw.pop(nil)
+		}
+	}
+	return s
+}
+
+func (rw *htmlRewriter) endElement(t token) *step {
+	return &step{
+		finish: func() {
+			match := -1
+			for i := len(rw.stack) - 1; i >= 0; i-- {
+				if rw.stack[i].tag == t.tok.Data {
+					match = i
+					break
+				}
+			}
+			if match < 0 {
+				// stray end tag
+				if !rw.skipping() {
+					rw.out.Write(t.raw)
+				}
+				return
+			}
+			for len(rw.stack)-1 > match {
+				// implicitly closed, e.g. <p> by </div>
+				rw.pop(nil)
+			}
+			rw.pop(t.raw)
+		},
+	}
+}
+
+// pop closes the innermost element. endTag is nil if there is no end tag in the source.
+func (rw *htmlRewriter) pop(endTag []byte) {
+	el := rw.stack[len(rw.stack)-1]
+	rw.stack = rw.stack[:len(rw.stack)-1]
+	if el.skipped || rw.skipping() {
+		return
+	}
+	el.writeEnd(&rw.out, endTag)
+}
+
+// handlers of the selectors matching any of the open elements
+func (rw *htmlRewriter) matchedHandlers(pick func(*elementRegistration) goja.Callable) []int {
+	var matched []int
+	for _, el := range rw.stack {
+		for _, i := range el.matched {
+			if pick(&rw.elements[i]) != nil && !containsInt(matched, i) {
+				matched = append(matched, i)
+			}
+		}
+	}
+	return matched
+}
+
+func (rw *htmlRewriter) beginText(t token) *step {
+	if rw.skipping() {
+		return &step{finish: func() {}}
+	}
+
+	chunk := newContentChunk(string(t.raw))
+	native := newTextObject(rw.vm, chunk)
+	s := &step{
+		finish: func() {
+			chunk.write(&rw.out, t.raw)
+		},
+	}
+	for _, i := range rw.matchedHandlers(func(r *elementRegistration) goja.Callable { return r.text }) {
+		reg := rw.elements[i]
+		s.calls = append(s.calls, func() (goja.Value, error) {
+			return reg.text(reg.this, native)
+		})
+	}
+	for _, reg := range rw.documents {
+		if reg.text == nil {
+			continue
+		}
+		reg := reg
+		s.calls = append(s.calls, func() (goja.Value, error) {
+			return reg.text(reg.this, native)
+		})
+	}
+	return s
+}
+
+func (rw *htmlRewriter) beginComment(t token) *step {
+	if rw.skipping() {
+		return &step{finish: func() {}}
+	}
+
+	chunk := newContentChunk(t.tok.Data)
+	native := newCommentObject(rw.vm, chunk)
+	s := &step{
+		finish: func() {
+			if chunk.modified {
+				chunk.write(&rw.out, []byte("<!--"+chunk.text+"-->"))
+			} else {
+				chunk.write(&rw.out, t.raw)
+			}
+		},
+	}
+	for _, i := range rw.matchedHandlers(func(r *elementRegistration) goja.Callable { return r.comments }) {
+		reg := rw.elements[i]
+		s.calls = append(s.calls, func() (goja.Value, error) {
+			return reg.comments(reg.this, native)
+		})
+	}
+	for _, reg := range rw.documents {
+		if reg.comments == nil {
+			continue
+		}
+		reg := reg
+		s.calls = append(s.calls, func() (goja.Value, error) {
+			return reg.comments(reg.this, native)
+		})
+	}
+	return s
+}
+
+func (rw *htmlRewriter) beginDoctype(t token) *step {
+	s := rw.passthrough(t)
+	native := newDoctypeObject(rw.vm, t.tok.Data)
+	for _, reg := range rw.documents {
+		if reg.doctype == nil {
+			continue
+		}
+		reg := reg
+		s.calls = append(s.calls, func() (goja.Value, error) {
+			return reg.doctype(reg.this, native)
+		})
+	}
+	return s
+}
+
+func (rw *htmlRewriter) documentEnd() *step {
+	for len(rw.stack) > 0 {
+		rw.pop(nil)
+	}
+
+	end := &documentEnd{}
+	native := newDocumentEndObject(rw.vm, end)
+	s := &step{
+		finish: func() {
+			rw.out.Write(end.append)
+		},
+	}
+	for _, reg := range rw.documents {
+		if reg.end == nil {
+			continue
+		}
+		reg := reg
+		s.calls = append(s.calls, func() (goja.Value, error) {
+			return reg.end(reg.this, native)
+		})
+	}
+	return s
+}
+
+func containsInt(list []int, i int) bool {
+	for _, v := range list {
+		if v == i {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,327 @@
+package rewriter
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// supported subset of CSS selectors:
+// *, E, #id, .class, [attr], [attr=val], [attr~=val], [attr^=val], [attr$=val],
+// [attr*=val], [attr|=val], compounds of the above (e.g. a.external[href^="http"]),
+// descendant (E F) and child (E > F) combinators, and selector lists (E, F).
+
+type attrMatcher struct {
+	name  string
+	op    string
+	value string
+}
+
+type compoundSelector struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []attrMatcher
+}
+
+type complexSelector struct {
+	// compounds[i] and compounds[i+1] are joined by combinators[i]
+	compounds   []compoundSelector
+	combinators []byte
+}
+
+type selectorList []complexSelector
+
+func parseSelector(s string) (selectorList, error) {
+	p := &selectorParser{input: s}
+	list, err := p.parseList()
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector %q: %w", s, err)
+	}
+	return list, nil
+}
+
+type selectorParser struct {
+	input string
+	pos   int
+}
+
+func (p *selectorParser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *selectorParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *selectorParser) skipSpace() bool {
+	start := p.pos
+	for !p.eof() && isSpace(p.peek()) {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+func (p *selectorParser) parseList() (selectorList, error) {
+	var list selectorList
+	for {
+		p.skipSpace()
+		sel, err := p.parseComplex()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, sel)
+		p.skipSpace()
+		if p.eof() {
+			return list, nil
+		}
+		if p.peek() != ',' {
+			return nil, fmt.Errorf("unexpected %q", p.peek())
+		}
+		p.pos++
+	}
+}
+
+func (p *selectorParser) parseComplex() (complexSelector, error) {
+	var sel complexSelector
+	for {
+		c, err := p.parseCompound()
+		if err != nil {
+			return sel, err
+		}
+		sel.compounds = append(sel.compounds, c)
+
+		space := p.skipSpace()
+		switch {
+		case p.eof() || p.peek() == ',':
+			return sel, nil
+		case p.peek() == '>':
+			p.pos++
+			p.skipSpace()
+			sel.combinators = append(sel.combinators, '>')
+		case space:
+			sel.combinators = append(sel.combinators, ' ')
+		default:
+			return sel, fmt.Errorf("unsupported combinator %q", p.peek())
+		}
+	}
+}
+
+func (p *selectorParser) parseCompound() (compoundSelector, error) {
+	var c compoundSelector
+	start := p.pos
+
+	if p.peek() == '*' {
+		p.pos++
+	} else if isNameChar(p.peek()) {
+		c.tag = strings.ToLower(p.parseName())
+	}
+
+	for !p.eof() {
+		switch p.peek() {
+		case '#':
+			p.pos++
+			c.id = p.parseName()
+			if c.id == "" {
+				return c, fmt.Errorf("expecting an id")
+			}
+		case '.':
+			p.pos++
+			class := p.parseName()
+			if class == "" {
+				return c, fmt.Errorf("expecting a class name")
+			}
+			c.classes = append(c.classes, class)
+		case '[':
+			p.pos++
+			attr, err := p.parseAttr()
+			if err != nil {
+				return c, err
+			}
+			c.attrs = append(c.attrs, attr)
+		case ':':
+			return c, fmt.Errorf("pseudo-classes are not supported")
+		default:
+			if p.pos == start {
+				return c, fmt.Errorf("unexpected %q", p.peek())
+			}
+			return c, nil
+		}
+	}
+
+	if p.pos == start {
+		return c, fmt.Errorf("unexpected end of selector")
+	}
+	return c, nil
+}
+
+func (p *selectorParser) parseAttr() (attrMatcher, error) {
+	var a attrMatcher
+
+	p.skipSpace()
+	a.name = strings.ToLower(p.parseName())
+	if a.name == "" {
+		return a, fmt.Errorf("expecting an attribute name")
+	}
+	p.skipSpace()
+
+	if p.peek() == ']' {
+		p.pos++
+		return a, nil
+	}
+
+	switch p.peek() {
+	case '=':
+		a.op = "="
+		p.pos++
+	case '~', '^', '$', '*', '|':
+		a.op = string(p.peek()) + "="
+		p.pos++
+		if p.peek() != '=' {
+			return a, fmt.Errorf("expecting '='")
+		}
+		p.pos++
+	default:
+		return a, fmt.Errorf("unexpected %q in attribute selector", p.peek())
+	}
+
+	p.skipSpace()
+	if q := p.peek(); q == '"' || q == '\'' {
+		p.pos++
+		end := strings.IndexByte(p.input[p.pos:], q)
+		if end < 0 {
+			return a, fmt.Errorf("unterminated string")
+		}
+		a.value = p.input[p.pos : p.pos+end]
+		p.pos += end + 1
+	} else {
+		a.value = p.parseName()
+	}
+	p.skipSpace()
+
+	if p.peek() != ']' {
+		return a, fmt.Errorf("expecting ']'")
+	}
+	p.pos++
+	return a, nil
+}
+
+func (p *selectorParser) parseName() string {
+	start := p.pos
+	for !p.eof() && isNameChar(p.peek()) {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isNameChar(c byte) bool {
+	return c == '-' || c == '_' || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// match reports whether the innermost element of stack matches
+func (l selectorList) match(stack []*openElement) bool {
+	for _, sel := range l {
+		if sel.match(stack, len(sel.compounds)-1, len(stack)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s complexSelector) match(stack []*openElement, c, e int) bool {
+	if !s.compounds[c].match(stack[e]) {
+		return false
+	}
+	if c == 0 {
+		return true
+	}
+	switch s.combinators[c-1] {
+	case '>':
+		return e > 0 && s.match(stack, c-1, e-1)
+	default:
+		for i := e - 1; i >= 0; i-- {
+			if s.match(stack, c-1, i) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (c compoundSelector) match(el *openElement) bool {
+	if c.tag != "" && c.tag != el.tag {
+		return false
+	}
+	if c.id != "" {
+		if id, ok := getAttr(el.attrs, "id"); !ok || id != c.id {
+			return false
+		}
+	}
+	if len(c.classes) > 0 {
+		class, _ := getAttr(el.attrs, "class")
+		classes := strings.Fields(class)
+		for _, want := range c.classes {
+			if !containsString(classes, want) {
+				return false
+			}
+		}
+	}
+	for _, a := range c.attrs {
+		if !a.match(el.attrs) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a attrMatcher) match(attrs []html.Attribute) bool {
+	v, ok := getAttr(attrs, a.name)
+	if !ok {
+		return false
+	}
+	switch a.op {
+	case "":
+		return true
+	case "=":
+		return v == a.value
+	case "~=":
+		return containsString(strings.Fields(v), a.value)
+	case "^=":
+		return a.value != "" && strings.HasPrefix(v, a.value)
+	case "$=":
+		return a.value != "" && strings.HasSuffix(v, a.value)
+	case "*=":
+		return a.value != "" && strings.Contains(v, a.value)
+	case "|=":
+		return v == a.value || strings.HasPrefix(v, a.value+"-")
+	default:
+		return false
+	}
+}
+
+func getAttr(attrs []html.Attribute, name string) (string, bool) {
+	for _, a := range attrs {
+		if a.Namespace == "" && a.Key == name {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
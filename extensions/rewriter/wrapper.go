@@ -0,0 +1,16 @@
+package rewriter
+
+import (
+	_ "embed"
+
+	"github.com/dop251/goja"
+)
+
+const (
+	rewriterWrapperSymbol = "__runtimeHTMLRewriter"
+)
+
+//go:embed wrapper.js
+var rewriterWrapperScript string
+
+var rewriterWrapperProg = goja.MustCompile("rewriter", rewriterWrapperScript, false)
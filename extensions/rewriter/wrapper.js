@@ -0,0 +1,56 @@
+const __runtimeHTMLRewriter = (goWrapper) => {
+    class HTMLRewriter {
+        constructor() {
+            this._elements = [];
+            this._documents = [];
+        }
+        on(selector, handlers) {
+            goWrapper.validate(selector);
+            this._elements.push({ selector, handlers });
+            return this;
+        }
+        onDocument(handlers) {
+            this._documents.push(handlers);
+            return this;
+        }
+        transform(response) {
+            const source = response;
+            // the body is read in Go as-is
+            let useBody;
+            if (source._bodyReadableStream) {
+                useBody = source._bodyReadableStream;
+            }
+            else if (source._bodyArrayBuffer) {
+                useBody = source._bodyArrayBuffer;
+            }
+            else if (source._bodyText) {
+                useBody = source._bodyText;
+            }
+            const rewriter = goWrapper.create(this._elements, this._documents, useBody);
+            const body = new ReadableStream({
+                async pull(controller) {
+                    const output = await rewriter.read();
+                    if (output === null) {
+                        controller.close();
+                        return;
+                    }
+                    controller.enqueue(new Uint8Array(output));
+                },
+                cancel() {
+                    rewriter.cancel();
+                },
+            });
+            const headers = new Headers(response.headers);
+            // length of the document changes
+            headers.delete("content-length");
+            return new Response(body, {
+                status: response.status,
+                statusText: response.statusText,
+                headers,
+            });
+        }
+    }
+    if (typeof globalThis.HTMLRewriter === "undefined") {
+        globalThis.HTMLRewriter = HTMLRewriter;
+    }
+};
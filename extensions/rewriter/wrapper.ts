@@ -0,0 +1,77 @@
+interface RuntimeRewriter {
+  read(): Promise<ArrayBuffer | null>;
+  cancel(): void;
+}
+
+interface RuntimeRewriterHandler {
+  validate(selector: string): void;
+  create(
+    elements: { selector: string; handlers: object }[],
+    documents: object[],
+    body: ReadableStream | ArrayBuffer | string | undefined
+  ): RuntimeRewriter;
+}
+
+const __runtimeHTMLRewriter = (goWrapper: RuntimeRewriterHandler) => {
+  class HTMLRewriter {
+    private readonly _elements: { selector: string; handlers: object }[] = [];
+    private readonly _documents: object[] = [];
+
+    on(selector: string, handlers: object) {
+      goWrapper.validate(selector);
+      this._elements.push({ selector, handlers });
+      return this;
+    }
+
+    onDocument(handlers: object) {
+      this._documents.push(handlers);
+      return this;
+    }
+
+    transform(response: Response): Response {
+      const source = response as any;
+      // the body is read in Go as-is
+      let useBody: ReadableStream | ArrayBuffer | string | undefined;
+      if (source._bodyReadableStream) {
+        useBody = source._bodyReadableStream;
+      } else if (source._bodyArrayBuffer) {
+        useBody = source._bodyArrayBuffer;
+      } else if (source._bodyText) {
+        useBody = source._bodyText;
+      }
+      const rewriter = goWrapper.create(
+        this._elements,
+        this._documents,
+        useBody
+      );
+
+      const body = new ReadableStream({
+        async pull(controller) {
+          const output = await rewriter.read();
+          if (output === null) {
+            controller.close();
+            return;
+          }
+          controller.enqueue(new Uint8Array(output));
+        },
+        cancel() {
+          rewriter.cancel();
+        },
+      });
+
+      const headers = new Headers(response.headers);
+      // length of the document changes
+      headers.delete("content-length");
+
+      return new Response(body, {
+        status: response.status,
+        statusText: response.statusText,
+        headers,
+      });
+    }
+  }
+
+  if (typeof globalThis.HTMLRewriter === "undefined") {
+    (globalThis as any).HTMLRewriter = HTMLRewriter;
+  }
+};
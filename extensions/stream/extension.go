@@ -1,10 +1,12 @@
 package stream
 
 import (
+	"context"
 	"expvar"
 	"fmt"
 	"io"
 
+	"go.miragespace.co/heresy/extensions/blob"
 	"go.miragespace.co/heresy/extensions/common"
 	"go.miragespace.co/heresy/extensions/common/shared"
 	"go.miragespace.co/heresy/extensions/common/x"
@@ -23,7 +25,9 @@ var (
 
 type StreamController struct {
 	eventLoop      *eventloop.EventLoop
+	teeLimits      TeeLimits
 	runtimeWrapper goja.Callable
+	runtimePump    goja.Callable
 	streamPool     *x.Pool[*ReadableStream]
 	respPool       *x.Pool[*ResponseProxy]
 }
@@ -37,9 +41,12 @@ func (r *ReadableStream) NativeStream() goja.Value {
 	return r.nativeStream
 }
 
-func NewController(eventLoop *eventloop.EventLoop, symbols *polyfill.RuntimeSymbols) (*StreamController, error) {
+// NewController installs the native ReadableStream helpers. Bodies of Request and
+// Response are tee'd with teeLimits when cloned.
+func NewController(eventLoop *eventloop.EventLoop, symbols *polyfill.RuntimeSymbols, teeLimits TeeLimits) (*StreamController, error) {
 	s := &StreamController{
 		eventLoop: eventLoop,
+		teeLimits: teeLimits.withDefaults(),
 	}
 
 	setup := make(chan error, 1)
@@ -58,6 +65,27 @@ func NewController(eventLoop *eventloop.EventLoop, symbols *polyfill.RuntimeSymb
 		}
 		s.runtimeWrapper = wrapper
 
+		runtimePump := vm.Get(streamPumpSymbol)
+		pump, ok := goja.AssertFunction(runtimePump)
+		if !ok {
+			setup <- fmt.Errorf("internal error: %s is not a function", streamPumpSymbol)
+			return
+		}
+		s.runtimePump = pump
+
+		runtimeTee := vm.Get(streamTeeSymbol)
+		tee, ok := goja.AssertFunction(runtimeTee)
+		if !ok {
+			setup <- fmt.Errorf("internal error: %s is not a function", streamTeeSymbol)
+			return
+		}
+		native := vm.NewObject()
+		native.Set("tee", s.teeVM)
+		if _, err := tee(goja.Undefined(), native); err != nil {
+			setup <- err
+			return
+		}
+
 		s.streamPool = x.NewPool[*ReadableStream](x.DefaultPoolCapacity).
 			WithFactory(func() *ReadableStream {
 				wrapperNew.Add(1)
@@ -96,6 +124,7 @@ func (s *StreamController) GetResponseProxy(t *common.IOContext) *ResponseProxy
 func (s *StreamController) NewReadableStreamVM(t *common.IOContext, r io.ReadCloser, vm *goja.Runtime) *ReadableStream {
 	stream := s.streamPool.Get()
 	stream.nativeWrapper.WithReader(r)
+	stream.nativeWrapper.ioContext = t
 
 	// unfortunately, ReadableStream itself cannot be reused. we have to create one every time.
 	fn, err := s.runtimeWrapper(goja.Undefined(), stream.nativeWrapper.NativeObject())
@@ -117,14 +146,61 @@ func (s *StreamController) NewReadableStreamVM(t *common.IOContext, r io.ReadClo
 	return stream
 }
 
-func AssertReader(native goja.Value, vm *goja.Runtime) (io.Reader, bool) {
+// NewReaderVM returns an io.Reader for a ReadableStream. Streams created by
+// NewReadableStreamVM are unwrapped to the underlying reader, and any other
+// ReadableStream constructed in JavaScript is read chunk by chunk on the loop.
+// ok is false if native is not a ReadableStream.
+func (s *StreamController) NewReaderVM(t *common.IOContext, native goja.Value, vm *goja.Runtime) (r io.Reader, ok bool, err error) {
+	return s.NewReaderContextVM(t.Context(), native, vm)
+}
+
+// NewReaderContextVM is NewReaderVM for readers not bound to a request. A
+// ReadableStream constructed in JavaScript stops being read when ctx is done.
+func (s *StreamController) NewReaderContextVM(ctx context.Context, native goja.Value, vm *goja.Runtime) (r io.Reader, ok bool, err error) {
+	if r, ok = AssertReader(native, vm); ok {
+		return
+	}
+	if src, isSource := blob.AssertSource(native, vm); isSource {
+		// a Blob not kept in memory, such as a large file of a form
+		return src.NewReader(), true, nil
+	}
+
+	obj, isObj := native.(*goja.Object)
+	if !isObj {
+		return nil, false, nil
+	}
+	if _, isFunc := goja.AssertFunction(obj.Get("getReader")); !isFunc {
+		return nil, false, nil
+	}
+
+	r, err = s.newJSStreamReaderVM(ctx, obj, vm)
+	return r, err == nil, err
+}
+
+// teeVM splits the reader of a native stream. The stream keeps reading from
+// the first branch, and a new stream of the second branch is returned.
+func (s *StreamController) teeVM(fc goja.FunctionCall, vm *goja.Runtime) goja.Value {
+	w, ok := assertWrapper(fc.Argument(0), vm)
+	if !ok || w.ioContext == nil {
+		return goja.Null()
+	}
+	first, second := newTee(w.reader, s.teeLimits)
+	w.reader = first
+	return s.NewReadableStreamVM(w.ioContext, second, vm).NativeStream()
+}
+
+func assertWrapper(native goja.Value, vm *goja.Runtime) (*NativeReaderWrapper, bool) {
 	obj := native.ToObject(vm)
 	wrapper := obj.Get("wrapper")
 	if wrapper == nil {
 		return nil, false
 	}
 	w, ok := wrapper.Export().(*NativeReaderWrapper)
-	if ok {
+	return w, ok
+}
+
+func AssertReader(native goja.Value, vm *goja.Runtime) (io.Reader, bool) {
+	if w, ok := assertWrapper(native, vm); ok {
 		return w.Reader(), true
 	}
 	return nil, false
@@ -0,0 +1,180 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja_nodejs/eventloop"
+)
+
+var errReaderClosed = errors.New("ReadableStream reader was closed")
+
+type jsChunk struct {
+	data []byte
+	err  error
+}
+
+// JSStreamReader reads a ReadableStream constructed in JavaScript as an io.Reader.
+// Chunks are pulled from the stream one at a time on demand, so the stream only
+// produces as fast as the consumer reads.
+type JSStreamReader struct {
+	ctx          context.Context
+	eventLoop    *eventloop.EventLoop
+	nativeRead   goja.Callable
+	nativeCancel goja.Callable
+	nativeCb     goja.Value
+	result       chan jsChunk
+	pending      []byte
+	buf          []byte
+	err          error
+	closed       bool
+}
+
+var _ io.ReadCloser = (*JSStreamReader)(nil)
+var _ io.WriterTo = (*JSStreamReader)(nil)
+
+func (s *StreamController) newJSStreamReaderVM(ctx context.Context, native *goja.Object, vm *goja.Runtime) (*JSStreamReader, error) {
+	pump, err := s.runtimePump(goja.Undefined(), native)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := pump.ToObject(vm)
+	read, ok := goja.AssertFunction(obj.Get("read"))
+	if !ok {
+		return nil, fmt.Errorf("internal error: read is not a function")
+	}
+	cancel, ok := goja.AssertFunction(obj.Get("cancel"))
+	if !ok {
+		return nil, fmt.Errorf("internal error: cancel is not a function")
+	}
+
+	r := &JSStreamReader{
+		ctx:          ctx,
+		eventLoop:    s.eventLoop,
+		nativeRead:   read,
+		nativeCancel: cancel,
+		result:       make(chan jsChunk, 1),
+	}
+	r.nativeCb = vm.ToValue(r.callback)
+
+	return r, nil
+}
+
+// callback receives the next chunk from the stream on the loop
+func (r *JSStreamReader) callback(fc goja.FunctionCall, vm *goja.Runtime) goja.Value {
+	var (
+		buffer = fc.Argument(0)
+		offset = fc.Argument(1).ToInteger()
+		length = fc.Argument(2).ToInteger()
+		e      = fc.Argument(3)
+	)
+
+	if !goja.IsUndefined(e) {
+		r.result <- jsChunk{err: fmt.Errorf("ReadableStream errored: %s", e.String())}
+		return goja.Undefined()
+	}
+	if goja.IsNull(buffer) {
+		r.result <- jsChunk{err: io.EOF}
+		return goja.Undefined()
+	}
+
+	ab, ok := buffer.Export().(goja.ArrayBuffer)
+	if !ok {
+		r.result <- jsChunk{err: fmt.Errorf("ReadableStream chunk is not an ArrayBuffer")}
+		return goja.Undefined()
+	}
+
+	// the underlying buffer may be reused by the stream after we return
+	r.buf = append(r.buf[:0], ab.Bytes()[offset:offset+length]...)
+	r.result <- jsChunk{data: r.buf}
+	return goja.Undefined()
+}
+
+func (r *JSStreamReader) next() {
+	if r.err != nil {
+		return
+	}
+
+	r.eventLoop.RunOnLoop(func(vm *goja.Runtime) {
+		if _, err := r.nativeRead(goja.Undefined(), r.nativeCb); err != nil {
+			r.result <- jsChunk{err: err}
+		}
+	})
+
+	select {
+	case <-r.ctx.Done():
+		r.err = r.ctx.Err()
+		r.eventLoop.RunOnLoop(func(vm *goja.Runtime) {
+			r.nativeCancel(goja.Undefined(), vm.NewGoError(r.err))
+		})
+	case c := <-r.result:
+		r.pending = c.data
+		r.err = c.err
+	}
+}
+
+func (r *JSStreamReader) Read(p []byte) (n int, err error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.next()
+	}
+
+	n = copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// WriteTo writes each chunk to w as it arrives, and flushes after every chunk
+// if w is an http.Flusher. This is used by io.Copy.
+func (r *JSStreamReader) WriteTo(w io.Writer) (written int64, err error) {
+	flusher, _ := w.(http.Flusher)
+	for {
+		for len(r.pending) == 0 {
+			if r.err != nil {
+				if r.err == io.EOF {
+					return written, nil
+				}
+				return written, r.err
+			}
+			r.next()
+		}
+
+		var n int
+		n, err = w.Write(r.pending)
+		written += int64(n)
+		r.pending = r.pending[n:]
+		if err != nil {
+			r.err = err
+			r.eventLoop.RunOnLoop(func(vm *goja.Runtime) {
+				r.nativeCancel(goja.Undefined(), vm.NewGoError(err))
+			})
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// Close cancels the stream, so its source stops producing, and releases the
+// lock of its reader. It must not be called while reading.
+func (r *JSStreamReader) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if r.err == nil {
+		r.err = errReaderClosed
+	}
+	r.eventLoop.RunOnLoop(func(vm *goja.Runtime) {
+		r.nativeCancel(goja.Undefined())
+	})
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"io"
 
+	"go.miragespace.co/heresy/extensions/common"
 	"go.miragespace.co/heresy/extensions/common/shared"
 
 	"github.com/dop251/goja"
@@ -12,6 +13,7 @@ import (
 
 type NativeReaderWrapper struct {
 	reader    io.ReadCloser
+	ioContext *common.IOContext
 	eventLoop *eventloop.EventLoop
 	nativeObj *goja.Object
 	vm        *goja.Runtime
@@ -36,9 +38,14 @@ func NewNativeReaderWrapper(vm *goja.Runtime, eventLoop *eventloop.EventLoop) *N
 }
 
 func (s *NativeReaderWrapper) Reset(buf []byte) {
-	io.CopyBuffer(io.Discard, s.reader, buf)
+	// the source of a tee is closed by the tee itself, without reading the
+	// rest of it into the buffer of the other branch
+	if _, ok := s.reader.(*teeReader); !ok {
+		io.CopyBuffer(io.Discard, s.reader, buf)
+	}
 	s.reader.Close()
 	s.reader = nil
+	s.ioContext = nil
 }
 
 func (s *NativeReaderWrapper) Reader() io.ReadCloser {
@@ -19,6 +19,7 @@ type ResponseProxy struct {
 	nativeResponseInstance *goja.Object
 	nativeObj              *goja.Object
 	nativeBody             goja.Value
+	nativeWebSocket        goja.Value
 }
 
 var _ goja.DynamicObject = (*ResponseProxy)(nil)
@@ -28,6 +29,7 @@ func newResponseProxy(vm *goja.Runtime, controller *StreamController, symbols *p
 		vm:                     vm,
 		stream:                 controller,
 		nativeBody:             goja.Null(),
+		nativeWebSocket:        goja.Undefined(),
 		nativeResponseInstance: symbols.Response(),
 	}
 	r.nativeObj = vm.NewDynamicObject(r)
@@ -47,11 +49,17 @@ func (r *ResponseProxy) WithResponse(t *common.IOContext, vm *goja.Runtime, resp
 	t.RegisterCleanup(r.reset)
 }
 
+// WithWebSocket sets the webSocket of an upgraded response
+func (r *ResponseProxy) WithWebSocket(socket goja.Value) {
+	r.nativeWebSocket = socket
+}
+
 func (r *ResponseProxy) reset() {
 	r.ioContext = nil
 	r.resp = nil
 	r.headersProxy = nil
 	r.nativeBody = goja.Null()
+	r.nativeWebSocket = goja.Undefined()
 }
 
 func (r *ResponseProxy) Get(key string) goja.Value {
@@ -70,6 +78,8 @@ func (r *ResponseProxy) Get(key string) goja.Value {
 		return r.headersProxy.NativeObject()
 	case "body":
 		return r.nativeBody
+	case "webSocket":
+		return r.nativeWebSocket
 
 	default:
 		return r.nativeResponseInstance.Get(key)
@@ -89,5 +99,5 @@ func (r *ResponseProxy) Delete(key string) bool {
 }
 
 func (r *ResponseProxy) Keys() []string {
-	return []string{"body", "header", "statusCode", "statusText"}
+	return []string{"body", "headers", "statusCode", "statusText"}
 }
@@ -0,0 +1,238 @@
+package stream
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+var ErrTeeLimit = errors.New("tee: body exceeds the buffer limit")
+
+// TeeLimits of buffering a body read by both branches of a tee. Zero values
+// use the respective default.
+type TeeLimits struct {
+	// MaxMemory is the size kept in memory before spilling to a temp file
+	MaxMemory int64
+	// MaxSize is the lag of the slower branch behind the faster one, that is
+	// the size buffered for it
+	MaxSize int64
+	// TempDir is the directory of temp files, os.TempDir() if empty
+	TempDir string
+}
+
+var DefaultTeeLimits = TeeLimits{
+	MaxMemory: 1 << 20,
+	MaxSize:   32 << 20,
+}
+
+func (l TeeLimits) withDefaults() TeeLimits {
+	if l.MaxMemory <= 0 {
+		l.MaxMemory = DefaultTeeLimits.MaxMemory
+	}
+	if l.MaxSize <= 0 {
+		l.MaxSize = DefaultTeeLimits.MaxSize
+	}
+	return l
+}
+
+// tee splits a reader into two branches. Data read by the faster branch is
+// buffered for the slower branch, in memory first then in a temp file.
+// The source is closed when both branches are closed.
+type tee struct {
+	mu       sync.Mutex
+	readMu   sync.Mutex // serializes reads from src
+	src      io.ReadCloser
+	limits   TeeLimits
+	branches [2]*teeReader
+	mem      []byte   // buffered data from base, before spilling
+	file     *os.File // buffered data from fileBase, after spilling
+	fileBase int64
+	base     int64 // offset of the first byte still needed by a branch
+	size     int64 // bytes read from src
+	err      error
+}
+
+type teeReader struct {
+	t      *tee
+	off    int64
+	closed bool
+}
+
+var _ io.ReadCloser = (*teeReader)(nil)
+
+func newTee(src io.ReadCloser, limits TeeLimits) (io.ReadCloser, io.ReadCloser) {
+	t := &tee{
+		src:    src,
+		limits: limits.withDefaults(),
+	}
+	t.branches[0] = &teeReader{t: t}
+	t.branches[1] = &teeReader{t: t}
+	return t.branches[0], t.branches[1]
+}
+
+func (b *teeReader) Read(p []byte) (int, error) {
+	t := b.t
+
+	t.mu.Lock()
+	if n, err, ok := t.readBuffered(b, p); ok {
+		t.mu.Unlock()
+		return n, err
+	}
+	t.mu.Unlock()
+
+	t.readMu.Lock()
+	defer t.readMu.Unlock()
+
+	t.mu.Lock()
+	// the other branch may have read from src in the meantime
+	if n, err, ok := t.readBuffered(b, p); ok {
+		t.mu.Unlock()
+		return n, err
+	}
+	t.mu.Unlock()
+
+	n, err := t.src.Read(p)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if n > 0 {
+		if serr := t.store(b, p[:n]); serr != nil {
+			t.err = serr
+			return 0, serr
+		}
+		t.size += int64(n)
+		b.off += int64(n)
+		t.trim()
+	}
+	if err != nil {
+		t.err = err
+	}
+	return n, err
+}
+
+// readBuffered reads data already read from src by the other branch. ok is
+// false if b has to read from src.
+func (t *tee) readBuffered(b *teeReader, p []byte) (n int, err error, ok bool) {
+	if b.closed {
+		return 0, os.ErrClosed, true
+	}
+	if b.off >= t.size {
+		if t.err != nil {
+			return 0, t.err, true
+		}
+		return 0, nil, false
+	}
+
+	if t.file != nil {
+		if remaining := t.size - b.off; int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+		n, err = t.file.ReadAt(p, b.off-t.fileBase)
+		if err == io.EOF {
+			err = nil
+		}
+	} else {
+		n = copy(p, t.mem[b.off-t.base:])
+	}
+	b.off += int64(n)
+	t.trim()
+	return n, err, true
+}
+
+// store buffers data read by b, if the other branch still needs it
+func (t *tee) store(b *teeReader, data []byte) error {
+	other := t.branches[0]
+	if other == b {
+		other = t.branches[1]
+	}
+	if other.closed {
+		return nil
+	}
+	// b reads from src, so other is the slower branch
+	if t.size+int64(len(data))-other.off > t.limits.MaxSize {
+		return ErrTeeLimit
+	}
+
+	if t.file == nil {
+		if int64(len(t.mem)+len(data)) <= t.limits.MaxMemory {
+			t.mem = append(t.mem, data...)
+			return nil
+		}
+		if err := t.spill(); err != nil {
+			return err
+		}
+	}
+
+	_, err := t.file.WriteAt(data, t.size-t.fileBase)
+	return err
+}
+
+func (t *tee) spill() error {
+	f, err := os.CreateTemp(t.limits.TempDir, "heresy-tee-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(t.mem); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	t.file = f
+	t.fileBase = t.base
+	t.mem = nil
+	return nil
+}
+
+// trim drops buffered data read by both branches. The temp file is reused
+// from its start once both branches have caught up.
+func (t *tee) trim() {
+	low := t.size
+	for _, b := range t.branches {
+		if !b.closed && b.off < low {
+			low = b.off
+		}
+	}
+	if t.file != nil {
+		if low == t.size && t.fileBase < low {
+			t.file.Truncate(0)
+			t.fileBase = low
+			t.base = low
+		}
+		return
+	}
+	if drop := low - t.base; drop > 0 {
+		// data read while the other branch is closed was not buffered
+		if drop < int64(len(t.mem)) {
+			t.mem = t.mem[drop:]
+		} else {
+			t.mem = nil
+		}
+		t.base = low
+	}
+}
+
+func (b *teeReader) Close() error {
+	t := b.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	t.trim()
+
+	for _, other := range t.branches {
+		if !other.closed {
+			return nil
+		}
+	}
+	if t.file != nil {
+		t.file.Close()
+		os.Remove(t.file.Name())
+		t.file = nil
+	}
+	t.mem = nil
+	return t.src.Close()
+}
@@ -0,0 +1,110 @@
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func teeSource(n int) ([]byte, io.ReadCloser) {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data, io.NopCloser(bytes.NewReader(data))
+}
+
+func TestTeeBothBranchesReadAll(t *testing.T) {
+	data, src := teeSource(64 << 10)
+	first, second := newTee(src, TeeLimits{MaxMemory: 1 << 10, MaxSize: 1 << 20, TempDir: t.TempDir()})
+	defer first.Close()
+	defer second.Close()
+
+	got1, err := io.ReadAll(first)
+	if err != nil {
+		t.Fatalf("first branch: %v", err)
+	}
+	got2, err := io.ReadAll(second)
+	if err != nil {
+		t.Fatalf("second branch: %v", err)
+	}
+	if !bytes.Equal(got1, data) || !bytes.Equal(got2, data) {
+		t.Fatalf("branches differ from the source")
+	}
+}
+
+func TestTeeLimitIsTheLagOfTheSlowerBranch(t *testing.T) {
+	data, src := teeSource(256 << 10)
+	first, second := newTee(src, TeeLimits{MaxMemory: 1 << 10, MaxSize: 16 << 10, TempDir: t.TempDir()})
+	defer first.Close()
+	defer second.Close()
+
+	// both branches read far beyond MaxSize, but never lag by more than 8KiB
+	var got1, got2 bytes.Buffer
+	chunk := make([]byte, 8<<10)
+	for {
+		n, err := first.Read(chunk)
+		got1.Write(chunk[:n])
+		if _, err := io.CopyN(&got2, second, int64(n)); err != nil {
+			t.Fatalf("second branch: %v", err)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("first branch: %v", err)
+		}
+	}
+	if !bytes.Equal(got1.Bytes(), data) || !bytes.Equal(got2.Bytes(), data) {
+		t.Fatalf("branches differ from the source")
+	}
+}
+
+func TestTeeLimitExceeded(t *testing.T) {
+	_, src := teeSource(64 << 10)
+	first, second := newTee(src, TeeLimits{MaxMemory: 1 << 10, MaxSize: 16 << 10, TempDir: t.TempDir()})
+	defer first.Close()
+	defer second.Close()
+
+	if _, err := io.ReadAll(first); !errors.Is(err, ErrTeeLimit) {
+		t.Fatalf("expected ErrTeeLimit, got %v", err)
+	}
+}
+
+func TestTeeClosedBranchIsNotBuffered(t *testing.T) {
+	data, src := teeSource(64 << 10)
+	first, second := newTee(src, TeeLimits{MaxMemory: 1 << 10, MaxSize: 4 << 10, TempDir: t.TempDir()})
+	second.Close()
+	defer first.Close()
+
+	got, err := io.ReadAll(first)
+	if err != nil {
+		t.Fatalf("first branch: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("branch differs from the source")
+	}
+	if _, err := second.Read(make([]byte, 1)); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("expected os.ErrClosed, got %v", err)
+	}
+}
+
+func TestTeeRemovesTempFile(t *testing.T) {
+	dir := t.TempDir()
+	_, src := teeSource(64 << 10)
+	first, second := newTee(src, TeeLimits{MaxMemory: 1 << 10, MaxSize: 1 << 20, TempDir: dir})
+
+	if _, err := io.ReadAll(first); err != nil {
+		t.Fatalf("first branch: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("expected a temp file, got %d entries", len(entries))
+	}
+	first.Close()
+	second.Close()
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("expected the temp file to be removed, got %d entries", len(entries))
+	}
+}
@@ -8,6 +8,8 @@ import (
 
 const (
 	streamWrapperSymbol = "__runtimeIOReaderWrapper"
+	streamPumpSymbol    = "__runtimeStreamPump"
+	streamTeeSymbol     = "__runtimeStreamTee"
 )
 
 //go:embed wrapper.js
@@ -21,3 +21,175 @@ const __runtimeIOReaderWrapper = (goWrapper) => {
     stream.wrapper = goWrapper;
     return stream;
 };
+
+// this is a helper for pumping ReadableStream constructed in JavaScript into io.Reader
+const __runtimeStreamPump = (stream) => {
+    const reader = stream.getReader();
+    const encoder = new TextEncoder();
+    return {
+        read(callback) {
+            reader
+                .read()
+                .then(({ done, value }) => {
+                if (done) {
+                    callback(null, 0, 0);
+                    return;
+                }
+                let chunk;
+                if (typeof value === "string") {
+                    chunk = encoder.encode(value);
+                }
+                else if (typeof value === "number") {
+                    chunk = Uint8Array.of(value);
+                }
+                else if (value instanceof ArrayBuffer) {
+                    chunk = new Uint8Array(value);
+                }
+                else if (ArrayBuffer.isView(value)) {
+                    chunk = new Uint8Array(value.buffer, value.byteOffset, value.byteLength);
+                }
+                else {
+                    throw new TypeError("ReadableStream chunk must be a string, an ArrayBuffer or an ArrayBufferView");
+                }
+                callback(chunk.buffer, chunk.byteOffset, chunk.byteLength);
+            })
+                .catch((e) => {
+                callback(null, 0, 0, e);
+                reader.cancel(e).catch(() => { });
+            });
+        },
+        cancel(reason) {
+            const release = () => reader.releaseLock();
+            reader.cancel(reason).then(release, release);
+        },
+    };
+};
+// Request and Response polyfill share the body stream with the clone, and
+// Request.clone() consumes the original. A native stream is tee'd in Go
+const __runtimeStreamTee = (goWrapper) => {
+    const cloneBody = (source) => {
+        var _a;
+        if (source.bodyUsed) {
+            throw new TypeError("Already read");
+        }
+        const stream = source._bodyReadableStream;
+        if (stream) {
+            if (stream.locked) {
+                throw new TypeError("ReadableStream is locked");
+            }
+            const branch = goWrapper.tee(stream);
+            if (branch) {
+                return branch;
+            }
+            const [first, second] = stream.tee();
+            source._bodyReadableStream = source.bodyInit = first;
+            return second;
+        }
+        if (source._bodyArrayBuffer) {
+            return source._bodyArrayBuffer;
+        }
+        return (_a = source._bodyText) !== null && _a !== void 0 ? _a : null;
+    };
+    Request.prototype.clone = function () {
+        return new Request(this.url, {
+            method: this.method,
+            headers: new Headers(this.headers),
+            body: cloneBody(this),
+        });
+    };
+    Response.prototype.clone = function () {
+        return new Response(cloneBody(this), {
+            status: this.status,
+            statusText: this.statusText,
+            headers: new Headers(this.headers),
+            flush: this._flush,
+        });
+    };
+};
+// { flush: true } writes each chunk of the body to the client as soon as it
+// is read, instead of when the buffer fills
+globalThis.Response = __runtimeWrapBodyConstructor(Response, (args) => args, (response, [, init]) => {
+    response._flush = (init === null || init === void 0 ? void 0 : init.flush) === true;
+});
+// ServerSentEvents encodes events into a text/event-stream body
+class RuntimeServerSentEvents {
+    constructor() {
+        this._closed = false;
+        this._encoder = new TextEncoder();
+        this.readable = new ReadableStream({
+            start: (controller) => {
+                this._controller = controller;
+            },
+            cancel: () => {
+                // the client went away
+                this._closed = true;
+            },
+        });
+    }
+    get closed() {
+        return this._closed;
+    }
+    // data that is not a string is sent as JSON
+    send(data, options) {
+        let message = "";
+        if ((options === null || options === void 0 ? void 0 : options.event) !== undefined) {
+            message += `event: ${this._field("event", options.event)}\n`;
+        }
+        if ((options === null || options === void 0 ? void 0 : options.id) !== undefined) {
+            message += `id: ${this._field("id", options.id)}\n`;
+        }
+        if ((options === null || options === void 0 ? void 0 : options.retry) !== undefined) {
+            message += `retry: ${Math.max(0, Math.floor(options.retry))}\n`;
+        }
+        const text = typeof data === "string" ? data : JSON.stringify(data);
+        for (const line of text.split(/\r\n|\r|\n/)) {
+            message += `data: ${line}\n`;
+        }
+        this._enqueue(message + "\n");
+    }
+    // comments are ignored by clients, e.g. to keep the connection alive
+    comment(text = "") {
+        let message = "";
+        for (const line of String(text).split(/\r\n|\r|\n/)) {
+            message += `: ${line}\n`;
+        }
+        this._enqueue(message + "\n");
+    }
+    close() {
+        if (this._closed) {
+            return;
+        }
+        this._closed = true;
+        this._controller.close();
+    }
+    response(init) {
+        const headers = new Headers(init === null || init === void 0 ? void 0 : init.headers);
+        if (!headers.has("content-type")) {
+            headers.set("content-type", "text/event-stream; charset=utf-8");
+        }
+        if (!headers.has("cache-control")) {
+            headers.set("cache-control", "no-cache");
+        }
+        return new Response(this.readable, Object.assign(Object.assign({}, init), { headers }));
+    }
+    _field(name, value) {
+        value = String(value);
+        if (/[\r\n]/.test(value)) {
+            throw new TypeError(`ServerSentEvents: ${name} cannot contain a newline`);
+        }
+        return value;
+    }
+    _enqueue(message) {
+        if (this._closed) {
+            throw new TypeError("ServerSentEvents is closed");
+        }
+        this._controller.enqueue(this._encoder.encode(message));
+    }
+}
+if (typeof ServerSentEvents === "undefined") {
+    Object.defineProperty(globalThis, "ServerSentEvents", {
+        value: RuntimeServerSentEvents,
+        writable: true,
+        configurable: true,
+    });
+}
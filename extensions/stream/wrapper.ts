@@ -37,3 +37,222 @@ const __runtimeIOReaderWrapper = (
   (stream as any).wrapper = goWrapper;
   return stream;
 };
+
+interface RuntimeStreamPump {
+  read(
+    callback: (
+      buffer: ArrayBuffer | null,
+      offset: number,
+      length: number,
+      error?: unknown
+    ) => void
+  ): void;
+  cancel(reason?: unknown): void;
+}
+
+// this is a helper for pumping ReadableStream constructed in JavaScript into io.Reader
+const __runtimeStreamPump = (stream: ReadableStream): RuntimeStreamPump => {
+  const reader = stream.getReader();
+  const encoder = new TextEncoder();
+  return {
+    read(callback) {
+      reader
+        .read()
+        .then(({ done, value }) => {
+          if (done) {
+            callback(null, 0, 0);
+            return;
+          }
+          let chunk: Uint8Array;
+          if (typeof value === "string") {
+            chunk = encoder.encode(value);
+          } else if (typeof value === "number") {
+            chunk = Uint8Array.of(value);
+          } else if (value instanceof ArrayBuffer) {
+            chunk = new Uint8Array(value);
+          } else if (ArrayBuffer.isView(value)) {
+            chunk = new Uint8Array(
+              value.buffer,
+              value.byteOffset,
+              value.byteLength
+            );
+          } else {
+            throw new TypeError(
+              "ReadableStream chunk must be a string, an ArrayBuffer or an ArrayBufferView"
+            );
+          }
+          callback(chunk.buffer, chunk.byteOffset, chunk.byteLength);
+        })
+        .catch((e) => {
+          callback(null, 0, 0, e);
+          reader.cancel(e).catch(() => {});
+        });
+    },
+    cancel(reason) {
+      const release = () => reader.releaseLock();
+      reader.cancel(reason).then(release, release);
+    },
+  };
+};
+
+interface RuntimeTeeHandler {
+  // returns the second branch of a native stream, which keeps reading from the
+  // first branch. returns null if the stream is constructed in JavaScript.
+  tee(stream: ReadableStream): ReadableStream | null;
+}
+
+// Request and Response polyfill share the body stream with the clone, and
+// Request.clone() consumes the original. A native stream is tee'd in Go
+const __runtimeStreamTee = (goWrapper: RuntimeTeeHandler) => {
+  const cloneBody = (source: any): any => {
+    if (source.bodyUsed) {
+      throw new TypeError("Already read");
+    }
+    const stream: ReadableStream | undefined = source._bodyReadableStream;
+    if (stream) {
+      if (stream.locked) {
+        throw new TypeError("ReadableStream is locked");
+      }
+      const branch = goWrapper.tee(stream);
+      if (branch) {
+        return branch;
+      }
+      const [first, second] = stream.tee();
+      source._bodyReadableStream = source.bodyInit = first;
+      return second;
+    }
+    if (source._bodyArrayBuffer) {
+      return source._bodyArrayBuffer;
+    }
+    return source._bodyText ?? null;
+  };
+
+  Request.prototype.clone = function (this: Request) {
+    return new Request(this.url, {
+      method: this.method,
+      headers: new Headers(this.headers),
+      body: cloneBody(this),
+    });
+  };
+
+  Response.prototype.clone = function (this: Response) {
+    return new Response(cloneBody(this), {
+      status: this.status,
+      statusText: this.statusText,
+      headers: new Headers(this.headers),
+      flush: (this as any)._flush,
+    } as ResponseInit);
+  };
+};
+
+// { flush: true } writes each chunk of the body to the client as soon as it
+// is read, instead of when the buffer fills
+globalThis.Response = __runtimeWrapBodyConstructor(
+  Response,
+  (args) => args,
+  (response, [, init]) => {
+    response._flush = init?.flush === true;
+  }
+);
+
+interface RuntimeServerSentEvent {
+  event?: string;
+  id?: string;
+  retry?: number;
+}
+
+// ServerSentEvents encodes events into a text/event-stream body
+class RuntimeServerSentEvents {
+  readonly readable: ReadableStream<Uint8Array>;
+  private _controller!: ReadableStreamDefaultController<Uint8Array>;
+  private _closed = false;
+  private readonly _encoder = new TextEncoder();
+
+  constructor() {
+    this.readable = new ReadableStream<Uint8Array>({
+      start: (controller) => {
+        this._controller = controller;
+      },
+      cancel: () => {
+        // the client went away
+        this._closed = true;
+      },
+    });
+  }
+
+  get closed() {
+    return this._closed;
+  }
+
+  // data that is not a string is sent as JSON
+  send(data: any, options?: RuntimeServerSentEvent) {
+    let message = "";
+    if (options?.event !== undefined) {
+      message += `event: ${this._field("event", options.event)}\n`;
+    }
+    if (options?.id !== undefined) {
+      message += `id: ${this._field("id", options.id)}\n`;
+    }
+    if (options?.retry !== undefined) {
+      message += `retry: ${Math.max(0, Math.floor(options.retry))}\n`;
+    }
+    const text = typeof data === "string" ? data : JSON.stringify(data);
+    for (const line of text.split(/\r\n|\r|\n/)) {
+      message += `data: ${line}\n`;
+    }
+    this._enqueue(message + "\n");
+  }
+
+  // comments are ignored by clients, e.g. to keep the connection alive
+  comment(text = "") {
+    let message = "";
+    for (const line of String(text).split(/\r\n|\r|\n/)) {
+      message += `: ${line}\n`;
+    }
+    this._enqueue(message + "\n");
+  }
+
+  close() {
+    if (this._closed) {
+      return;
+    }
+    this._closed = true;
+    this._controller.close();
+  }
+
+  response(init?: ResponseInit) {
+    const headers = new Headers(init?.headers);
+    if (!headers.has("content-type")) {
+      headers.set("content-type", "text/event-stream; charset=utf-8");
+    }
+    if (!headers.has("cache-control")) {
+      headers.set("cache-control", "no-cache");
+    }
+    return new Response(this.readable, { ...init, headers });
+  }
+
+  private _field(name: string, value: string) {
+    value = String(value);
+    if (/[\r\n]/.test(value)) {
+      throw new TypeError(`ServerSentEvents: ${name} cannot contain a newline`);
+    }
+    return value;
+  }
+
+  private _enqueue(message: string) {
+    if (this._closed) {
+      throw new TypeError("ServerSentEvents is closed");
+    }
+    this._controller.enqueue(this._encoder.encode(message));
+  }
+}
+
+declare var ServerSentEvents: typeof RuntimeServerSentEvents | undefined;
+
+if (typeof ServerSentEvents === "undefined") {
+  Object.defineProperty(globalThis, "ServerSentEvents", {
+    value: RuntimeServerSentEvents,
+    writable: true,
+    configurable: true,
+  });
+}
@@ -0,0 +1,252 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+const (
+	CloseNormal        = 1000
+	CloseGoingAway     = 1001
+	CloseProtocolError = 1002
+	CloseNoStatus      = 1005
+	CloseAbnormal      = 1006
+	CloseInvalidData   = 1007
+	CloseTooLarge      = 1009
+)
+
+// MaxMessageSize is the limit of a message received, including all fragments
+const MaxMessageSize = 16 << 20
+
+// CloseError is returned by ReadMessage when the peer sent a close frame
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: closed with %d %s", e.Code, e.Reason)
+}
+
+// ProtocolError is returned by ReadMessage when the peer violated the
+// protocol. A close frame with Code was already sent to the peer.
+type ProtocolError struct {
+	Code   int
+	Reason string
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("websocket: %s", e.Reason)
+}
+
+// Conn reads and writes WebSocket frames (RFC 6455) over an upgraded
+// connection. Frames written by a client are masked.
+type Conn struct {
+	rwc    io.ReadWriteCloser
+	br     *bufio.Reader
+	client bool
+	wmu    sync.Mutex
+}
+
+func newConn(rwc io.ReadWriteCloser, br *bufio.Reader, client bool) *Conn {
+	return &Conn{
+		rwc:    rwc,
+		br:     br,
+		client: client,
+	}
+}
+
+func (c *Conn) Close() error {
+	return c.rwc.Close()
+}
+
+func (c *Conn) protocolError(code int, format string, args ...any) error {
+	c.WriteClose(code, "")
+	return &ProtocolError{Code: code, Reason: fmt.Sprintf(format, args...)}
+}
+
+// ReadMessage returns the next text or binary message. Ping frames are
+// answered, and fragmented messages are reassembled. A close frame from the
+// peer is returned as *CloseError.
+func (c *Conn) ReadMessage() (op byte, data []byte, err error) {
+	for {
+		fin, frameOp, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch frameOp {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			closeErr := &CloseError{Code: CloseNoStatus}
+			if len(payload) >= 2 {
+				closeErr.Code = int(binary.BigEndian.Uint16(payload))
+				closeErr.Reason = string(payload[2:])
+			}
+			return 0, nil, closeErr
+		case opText, opBinary:
+			if op != 0 {
+				return 0, nil, c.protocolError(CloseProtocolError, "expecting a continuation frame")
+			}
+			op = frameOp
+		case opContinuation:
+			if op == 0 {
+				return 0, nil, c.protocolError(CloseProtocolError, "unexpected continuation frame")
+			}
+		default:
+			return 0, nil, c.protocolError(CloseProtocolError, "unknown opcode %d", frameOp)
+		}
+
+		if len(data)+len(payload) > MaxMessageSize {
+			return 0, nil, c.protocolError(CloseTooLarge, "message exceeds %d bytes", MaxMessageSize)
+		}
+		data = append(data, payload...)
+
+		if fin {
+			if op == opText && !utf8.Valid(data) {
+				return 0, nil, c.protocolError(CloseInvalidData, "invalid UTF-8 in text message")
+			}
+			return op, data, nil
+		}
+	}
+}
+
+func (c *Conn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(c.br, header[:]); err != nil {
+		return
+	}
+	fin = header[0]&0x80 != 0
+	op = header[0] & 0x0f
+	if header[0]&0x70 != 0 {
+		err = c.protocolError(CloseProtocolError, "reserved bits are set")
+		return
+	}
+	masked := header[1]&0x80 != 0
+	if masked == c.client {
+		// clients must mask frames, servers must not
+		err = c.protocolError(CloseProtocolError, "unexpected masking")
+		return
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if op >= opClose && (length > 125 || !fin) {
+		err = c.protocolError(CloseProtocolError, "invalid control frame")
+		return
+	}
+	if length > MaxMessageSize {
+		err = c.protocolError(CloseTooLarge, "frame exceeds %d bytes", MaxMessageSize)
+		return
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return
+}
+
+// WriteMessage writes data as a single text or binary frame
+func (c *Conn) WriteMessage(op byte, data []byte) error {
+	return c.writeFrame(op, data)
+}
+
+// WriteClose writes a close frame. The connection is not closed.
+func (c *Conn) WriteClose(code int, reason string) error {
+	var payload []byte
+	if code != CloseNoStatus {
+		payload = make([]byte, 2, 2+len(reason))
+		binary.BigEndian.PutUint16(payload, uint16(code))
+		payload = append(payload, reason...)
+		if len(payload) > 125 {
+			payload = payload[:125]
+		}
+	}
+	return c.writeFrame(opClose, payload)
+}
+
+func (c *Conn) writeFrame(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|op)
+
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+
+	if c.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := range frame[start:] {
+			frame[start+i] ^= mask[i%4]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	_, err := c.rwc.Write(frame)
+	return err
+}
@@ -0,0 +1,97 @@
+package websocket
+
+import (
+	"fmt"
+
+	"go.miragespace.co/heresy/extensions/common"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja_nodejs/eventloop"
+	"go.uber.org/zap"
+)
+
+// Controller implements WebSocket and WebSocketPair in the runtime. Sockets
+// are read and written off the loop, and events are dispatched on the loop.
+type Controller struct {
+	eventLoop *eventloop.EventLoop
+	logger    *zap.Logger
+	newSocket goja.Callable
+}
+
+// NewController installs WebSocket and WebSocketPair in the runtime, and
+// the webSocket option of the Response constructor.
+// It must be called after blob.PolyfillBlob.
+func NewController(eventLoop *eventloop.EventLoop, logger *zap.Logger) (*Controller, error) {
+	c := &Controller{
+		eventLoop: eventLoop,
+		logger:    logger,
+	}
+
+	setup := make(chan error, 1)
+	eventLoop.RunOnLoop(func(vm *goja.Runtime) {
+		_, err := vm.RunProgram(websocketWrapperProg)
+		if err != nil {
+			setup <- err
+			return
+		}
+
+		wrapper, ok := goja.AssertFunction(vm.Get(websocketWrapperSymbol))
+		if !ok {
+			setup <- fmt.Errorf("internal error: %s is not a function", websocketWrapperSymbol)
+			return
+		}
+
+		native := vm.NewObject()
+		native.Set("pair", func(goja.FunctionCall) goja.Value {
+			client, server := c.newSocketVM(vm), c.newSocketVM(vm)
+			client.peer, server.peer = server, client
+			return vm.NewArray(client.native, server.native)
+		})
+
+		newSocket, err := wrapper(goja.Undefined(), native)
+		if err != nil {
+			setup <- err
+			return
+		}
+		c.newSocket, ok = goja.AssertFunction(newSocket)
+		if !ok {
+			setup <- fmt.Errorf("internal error: %s did not return a function", websocketWrapperSymbol)
+			return
+		}
+
+		setup <- nil
+	})
+
+	if err := <-setup; err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// NewSocketVM returns a WebSocket of a connection opened with fetch. The
+// connection is closed when the IOContext is done, unless it was closed before.
+func (c *Controller) NewSocketVM(t *common.IOContext, vm *goja.Runtime, conn *Conn) goja.Value {
+	s := c.newSocketVM(vm)
+	s.attach(conn)
+	t.RegisterCleanup(s.close)
+	return s.native
+}
+
+// AssertSocket returns the Socket of a WebSocket, e.g. the webSocket of a
+// Response passed to respondWith
+func AssertSocket(native goja.Value, vm *goja.Runtime) (*Socket, bool) {
+	if native == nil || goja.IsUndefined(native) || goja.IsNull(native) {
+		return nil, false
+	}
+	handler := native.ToObject(vm).Get("_native")
+	if handler == nil || goja.IsUndefined(handler) || goja.IsNull(handler) {
+		return nil, false
+	}
+	socket := handler.ToObject(vm).Get("socket")
+	if socket == nil {
+		return nil, false
+	}
+	s, ok := socket.Export().(*Socket)
+	return s, ok
+}
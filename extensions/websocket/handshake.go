@@ -0,0 +1,156 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var (
+	ErrNotUpgrade    = errors.New("websocket: request is not a WebSocket upgrade")
+	ErrHijackFailed  = errors.New("websocket: connection does not support hijacking")
+	ErrInvalidAccept = errors.New("websocket: invalid Sec-WebSocket-Accept from upstream")
+	ErrNotWritable   = errors.New("websocket: upgraded connection is not writable")
+)
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key))
+	h.Write([]byte(acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsUpgrade reports whether r asks for a WebSocket upgrade
+func IsUpgrade(r *http.Request) bool {
+	return headerContains(r.Header, "Upgrade", "websocket")
+}
+
+// skipped from the headers of the Response, they are set by the handshake
+var handshakeHeaders = map[string]bool{
+	"Upgrade":              true,
+	"Connection":           true,
+	"Sec-Websocket-Accept": true,
+	"Content-Length":       true,
+	"Transfer-Encoding":    true,
+}
+
+// upgrade completes the server handshake of r, and hijacks the connection.
+// Errors before hijacking are written to w.
+func upgrade(w http.ResponseWriter, r *http.Request, header http.Header) (*Conn, error) {
+	if r.Method != http.MethodGet ||
+		!IsUpgrade(r) ||
+		!headerContains(r.Header, "Connection", "upgrade") {
+		w.Header().Set("Upgrade", "websocket")
+		http.Error(w, ErrNotUpgrade.Error(), http.StatusUpgradeRequired)
+		return nil, ErrNotUpgrade
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "websocket: unsupported version", http.StatusBadRequest)
+		return nil, ErrNotUpgrade
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "websocket: missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, ErrNotUpgrade
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, ErrHijackFailed.Error(), http.StatusInternalServerError)
+		return nil, ErrHijackFailed
+	}
+	netConn, brw, err := hijacker.Hijack()
+	if err != nil {
+		http.Error(w, ErrHijackFailed.Error(), http.StatusInternalServerError)
+		return nil, fmt.Errorf("%w: %s", ErrHijackFailed, err)
+	}
+
+	brw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	brw.WriteString("Upgrade: websocket\r\n")
+	brw.WriteString("Connection: Upgrade\r\n")
+	brw.WriteString("Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n")
+	for name, values := range header {
+		if handshakeHeaders[http.CanonicalHeaderKey(name)] {
+			continue
+		}
+		for _, v := range values {
+			brw.WriteString(name + ": " + v + "\r\n")
+		}
+	}
+	brw.WriteString("\r\n")
+	if err := brw.Flush(); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	return newConn(netConn, brw.Reader, false), nil
+}
+
+// Dial performs the client handshake of req with client. ws and wss URLs are
+// dialed as http and https. If the upstream does not switch protocols, the
+// response is returned with a nil Conn.
+func Dial(client *http.Client, req *http.Request) (*http.Response, *Conn, error) {
+	switch req.URL.Scheme {
+	case "ws":
+		req.URL.Scheme = "http"
+	case "wss":
+		req.URL.Scheme = "https"
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+
+	// Client.Timeout also applies to the upgraded connection, and wraps the
+	// body so it is no longer an io.ReadWriteCloser
+	c := *client
+	c.Timeout = 0
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return resp, nil, nil
+	}
+
+	if resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		resp.Body.Close()
+		return nil, nil, ErrInvalidAccept
+	}
+	rwc, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return nil, nil, ErrNotWritable
+	}
+	resp.Body = http.NoBody
+
+	return resp, newConn(rwc, bufio.NewReader(rwc), true), nil
+}
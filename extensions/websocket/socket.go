@@ -0,0 +1,340 @@
+package websocket
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.miragespace.co/heresy/extensions/blob"
+
+	"github.com/dop251/goja"
+	"go.uber.org/zap"
+)
+
+// closeTimeout is how long to wait for the peer to reply to a close frame
+const closeTimeout = 5 * time.Second
+
+var (
+	ErrNotAccepted  = errors.New("websocket: WebSocket was not accepted")
+	ErrAlreadyInUse = errors.New("websocket: WebSocket is already connected")
+)
+
+type message struct {
+	op     byte
+	data   []byte
+	code   int
+	reason string
+}
+
+// Socket is one end of a WebSocketPair, or a WebSocket opened with fetch.
+// Messages are dispatched to the JavaScript WebSocket on the event loop
+// once the socket is both accepted and connected.
+type Socket struct {
+	c        *Controller
+	peer     *Socket // the other end of a WebSocketPair, nil for upstream sockets
+	native   *goja.Object
+	dispatch goja.Callable
+
+	mu        sync.Mutex
+	conn      *Conn
+	accepted  bool
+	started   bool // the connection is read by the read loop or a proxy
+	closing   bool // a close frame is queued
+	queue     []message
+	wake      chan struct{}
+	closeSent chan struct{}
+	done      chan struct{}
+	shutdown  sync.Once
+}
+
+func (c *Controller) newSocketVM(vm *goja.Runtime) *Socket {
+	s := &Socket{
+		c:         c,
+		wake:      make(chan struct{}, 1),
+		closeSent: make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	native := vm.NewObject()
+	native.Set("socket", s)
+	native.Set("accept", func(goja.FunctionCall) goja.Value {
+		s.accept()
+		return goja.Undefined()
+	})
+	native.Set("send", func(fc goja.FunctionCall) goja.Value {
+		data := fc.Argument(0)
+		if b, ok := blob.AssertBytes(data, vm); ok {
+			// the buffer may be modified after send returns
+			s.enqueue(message{op: opBinary, data: append([]byte(nil), b...)})
+		} else {
+			s.enqueue(message{op: opText, data: []byte(data.String())})
+		}
+		return goja.Undefined()
+	})
+	native.Set("close", func(fc goja.FunctionCall) goja.Value {
+		s.enqueueClose(int(fc.Argument(0).ToInteger()), fc.Argument(1).String())
+		return goja.Undefined()
+	})
+
+	socket, err := c.newSocket(goja.Undefined(), native)
+	if err != nil {
+		panic(err)
+	}
+	s.native = socket.ToObject(vm)
+	s.dispatch, _ = goja.AssertFunction(s.native.Get("_dispatch"))
+
+	return s
+}
+
+func (s *Socket) accept() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accepted = true
+	s.maybeStart()
+}
+
+func (s *Socket) enqueue(m message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return
+	}
+	s.queue = append(s.queue, m)
+	s.signal()
+}
+
+func (s *Socket) enqueueClose(code int, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return
+	}
+	s.closing = true
+	s.queue = append(s.queue, message{op: opClose, code: code, reason: reason})
+	s.signal()
+}
+
+func (s *Socket) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// attach connects the socket to an upgraded connection. Messages sent
+// before are written in order.
+func (s *Socket) attach(conn *Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conn = conn
+	go s.writeLoop()
+	s.signal()
+	s.maybeStart()
+}
+
+func (s *Socket) maybeStart() {
+	if s.conn == nil || !s.accepted || s.started {
+		return
+	}
+	s.started = true
+	go s.readLoop()
+}
+
+func (s *Socket) writeLoop() {
+	for {
+		select {
+		case <-s.wake:
+		case <-s.done:
+			return
+		}
+
+		s.mu.Lock()
+		queue := s.queue
+		s.queue = nil
+		s.mu.Unlock()
+
+		for _, m := range queue {
+			if m.op == opClose {
+				s.conn.WriteClose(m.code, m.reason)
+				close(s.closeSent)
+				// the peer may never reply to the close frame
+				time.AfterFunc(closeTimeout, s.close)
+				return
+			}
+			if err := s.conn.WriteMessage(m.op, m.data); err != nil {
+				// the read loop reports the broken connection
+				s.close()
+				return
+			}
+		}
+	}
+}
+
+func (s *Socket) readLoop() {
+	for {
+		op, data, err := s.conn.ReadMessage()
+		if err != nil {
+			s.finish(err)
+			return
+		}
+		s.c.eventLoop.RunOnLoop(func(vm *goja.Runtime) {
+			event := vm.NewObject()
+			if op == opText {
+				event.Set("data", string(data))
+			} else {
+				event.Set("data", vm.NewArrayBuffer(data))
+			}
+			s.dispatchVM(vm, "message", event)
+		})
+	}
+}
+
+func (s *Socket) finish(err error) {
+	var (
+		code     = CloseAbnormal
+		reason   string
+		wasClean bool
+		closeErr *CloseError
+		protoErr *ProtocolError
+	)
+	switch {
+	case errors.As(err, &closeErr):
+		code, reason, wasClean = closeErr.Code, closeErr.Reason, true
+		// reply with the same code, unless our close frame was sent first
+		s.enqueueClose(code, "")
+		select {
+		case <-s.closeSent:
+		case <-s.done:
+		case <-time.After(closeTimeout):
+		}
+	case errors.As(err, &protoErr):
+		code, reason = protoErr.Code, protoErr.Reason
+	}
+	s.close()
+
+	s.c.eventLoop.RunOnLoop(func(vm *goja.Runtime) {
+		if !wasClean {
+			event := vm.NewObject()
+			event.Set("message", err.Error())
+			event.Set("error", vm.NewGoError(err))
+			s.dispatchVM(vm, "error", event)
+		}
+		event := vm.NewObject()
+		event.Set("code", code)
+		event.Set("reason", reason)
+		event.Set("wasClean", wasClean)
+		s.dispatchVM(vm, "close", event)
+	})
+}
+
+// close closes the connection, and stops the write loop
+func (s *Socket) close() {
+	s.shutdown.Do(func() {
+		s.mu.Lock()
+		conn := s.conn
+		s.mu.Unlock()
+		if conn != nil {
+			conn.Close()
+		}
+		close(s.done)
+	})
+}
+
+func (s *Socket) dispatchVM(vm *goja.Runtime, eventType string, event *goja.Object) {
+	if s.dispatch == nil {
+		return
+	}
+	if _, err := s.dispatch(s.native, vm.ToValue(eventType), event); err != nil {
+		s.c.logger.Error("Uncaught exception in WebSocket event listener",
+			zap.String("type", eventType), zap.Error(err))
+	}
+}
+
+// Serve upgrades r to a WebSocket connection. If s is the client end of a
+// WebSocketPair, the connection is attached to the server end, which must
+// have been accepted. If s was opened with fetch and not accepted, messages
+// are proxied as-is between the client and the upstream. Serve returns when
+// the connection is closed. Errors before the upgrade are written to w.
+func (s *Socket) Serve(w http.ResponseWriter, r *http.Request, header http.Header) error {
+	if s.peer == nil {
+		return s.proxy(w, r, header)
+	}
+
+	server := s.peer
+	server.mu.Lock()
+	accepted, inUse := server.accepted, server.conn != nil
+	server.mu.Unlock()
+	if !accepted {
+		http.Error(w, ErrNotAccepted.Error(), http.StatusInternalServerError)
+		return ErrNotAccepted
+	}
+	if inUse {
+		http.Error(w, ErrAlreadyInUse.Error(), http.StatusInternalServerError)
+		return ErrAlreadyInUse
+	}
+
+	conn, err := upgrade(w, r, header)
+	if err != nil {
+		return err
+	}
+	server.attach(conn)
+	<-server.done
+
+	return nil
+}
+
+func (s *Socket) proxy(w http.ResponseWriter, r *http.Request, header http.Header) error {
+	s.mu.Lock()
+	upstream, inUse := s.conn, s.accepted || s.started
+	s.started = true
+	s.mu.Unlock()
+	if upstream == nil || inUse {
+		http.Error(w, ErrAlreadyInUse.Error(), http.StatusInternalServerError)
+		return ErrAlreadyInUse
+	}
+
+	conn, err := upgrade(w, r, header)
+	if err != nil {
+		return err
+	}
+	splice(conn, upstream)
+	s.close()
+
+	return nil
+}
+
+// splice relays messages between a and b until either is closed. Close
+// frames are relayed as well, so the closing handshake is end to end.
+func splice(a, b *Conn) {
+	done := make(chan struct{}, 2)
+	relay := func(dst, src *Conn) {
+		defer func() { done <- struct{}{} }()
+		for {
+			op, data, err := src.ReadMessage()
+			if err != nil {
+				var closeErr *CloseError
+				if errors.As(err, &closeErr) {
+					dst.WriteClose(closeErr.Code, closeErr.Reason)
+				} else {
+					dst.WriteClose(CloseGoingAway, "")
+				}
+				return
+			}
+			if err := dst.WriteMessage(op, data); err != nil {
+				return
+			}
+		}
+	}
+	go relay(a, b)
+	go relay(b, a)
+
+	<-done
+	// wait for the other side to reply to the close frame
+	select {
+	case <-done:
+	case <-time.After(closeTimeout):
+	}
+	a.Close()
+	b.Close()
+}
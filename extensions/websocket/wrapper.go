@@ -0,0 +1,16 @@
+package websocket
+
+import (
+	_ "embed"
+
+	"github.com/dop251/goja"
+)
+
+const (
+	websocketWrapperSymbol = "__runtimeWebSocket"
+)
+
+//go:embed wrapper.js
+var websocketWrapperScript string
+
+var websocketWrapperProg = goja.MustCompile("websocket", websocketWrapperScript, false)
@@ -0,0 +1,151 @@
+const __runtimeWebSocket = (goWrapper) => {
+    // sockets are only created by WebSocketPair and fetch
+    let constructing = false;
+    class RuntimeWebSocket {
+        constructor(native) {
+            this.readyState = RuntimeWebSocket.CONNECTING;
+            this.onopen = null;
+            this.onmessage = null;
+            this.onclose = null;
+            this.onerror = null;
+            this._accepted = false;
+            this._listeners = {};
+            if (!constructing) {
+                throw new TypeError("Illegal constructor: use WebSocketPair, or fetch() with Upgrade: websocket");
+            }
+            this._native = native;
+        }
+        accept() {
+            if (this._accepted) {
+                throw new TypeError("WebSocket was already accepted");
+            }
+            this._accepted = true;
+            this._native.accept();
+            if (this.readyState === RuntimeWebSocket.CONNECTING) {
+                this.readyState = RuntimeWebSocket.OPEN;
+                this._dispatch("open", {});
+            }
+        }
+        send(data) {
+            if (this.readyState !== RuntimeWebSocket.OPEN) {
+                throw new TypeError("WebSocket is not open, accept() it first");
+            }
+            if (typeof data !== "string" &&
+                !(data instanceof ArrayBuffer) &&
+                !ArrayBuffer.isView(data)) {
+                throw new TypeError("WebSocket.send: expecting a string, an ArrayBuffer or an ArrayBufferView");
+            }
+            this._native.send(data);
+        }
+        close(code, reason) {
+            if (code !== undefined &&
+                code !== 1000 &&
+                (!Number.isInteger(code) || code < 3000 || code > 4999)) {
+                throw new RangeError("WebSocket.close: code must be 1000, or between 3000 and 4999");
+            }
+            if (this.readyState >= RuntimeWebSocket.CLOSING) {
+                return;
+            }
+            this.readyState = RuntimeWebSocket.CLOSING;
+            this._native.close(code !== null && code !== void 0 ? code : 1000, String(reason !== null && reason !== void 0 ? reason : ""));
+        }
+        addEventListener(type, listener) {
+            var _a, _b;
+            const listeners = ((_a = (_b = this._listeners)[type]) !== null && _a !== void 0 ? _a : (_b[type] = []));
+            if (!listeners.includes(listener)) {
+                listeners.push(listener);
+            }
+        }
+        removeEventListener(type, listener) {
+            var _a;
+            const listeners = this._listeners[type];
+            const index = (_a = listeners === null || listeners === void 0 ? void 0 : listeners.indexOf(listener)) !== null && _a !== void 0 ? _a : -1;
+            if (index >= 0) {
+                listeners.splice(index, 1);
+            }
+        }
+        // called from Go on the event loop
+        _dispatch(type, init) {
+            var _a;
+            if (type === "close") {
+                this.readyState = RuntimeWebSocket.CLOSED;
+            }
+            const event = Object.assign(Object.assign({}, init), { type, target: this });
+            const handler = this["on" + type];
+            const listeners = [...((_a = this._listeners[type]) !== null && _a !== void 0 ? _a : [])];
+            if (typeof handler === "function") {
+                listeners.unshift(handler);
+            }
+            let error;
+            for (const listener of listeners) {
+                try {
+                    listener.call(this, event);
+                }
+                catch (e) {
+                    error !== null && error !== void 0 ? error : (error = e);
+                }
+            }
+            if (error !== undefined) {
+                throw error;
+            }
+        }
+        get [Symbol.toStringTag]() {
+            return "WebSocket";
+        }
+    }
+    RuntimeWebSocket.CONNECTING = 0;
+    RuntimeWebSocket.OPEN = 1;
+    RuntimeWebSocket.CLOSING = 2;
+    RuntimeWebSocket.CLOSED = 3;
+    const newSocket = (native) => {
+        constructing = true;
+        try {
+            return new RuntimeWebSocket(native);
+        }
+        finally {
+            constructing = false;
+        }
+    };
+    class RuntimeWebSocketPair {
+        constructor() {
+            const [client, server] = goWrapper.pair();
+            this[0] = client;
+            this[1] = server;
+        }
+    }
+    Object.defineProperty(globalThis, "WebSocket", {
+        value: RuntimeWebSocket,
+        writable: true,
+        configurable: true,
+    });
+    Object.defineProperty(globalThis, "WebSocketPair", {
+        value: RuntimeWebSocketPair,
+        writable: true,
+        configurable: true,
+    });
+    // a Response with status 101 hands its webSocket to the client
+    globalThis.Response = __runtimeWrapBodyConstructor(Response, (args) => {
+        var _a;
+        const webSocket = (_a = args[1]) === null || _a === void 0 ? void 0 : _a.webSocket;
+        if (webSocket != null && !(webSocket instanceof RuntimeWebSocket)) {
+            throw new TypeError("Response: webSocket must be a WebSocket");
+        }
+        return args;
+    }, (response, [, init]) => {
+        if ((init === null || init === void 0 ? void 0 : init.webSocket) == null) {
+            return;
+        }
+        if (response.status !== 101) {
+            throw new RangeError("Response: webSocket requires status 101");
+        }
+        response._webSocket = init.webSocket;
+    });
+    Object.defineProperty(Response.prototype, "webSocket", {
+        get() {
+            var _a;
+            return (_a = this._webSocket) !== null && _a !== void 0 ? _a : null;
+        },
+        configurable: true,
+    });
+    return newSocket;
+};
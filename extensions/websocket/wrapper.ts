@@ -0,0 +1,191 @@
+interface RuntimeSocketHandler {
+  accept(): void;
+  send(data: string | ArrayBuffer | ArrayBufferView): void;
+  close(code: number, reason: string): void;
+}
+
+interface RuntimeWebSocketHandler {
+  pair(): [any, any];
+}
+
+type RuntimeSocketListener = (this: any, event: any) => any;
+
+const __runtimeWebSocket = (goWrapper: RuntimeWebSocketHandler) => {
+  // sockets are only created by WebSocketPair and fetch
+  let constructing = false;
+
+  class RuntimeWebSocket {
+    static readonly CONNECTING = 0;
+    static readonly OPEN = 1;
+    static readonly CLOSING = 2;
+    static readonly CLOSED = 3;
+
+    readyState = RuntimeWebSocket.CONNECTING;
+    onopen: RuntimeSocketListener | null = null;
+    onmessage: RuntimeSocketListener | null = null;
+    onclose: RuntimeSocketListener | null = null;
+    onerror: RuntimeSocketListener | null = null;
+
+    private _accepted = false;
+    private readonly _listeners: Record<string, RuntimeSocketListener[]> = {};
+    private readonly _native: RuntimeSocketHandler;
+
+    constructor(native: RuntimeSocketHandler) {
+      if (!constructing) {
+        throw new TypeError(
+          "Illegal constructor: use WebSocketPair, or fetch() with Upgrade: websocket"
+        );
+      }
+      this._native = native;
+    }
+
+    accept() {
+      if (this._accepted) {
+        throw new TypeError("WebSocket was already accepted");
+      }
+      this._accepted = true;
+      this._native.accept();
+      if (this.readyState === RuntimeWebSocket.CONNECTING) {
+        this.readyState = RuntimeWebSocket.OPEN;
+        this._dispatch("open", {});
+      }
+    }
+
+    send(data: string | ArrayBuffer | ArrayBufferView) {
+      if (this.readyState !== RuntimeWebSocket.OPEN) {
+        throw new TypeError("WebSocket is not open, accept() it first");
+      }
+      if (
+        typeof data !== "string" &&
+        !(data instanceof ArrayBuffer) &&
+        !ArrayBuffer.isView(data)
+      ) {
+        throw new TypeError(
+          "WebSocket.send: expecting a string, an ArrayBuffer or an ArrayBufferView"
+        );
+      }
+      this._native.send(data);
+    }
+
+    close(code?: number, reason?: string) {
+      if (
+        code !== undefined &&
+        code !== 1000 &&
+        (!Number.isInteger(code) || code < 3000 || code > 4999)
+      ) {
+        throw new RangeError(
+          "WebSocket.close: code must be 1000, or between 3000 and 4999"
+        );
+      }
+      if (this.readyState >= RuntimeWebSocket.CLOSING) {
+        return;
+      }
+      this.readyState = RuntimeWebSocket.CLOSING;
+      this._native.close(code ?? 1000, String(reason ?? ""));
+    }
+
+    addEventListener(type: string, listener: RuntimeSocketListener) {
+      const listeners = (this._listeners[type] ??= []);
+      if (!listeners.includes(listener)) {
+        listeners.push(listener);
+      }
+    }
+
+    removeEventListener(type: string, listener: RuntimeSocketListener) {
+      const listeners = this._listeners[type];
+      const index = listeners?.indexOf(listener) ?? -1;
+      if (index >= 0) {
+        listeners.splice(index, 1);
+      }
+    }
+
+    // called from Go on the event loop
+    _dispatch(type: string, init: Record<string, any>) {
+      if (type === "close") {
+        this.readyState = RuntimeWebSocket.CLOSED;
+      }
+      const event = { ...init, type, target: this };
+      const handler = (this as any)["on" + type] as RuntimeSocketListener | null;
+      const listeners = [...(this._listeners[type] ?? [])];
+      if (typeof handler === "function") {
+        listeners.unshift(handler);
+      }
+      let error: any;
+      for (const listener of listeners) {
+        try {
+          listener.call(this, event);
+        } catch (e) {
+          error ??= e;
+        }
+      }
+      if (error !== undefined) {
+        throw error;
+      }
+    }
+
+    get [Symbol.toStringTag]() {
+      return "WebSocket";
+    }
+  }
+
+  const newSocket = (native: RuntimeSocketHandler) => {
+    constructing = true;
+    try {
+      return new RuntimeWebSocket(native);
+    } finally {
+      constructing = false;
+    }
+  };
+
+  class RuntimeWebSocketPair {
+    0: RuntimeWebSocket;
+    1: RuntimeWebSocket;
+
+    constructor() {
+      const [client, server] = goWrapper.pair();
+      this[0] = client;
+      this[1] = server;
+    }
+  }
+
+  Object.defineProperty(globalThis, "WebSocket", {
+    value: RuntimeWebSocket,
+    writable: true,
+    configurable: true,
+  });
+  Object.defineProperty(globalThis, "WebSocketPair", {
+    value: RuntimeWebSocketPair,
+    writable: true,
+    configurable: true,
+  });
+
+  // a Response with status 101 hands its webSocket to the client
+  globalThis.Response = __runtimeWrapBodyConstructor(
+    Response,
+    (args) => {
+      const webSocket = args[1]?.webSocket;
+      if (webSocket != null && !(webSocket instanceof RuntimeWebSocket)) {
+        throw new TypeError("Response: webSocket must be a WebSocket");
+      }
+      return args;
+    },
+    (response, [, init]) => {
+      if (init?.webSocket == null) {
+        return;
+      }
+      if (response.status !== 101) {
+        throw new RangeError("Response: webSocket requires status 101");
+      }
+      response._webSocket = init.webSocket;
+    }
+  );
+
+  Object.defineProperty(Response.prototype, "webSocket", {
+    get() {
+      return this._webSocket ?? null;
+    },
+    configurable: true,
+  });
+
+  return newSocket;
+};
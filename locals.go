@@ -0,0 +1,23 @@
+package heresy
+
+import (
+	"context"
+
+	"go.miragespace.co/heresy/extensions/common"
+)
+
+// WithLocals attaches a request-scoped value to ctx, which is exposed to the
+// script as event.locals (FetchEvent), and ctx.locals or res.locals (Express).
+// Use it in Go middleware in front of Runtime.Middleware, e.g. to hand over
+// authenticated claims. v must either be JSON-serializable, or implement
+// goja.DynamicObject to be exposed as a live object.
+func WithLocals(ctx context.Context, v any) context.Context {
+	return common.WithLocals(ctx, v)
+}
+
+// Locals returns the request-scoped value in ctx. In the next handler, this is
+// the value as modified by the script, exported as map[string]any unless
+// a goja.DynamicObject was attached with WithLocals.
+func Locals(ctx context.Context) (any, bool) {
+	return common.GetLocals(ctx)
+}
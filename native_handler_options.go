@@ -1,5 +1,30 @@
 package heresy
 
+import (
+	"go.miragespace.co/heresy/express"
+	"go.miragespace.co/heresy/extensions/common"
+)
+
 type nativeHandlerOptions struct {
-	EnableFetch bool `json:"fetch"`
+	options    common.HandlerOptions
+	extensions []common.Extension // enabled by options
+	parsers    express.BodyParsers
+}
+
+func newNativeHandlerOptions(options common.HandlerOptions, available []common.Extension) (*nativeHandlerOptions, error) {
+	parsers, err := express.NewBodyParsers(options)
+	if err != nil {
+		return nil, err
+	}
+	opts := &nativeHandlerOptions{
+		options:    options,
+		extensions: make([]common.Extension, 0, len(available)),
+		parsers:    parsers,
+	}
+	for _, ext := range available {
+		if ext.Enabled(options) {
+			opts.extensions = append(opts.extensions, ext)
+		}
+	}
+	return opts, nil
 }
@@ -11,6 +11,101 @@ require('text-encoding/FastestTextDecoderPolyfill.es6.min.js')
 // polyfill Fetch API types (Headers, Request, Response)
 require('react-native-fetch/polyfill.es6.min.js')
 
+// Headers polyfill joins multiple values with ", ", which is lossy for Set-Cookie.
+// Keep every value in ._values alongside .map, so they can be retrieved with
+// .getAll()/.getSetCookie() and written as separate header lines.
+// NOTE: Headers backed by http.Header provide ._values natively.
+;(function (proto) {
+    const { append, set } = proto
+    const normalize = (name) => String(name).trim().toLowerCase()
+    proto.append = function (name, value) {
+        const key = normalize(name)
+        // read before .map is updated, the values of http.Header are live
+        const values = this.getAll(key)
+        append.call(this, name, value)
+        if (!this._values) this._values = {}
+        values.push(String(value))
+        this._values[key] = values
+    }
+    proto.set = function (name, value) {
+        set.call(this, name, value)
+        if (!this._values) this._values = {}
+        this._values[normalize(name)] = [String(value)]
+    }
+    proto.delete = function (name) {
+        const key = normalize(name)
+        delete this.map[key]
+        if (this._values) delete this._values[key]
+    }
+    // .map backed by http.Header has no prototype
+    proto.has = function (name) {
+        return Object.prototype.hasOwnProperty.call(this.map, normalize(name))
+    }
+    proto.getAll = function (name) {
+        const key = normalize(name)
+        if (!this.has(key)) return []
+        const values = this._values && this._values[key]
+        return values ? Array.from(values) : [this.get(key)]
+    }
+    proto.getSetCookie = function () {
+        return this.getAll('set-cookie')
+    }
+    proto.forEach = function (callback, thisArg) {
+        for (const key in this.map) {
+            if (key === 'set-cookie') {
+                for (const value of this.getAll(key)) {
+                    callback.call(thisArg, value, key, this)
+                }
+            } else {
+                callback.call(thisArg, this.map[key], key, this)
+            }
+        }
+    }
+})(Headers.prototype)
+
+// Body polyfill drains streams with a BYOB reader into a single reused buffer,
+// which fails for streams constructed in JavaScript and overwrites earlier
+// chunks of multi-chunk bodies. Drain with a default reader and copy instead.
+;(function (proto) {
+    const { arrayBuffer, text } = proto
+    const encoder = new TextEncoder()
+    const drain = async (stream) => {
+        const reader = stream.getReader()
+        const chunks = []
+        let length = 0
+        for (;;) {
+            const { done, value } = await reader.read()
+            if (done) break
+            const chunk = typeof value === 'string'
+                ? encoder.encode(value)
+                : ArrayBuffer.isView(value)
+                    ? new Uint8Array(value.buffer.slice(value.byteOffset, value.byteOffset + value.byteLength))
+                    : new Uint8Array(value)
+            chunks.push(chunk)
+            length += chunk.byteLength
+        }
+        const bytes = new Uint8Array(length)
+        let offset = 0
+        for (const chunk of chunks) {
+            bytes.set(chunk, offset)
+            offset += chunk.byteLength
+        }
+        return bytes
+    }
+    proto.arrayBuffer = async function () {
+        if (!this._bodyReadableStream) return arrayBuffer.call(this)
+        const alreadyConsumed = this.__consumed()
+        if (alreadyConsumed) return alreadyConsumed
+        return (await drain(this._bodyReadableStream)).buffer
+    }
+    proto.text = async function () {
+        if (!this._bodyReadableStream) return text.call(this)
+        const alreadyConsumed = this.__consumed()
+        if (alreadyConsumed) return alreadyConsumed
+        return new TextDecoder().decode(await drain(this._bodyReadableStream))
+    }
+})(Object.getPrototypeOf(Response.prototype))
+
 const __runtimeFetchEventInstance = new FetchEvent()
 const __runtimeRequestInstance = new Request()
 const __runtimeResponseInstance = new Response()
\ No newline at end of file
@@ -1,35 +1,63 @@
 package heresy
 
 import (
+	"context"
 	"fmt"
+	"io/fs"
 	"net/http"
 	"runtime"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"go.miragespace.co/heresy/express"
+	"go.miragespace.co/heresy/extensions/abort"
+	"go.miragespace.co/heresy/extensions/blob"
+	"go.miragespace.co/heresy/extensions/common"
 	"go.miragespace.co/heresy/extensions/console"
+	"go.miragespace.co/heresy/extensions/errorpage"
 	"go.miragespace.co/heresy/extensions/fetch"
+	"go.miragespace.co/heresy/extensions/form"
 	"go.miragespace.co/heresy/extensions/kv"
+	"go.miragespace.co/heresy/extensions/native"
 	"go.miragespace.co/heresy/extensions/promise"
+	"go.miragespace.co/heresy/extensions/rewriter"
 	"go.miragespace.co/heresy/extensions/stream"
+	"go.miragespace.co/heresy/extensions/websocket"
 	"go.miragespace.co/heresy/polyfill"
 
 	"github.com/dop251/goja"
 	"github.com/dop251/goja_nodejs/eventloop"
 	"github.com/dop251/goja_nodejs/require"
+	"github.com/puzpuzpuz/xsync/v2"
 	"go.uber.org/zap"
 	"golang.org/x/sys/cpu"
 )
 
+// properties of FetchEvent and RequestContext that cannot be used as extension names
+var reservedProperties = []string{
+	"fetch", "kv", "locals", "next", "passThrough", "req", "request", "res",
+	"respondWith", "signal", "waitUntil",
+}
+
 type Runtime struct {
-	logger    *zap.Logger
-	transport http.RoundTripper
-	kvManager *kv.KVManager
-	shards    []atomic.Pointer[runtimeInstance]
-	_         cpu.CacheLinePad
-	nextShard uint32
-	_         cpu.CacheLinePad
-	numShards int
+	logger     *zap.Logger
+	transport  http.RoundTripper
+	kvManager  *kv.KVManager
+	modules    *xsync.MapOf[string, native.ModuleFactory]
+	extMu      sync.RWMutex
+	extensions []common.Extension
+	formLimits atomic.Pointer[form.Limits]
+	teeLimits  atomic.Pointer[stream.TeeLimits]
+	errPage    atomic.Pointer[errorpage.Handler]
+	cookies    atomic.Pointer[express.CookieSigner]
+	assets     atomic.Pointer[fs.FS]
+	views      atomic.Pointer[fs.FS]
+	shards     []atomic.Pointer[runtimeInstance]
+	_          cpu.CacheLinePad
+	nextShard  uint32
+	_          cpu.CacheLinePad
+	numShards  int
 }
 
 // NewRuntime returns a new heresy runtime. Use shards > 1 to enable round-robin
@@ -52,11 +80,15 @@ func NewRuntime(logger *zap.Logger, kvManager *kv.KVManager, shards int) (*Runti
 	rt := &Runtime{
 		logger:    logger,
 		kvManager: kvManager,
+		modules:   xsync.NewMapOf[native.ModuleFactory](),
 		transport: t,
 		shards:    make([]atomic.Pointer[runtimeInstance], shards),
 		numShards: shards,
 	}
 
+	rt.formLimits.Store(&form.DefaultLimits)
+	rt.teeLimits.Store(&stream.DefaultTeeLimits)
+
 	for i := range rt.shards {
 		rt.shards[i] = atomic.Pointer[runtimeInstance]{}
 		rt.shards[i].Store(nilInstance)
@@ -86,17 +118,20 @@ func (rt *Runtime) LoadScript(scriptName, script string, interrupt bool) (err er
 		return fmt.Errorf("error compiling script: %w", err)
 	}
 
+	var views *express.Views
+	if fsys := rt.views.Load(); fsys != nil {
+		views, err = express.NewViews(*fsys)
+		if err != nil {
+			return fmt.Errorf("error parsing views: %w", err)
+		}
+	}
+
 	// force GC on script reload
 	defer runtime.GC()
 
 	start := time.Now()
 	for i := range rt.shards {
-		registry := require.NewRegistryWithLoader(polyfill.PolyfillFS.ReadFile)
-
-		loggerModule := console.RequireWithLogger(rt.logger)
-		registry.RegisterNativeModule(console.ModuleName, loggerModule)
-
-		instance, err := rt.getInstance(rt.transport, registry)
+		instance, err := rt.getInstance(rt.transport, views)
 		if err != nil {
 			return err
 		}
@@ -122,6 +157,139 @@ func (rt *Runtime) LoadScript(scriptName, script string, interrupt bool) (err er
 	return nil
 }
 
+// RegisterModule makes a native module available to scripts via require(name).
+// Modules are registered in the registry of every shard, and take effect on
+// the next call to LoadScript.
+func (rt *Runtime) RegisterModule(name string, loader require.ModuleLoader) error {
+	if loader == nil {
+		return fmt.Errorf("module loader cannot be nil")
+	}
+	return rt.registerModuleFactory(name, func(context.Context, *eventloop.EventLoop) require.ModuleLoader {
+		return loader
+	})
+}
+
+// RegisterAsyncModule exposes the exported methods of impl as a native module
+// available to scripts via require(name). Each method returns a Promise, and is
+// invoked off the event loop. See native.AsyncModule for supported signatures.
+func (rt *Runtime) RegisterAsyncModule(name string, impl any) error {
+	factory, err := native.AsyncModule(impl)
+	if err != nil {
+		return err
+	}
+	return rt.registerModuleFactory(name, factory)
+}
+
+func (rt *Runtime) registerModuleFactory(name string, factory native.ModuleFactory) error {
+	if name == "" {
+		return fmt.Errorf("module name cannot be empty")
+	}
+	if name == console.ModuleName {
+		return fmt.Errorf("module name %s is reserved", name)
+	}
+	rt.modules.Store(name, factory)
+	return nil
+}
+
+// RegisterExtension exposes ext as a property on both FetchEvent and
+// Express-style RequestContext, when enabled by the handler options.
+// Extensions take effect on the next call to LoadScript.
+func (rt *Runtime) RegisterExtension(ext common.Extension) error {
+	if ext == nil {
+		return fmt.Errorf("extension cannot be nil")
+	}
+
+	name := ext.Name()
+	for _, r := range reservedProperties {
+		if r == name {
+			return fmt.Errorf("extension name %s is reserved", name)
+		}
+	}
+
+	rt.extMu.Lock()
+	defer rt.extMu.Unlock()
+
+	for _, e := range rt.extensions {
+		if e.Name() == name {
+			return fmt.Errorf("extension %s is already registered", name)
+		}
+	}
+	rt.extensions = append(rt.extensions, ext)
+
+	return nil
+}
+
+// SetFormLimits configures the size limits of parsing request bodies with
+// formData(). Zero values use the respective default in form.DefaultLimits.
+// Limits take effect on the next call to LoadScript.
+func (rt *Runtime) SetFormLimits(limits form.Limits) error {
+	if limits.MaxSize < 0 || limits.MaxPartSize < 0 || limits.MaxParts < 0 || limits.MaxMemory < 0 {
+		return fmt.Errorf("form limits cannot be negative")
+	}
+	rt.formLimits.Store(&limits)
+	return nil
+}
+
+// SetTeeLimits configures the buffering of bodies read twice, e.g. after
+// request.clone() or response.clone(). Zero values use the respective default
+// in stream.DefaultTeeLimits. Limits take effect on the next call to LoadScript.
+func (rt *Runtime) SetTeeLimits(limits stream.TeeLimits) error {
+	if limits.MaxMemory < 0 || limits.MaxSize < 0 {
+		return fmt.Errorf("tee limits cannot be negative")
+	}
+	rt.teeLimits.Store(&limits)
+	return nil
+}
+
+// SetErrorHandler hides exceptions of handlers from clients. Exceptions are
+// logged with a request ID, and handler renders the response to the client,
+// or errorpage.DefaultHandler if nil. A handler registered by the script with
+// registerErrorHandler takes precedence. Without either, the exception is sent
+// to the client, which is useful during development. The handler takes effect
+// on the next call to LoadScript.
+func (rt *Runtime) SetErrorHandler(handler errorpage.Handler) {
+	if handler == nil {
+		handler = errorpage.DefaultHandler
+	}
+	rt.errPage.Store(&handler)
+}
+
+// SetCookieSecret enables signed cookies of Express.js style handlers, with
+// res.cookie(name, value, { signed: true }) and req.signedCookies. Cookies
+// are signed with the first secret, and verified with any of them. The
+// secrets take effect on the next call to LoadScript.
+func (rt *Runtime) SetCookieSecret(secrets ...string) error {
+	signer, err := express.NewCookieSigner(secrets...)
+	if err != nil {
+		return err
+	}
+	rt.cookies.Store(signer)
+	return nil
+}
+
+// SetAssets configures the files served by res.sendFile() and
+// express.static() of Express.js style handlers. The assets take effect on
+// the next call to LoadScript.
+func (rt *Runtime) SetAssets(fsys fs.FS) {
+	if fsys == nil {
+		rt.assets.Store(nil)
+		return
+	}
+	rt.assets.Store(&fsys)
+}
+
+// SetViews configures the html/template templates rendered by res.render()
+// of Express.js style handlers, such as os.DirFS("./views"). Templates are
+// parsed on every call to LoadScript, so changes are reloaded with the
+// script, and an invalid template fails LoadScript.
+func (rt *Runtime) SetViews(fsys fs.FS) {
+	if fsys == nil {
+		rt.views.Store(nil)
+		return
+	}
+	rt.views.Store(&fsys)
+}
+
 func (rt *Runtime) shardRun(fn func(index int, instance *runtimeInstance)) {
 	n := atomic.AddUint32(&rt.nextShard, 1)
 	i := int(n) % rt.numShards
@@ -130,27 +298,39 @@ func (rt *Runtime) shardRun(fn func(index int, instance *runtimeInstance)) {
 	fn(i, instance)
 }
 
-func (rt *Runtime) getInstance(t http.RoundTripper, registry *require.Registry) (instance *runtimeInstance, err error) {
+func (rt *Runtime) getInstance(t http.RoundTripper, views *express.Views) (instance *runtimeInstance, err error) {
+	registry := require.NewRegistryWithLoader(polyfill.PolyfillFS.ReadFile)
+
 	eventLoop := eventloop.NewEventLoop(
 		eventloop.EnableConsole(false),
 		eventloop.WithRegistry(registry),
 	)
 	eventLoop.Start()
 
+	loggerModule := console.RequireWithLogger(rt.logger)
+	registry.RegisterNativeModule(console.ModuleName, loggerModule)
+
+	// calls of native modules, and bodies read by HTMLRewriter, are canceled
+	// when the shard is stopped
+	shardCtx, cancelShard := context.WithCancel(context.Background())
+	rt.modules.Range(func(name string, factory native.ModuleFactory) bool {
+		registry.RegisterNativeModule(name, factory(shardCtx, eventLoop))
+		return true
+	})
+
 	defer func() {
 		if err != nil {
+			cancelShard()
 			eventLoop.StopNoWait()
 		}
 	}()
 
 	instance = &runtimeInstance{
-		logger:    rt.logger,
-		kv:        rt.kvManager,
-		eventLoop: eventLoop,
+		logger:        rt.logger,
+		eventLoop:     eventLoop,
+		cancelShard: cancelShard,
 	}
 
-	var options nativeHandlerOptions
-	instance.handlerOption.Store(&options)
 	instance.middlewareType.Store(handlerTypeUnset)
 
 	var symbols *polyfill.RuntimeSymbols
@@ -159,12 +339,52 @@ func (rt *Runtime) getInstance(t http.RoundTripper, registry *require.Registry)
 		return
 	}
 
+	err = blob.PolyfillBlob(eventLoop)
+	if err != nil {
+		return
+	}
+
+	var errHandler errorpage.Handler
+	if h := rt.errPage.Load(); h != nil {
+		errHandler = *h
+	}
+	instance.errors, err = errorpage.NewReporter(eventLoop, rt.logger, errHandler)
+	if err != nil {
+		return
+	}
+
+	instance.cookies = rt.cookies.Load()
+	if assets := rt.assets.Load(); assets != nil {
+		instance.assets = *assets
+	}
+	instance.views = views
+
 	instance.resolver, err = promise.NewResolver(eventLoop)
 	if err != nil {
 		return
 	}
 
-	instance.stream, err = stream.NewController(eventLoop, symbols)
+	instance.stream, err = stream.NewController(eventLoop, symbols, *rt.teeLimits.Load())
+	if err != nil {
+		return
+	}
+
+	err = rewriter.PolyfillHTMLRewriter(shardCtx, eventLoop, instance.stream)
+	if err != nil {
+		return
+	}
+
+	instance.form, err = form.NewFormParser(eventLoop, instance.stream, *rt.formLimits.Load())
+	if err != nil {
+		return
+	}
+
+	instance.abort, err = abort.NewController(eventLoop)
+	if err != nil {
+		return
+	}
+
+	instance.websocket, err = websocket.NewController(eventLoop, rt.logger)
 	if err != nil {
 		return
 	}
@@ -176,11 +396,23 @@ func (rt *Runtime) getInstance(t http.RoundTripper, registry *require.Registry)
 			Timeout:   time.Second * 10,
 			Transport: t,
 		},
+		WebSocket: instance.websocket,
 	})
 	if err != nil {
 		return
 	}
 
+	instance.extensions = append(instance.extensions, instance.fetcher)
+	if rt.kvManager != nil {
+		instance.extensions = append(instance.extensions, rt.kvManager)
+	}
+	rt.extMu.RLock()
+	instance.extensions = append(instance.extensions, rt.extensions...)
+	rt.extMu.RUnlock()
+
+	handlerOption, _ := newNativeHandlerOptions(nil, instance.extensions)
+	instance.handlerOption.Store(handlerOption)
+
 	err = <-instance.prepareInstance(rt.logger, symbols)
 
 	return
@@ -49,11 +49,19 @@ func (inst *runtimeInstance) handleAsExpress(w http.ResponseWriter, r *http.Requ
 
 	ctx := inst.contextPool.Get(ioCtx)
 
-	ctx.WithHttp(w, r, next)
-
 	handlerOption := inst.handlerOption.Load()
-	if handlerOption.EnableFetch {
-		ctx.EnableFetch()
+	ctx.WithHttp(w, r, next).
+		WithExtensions(handlerOption.extensions)
+
+	router := inst.router.Load()
+	if err := ctx.ParseBody(handlerOption.parsers); err != nil && router == nil {
+		inst.errors.Respond(w, r, "Body parser exception", err)
+		return
+	}
+
+	if router != nil {
+		// the routes are dispatched in Go
+		middlewareHandler = ctx.WithRouter(router).Dispatch()
 	}
 
 	if err := inst.resolver.NewPromiseFuncWithArg(
@@ -76,12 +84,9 @@ func (inst *runtimeInstance) handleAsEvent(w http.ResponseWriter, r *http.Reques
 
 	evt := inst.eventPool.Get(ioCtx)
 
-	evt.WithHttp(w, r, next)
-
 	handlerOption := inst.handlerOption.Load()
-	if handlerOption.EnableFetch {
-		evt.EnableFetch()
-	}
+	evt.WithHttp(w, r, next).
+		WithExtensions(handlerOption.extensions)
 
 	if err := inst.resolver.NewPromiseFuncWithArg(
 		middlewareHandler,
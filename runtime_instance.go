@@ -3,17 +3,21 @@ package heresy
 import (
 	"context"
 	"fmt"
+	"io/fs"
 	"sync/atomic"
 
 	"go.miragespace.co/heresy/event"
 	"go.miragespace.co/heresy/express"
+	"go.miragespace.co/heresy/extensions/abort"
 	"go.miragespace.co/heresy/extensions/common"
 	"go.miragespace.co/heresy/extensions/common/shared"
 	"go.miragespace.co/heresy/extensions/console"
+	"go.miragespace.co/heresy/extensions/errorpage"
 	"go.miragespace.co/heresy/extensions/fetch"
-	"go.miragespace.co/heresy/extensions/kv"
+	"go.miragespace.co/heresy/extensions/form"
 	"go.miragespace.co/heresy/extensions/promise"
 	"go.miragespace.co/heresy/extensions/stream"
+	"go.miragespace.co/heresy/extensions/websocket"
 	"go.miragespace.co/heresy/polyfill"
 
 	"github.com/dop251/goja"
@@ -37,6 +41,7 @@ type runtimeInstance struct {
 	logger            *zap.Logger
 	middlewareHandler atomic.Value                         // goja.Value
 	middlewareType    atomic.Value                         // handlerType
+	router            atomic.Pointer[express.Router]       // nil unless registered with registerExpressApp
 	handlerOption     atomic.Pointer[nativeHandlerOptions] // nativeHandlerOptions
 	ioContextPool     *common.IOContextPool
 	contextPool       *express.RequestContextPool
@@ -44,12 +49,21 @@ type runtimeInstance struct {
 	eventLoop         *eventloop.EventLoop
 	resolver          *promise.PromiseResolver
 	stream            *stream.StreamController
+	abort             *abort.AbortController
 	fetcher           *fetch.Fetch
-	kv                *kv.KVManager
+	form              *form.FormParser
+	errors            *errorpage.Reporter
+	cookies           *express.CookieSigner
+	assets            fs.FS
+	views             *express.Views
+	websocket         *websocket.Controller
+	extensions        []common.Extension
+	cancelShard       context.CancelFunc
 	vm                *goja.Runtime
 }
 
 func (inst *runtimeInstance) stop(interrupt bool) {
+	inst.cancelShard()
 	if interrupt {
 		inst.vm.Interrupt(context.Canceled)
 	}
@@ -60,9 +74,13 @@ func (inst *runtimeInstance) optionHelper(vm *goja.Runtime, opt goja.Value) {
 	if goja.IsUndefined(opt) {
 		return
 	}
-	var options nativeHandlerOptions
+	var options common.HandlerOptions
 	if err := vm.ExportTo(opt, &options); err == nil {
-		inst.handlerOption.Store(&options)
+		handlerOption, err := newNativeHandlerOptions(options, inst.extensions)
+		if err != nil {
+			panic(vm.NewTypeError(err.Error()))
+		}
+		inst.handlerOption.Store(handlerOption)
 	}
 }
 
@@ -83,12 +101,40 @@ func (inst *runtimeInstance) prepareInstance(logger *zap.Logger, symbols *polyfi
 			fn := fc.Argument(0)
 			if _, ok := goja.AssertFunction(fn); ok {
 				inst.middlewareHandler.Store(fn)
+				inst.router.Store(nil)
 				inst.middlewareType.Store(handlerTypeExpress)
 			}
 
 			return
 		})
 
+		expressFn := vm.ToValue(func(fc goja.FunctionCall) goja.Value {
+			return express.NewRouterVM(vm)
+		}).(*goja.Object)
+		expressFn.Set("static", func(fc goja.FunctionCall) goja.Value {
+			return express.NewStaticVM(vm, fc)
+		})
+		vm.Set("express", expressFn)
+
+		vm.Set("registerExpressApp", func(fc goja.FunctionCall) (ret goja.Value) {
+			ret = goja.Undefined()
+
+			app := fc.Argument(0)
+			router, ok := express.AssertRouter(app, vm)
+			if !ok {
+				panic(vm.NewTypeError("registerExpressApp: expecting an app created with express()"))
+			}
+
+			opt := fc.Argument(1)
+			inst.optionHelper(vm, opt)
+
+			inst.middlewareHandler.Store(app)
+			inst.router.Store(router)
+			inst.middlewareType.Store(handlerTypeExpress)
+
+			return
+		})
+
 		vm.Set("registerEventHandler", func(fc goja.FunctionCall) (ret goja.Value) {
 			ret = goja.Undefined()
 
@@ -104,22 +150,41 @@ func (inst *runtimeInstance) prepareInstance(logger *zap.Logger, symbols *polyfi
 			return
 		})
 
+		vm.Set("registerErrorHandler", func(fc goja.FunctionCall) (ret goja.Value) {
+			ret = goja.Undefined()
+
+			fn := fc.Argument(0)
+			if _, ok := goja.AssertFunction(fn); ok {
+				inst.errors.SetScriptHandler(fn)
+			}
+
+			return
+		})
+
 		headersPool := shared.NewHeadersProxyPool(vm, symbols)
 		inst.ioContextPool = common.NewIOContextPool(logger, headersPool, 10)
 		inst.contextPool = express.NewRequestContextPool(express.RequestContextDeps{
 			Logger:    logger,
 			Eventloop: inst.eventLoop,
-			Fetch:     inst.fetcher,
-			KV:        inst.kv,
+			Abort:     inst.abort,
+			Form:      inst.form,
+			Errors:    inst.errors,
+			Cookies:   inst.cookies,
+			Resolver:  inst.resolver,
+			Stream:    inst.stream,
+			Assets:    inst.assets,
+			Views:     inst.views,
 		})
 		inst.eventPool = event.NewFetchEventPool(event.FetchEventDeps{
 			Logger:    logger,
 			Symbols:   symbols,
 			Eventloop: inst.eventLoop,
 			Stream:    inst.stream,
+			Abort:     inst.abort,
 			Resolver:  inst.resolver,
 			Fetch:     inst.fetcher,
-			KV:        inst.kv,
+			Form:      inst.form,
+			Errors:    inst.errors,
 		})
 
 		inst.vm = vm // reference is kept for .Interrupt